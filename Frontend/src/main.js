@@ -2,12 +2,19 @@ import "@tabler/core/dist/js/tabler.min.js";
 import { AccountsModule } from "./modules/accounts.js";
 import { AddZoneModule } from "./modules/add_zone.js";
 import { DNSRecordsModule } from "./modules/dns_records.js";
+import { DNSTemplatesModule } from "./modules/dns_templates.js";
+import { CopyDNSModule } from "./modules/copy_dns.js";
 import { DelDNSModule } from "./modules/del_dns.js";
+import { TakeoverScanModule } from "./modules/takeover_scan.js";
 import { ProxyToggleModule } from "./modules/proxy_toggle.js";
 import { DelZoneModule } from "./modules/del_zone.js";
 import { ExportZonesModule } from "./modules/export_zones.js";
+import { OnboardingModule } from "./modules/onboarding.js";
+import { ZoneMigrateModule } from "./modules/zone_migrate.js";
+import { InventoryModule } from "./modules/inventory.js";
 import { SSLSettingsModule } from "./modules/ssl_settings.js";
 import { ApplyCertModule } from "./modules/apply_cert.js";
+import { DNSSECModule } from "./modules/dnssec.js";
 import { CopyRulesModule } from "./modules/copy_rules.js";
 import { DelRulesModule } from "./modules/del_rules.js";
 import { CacheSettingsModule } from "./modules/cache_settings.js";
@@ -30,6 +37,66 @@ window.handleAuthError = function (response) {
   return false;
 };
 
+// Reads a domain textarea the way the batch endpoints do: URLs are stripped
+// to their host and duplicates dropped. Pages that work on whole zones get
+// the zones and reject subdomains; with records set the full names are
+// kept, for pages that select records. Rejected lines are shown with their
+// line numbers and null is returned.
+window.checkDomains = async function (text, records = false) {
+  const res = await fetch('/api/domains/normalize', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
+    body: JSON.stringify({ domains: text.split('\n') })
+  });
+  if (window.handleAuthError(res)) return null;
+  const data = await res.json();
+  if (!res.ok) {
+    alert(data.error);
+    return null;
+  }
+  const rejected = data.rejected.slice();
+  if (!records) {
+    data.domains.filter(d => d.host).forEach(d => rejected.push({ line: d.line, input: d.input, error: `${d.name} 不是域名(Zone)，请使用 ${d.zone}` }));
+    rejected.sort((a, b) => a.line - b.line);
+  }
+  if (rejected.length > 0) {
+    alert('以下行不是有效的域名:\n' + rejected.map(r => `第 ${r.line} 行 ${r.input.trim()}: ${r.error}`).join('\n'));
+    return null;
+  }
+  return records ? data.domains.map(d => d.name) : data.zones;
+};
+
+// Submits a batch request as a background job (?async=1) and follows its
+// results over SSE, so long batches don't hit proxy timeouts. Resolves with a
+// Response holding the result array, like the synchronous endpoint would.
+// onProgress(done, total) is called as each domain finishes.
+window.fetchBatch = async function (url, options, onProgress) {
+  const res = await fetch(url + (url.includes('?') ? '&' : '?') + 'async=1', options);
+  if (res.status !== 202) return res;
+  const { jobId, total } = await res.json();
+
+  const token = state.token || localStorage.getItem('token');
+  const results = new Array(total).fill(null);
+  await new Promise((resolve, reject) => {
+    const events = new EventSource(`/api/jobs/${jobId}/events?token=${encodeURIComponent(token)}`);
+    events.addEventListener('result', e => {
+      const ev = JSON.parse(e.data);
+      results[ev.index] = ev.result;
+      if (onProgress) onProgress(ev.done, ev.total);
+    });
+    events.addEventListener('done', () => {
+      events.close();
+      resolve();
+    });
+    events.onerror = () => {
+      // Dropped connections are retried by the browser and the results
+      // replayed; a closed stream means the job or the token is gone.
+      if (events.readyState === EventSource.CLOSED) reject(new Error(`Job ${jobId} stream closed`));
+    };
+  });
+  return new Response(JSON.stringify(results), { status: 200, headers: { 'Content-Type': 'application/json' } });
+};
+
 // Global Error Handler for debugging "Empty Page" issues
 window.onerror = function (msg, url, line, col, error) {
   document.body.innerHTML += `
@@ -54,10 +121,16 @@ const menuGroups = [
     items: [
       { id: 'add-zone', name: '批量增域', full: 'CloudFlare 批量添加域名(Zone)', desc: '将域名解析权转移到CloudFlare，需要在域名注册商处更改域名NS为CloudFlare的NS' },
       { id: 'dns-records', name: '批量解析', full: 'CloudFlare 域名批量解析', desc: '批量添加或修改CloudFlare中域名的解析值，支持每个域名解析到不同的IP' },
+      { id: 'dns-templates', name: '解析模板', full: 'CloudFlare 解析模板', desc: '保存常用的解析记录组合，按域名填入变量后批量添加' },
+      { id: 'copy-dns', name: '解析复制', full: 'CloudFlare 解析记录复制', desc: '将一个域名的解析记录复制到其他域名，支持跨账号' },
       { id: 'del-dns', name: '解析删除', full: 'CloudFlare 批量删除解析记录', desc: '将你选择或输入的域名批量删除某个解析记录，支持清空选中域名的所有解析记录' },
+      { id: 'takeover-scan', name: '悬挂扫描', full: 'CloudFlare 悬挂解析扫描', desc: '扫描指向已失效目标、易被接管的服务商或内网IP的解析记录' },
       { id: 'proxy-toggle', name: '代理开关', full: 'CloudFlare 批量开关代理', desc: '将域名解析值中的代理加速开启或关闭，开启代理后将获得CDN缓存功能' },
       { id: 'del-zone', name: '批量删域', full: 'CloudFlare 批量删除域名(Zone)', desc: '将CloudFlare域名列表中的某些域名删除' },
-      { id: 'export-zones', name: '域名导出', full: '批量导出域名', desc: '批量查看或导出您在CloudFlare中的域名' }
+      { id: 'export-zones', name: '域名导出', full: '批量导出域名', desc: '批量查看或导出您在CloudFlare中的域名' },
+      { id: 'onboarding', name: '接入跟踪', full: '域名接入跟踪', desc: '跟踪新增域名的NS修改和激活进度' },
+      { id: 'zone-migrate', name: '跨账号迁移', full: 'CloudFlare 域名跨账号迁移', desc: '将域名连同解析记录、设置和规则迁移到另一个账号，确认后再删除源域名' },
+      { id: 'inventory', name: '域名索引', full: '全部账号域名索引', desc: '在所有账号的域名中搜索，查看域名所属账号，后台定时刷新' }
     ]
   },
   {
@@ -65,6 +138,7 @@ const menuGroups = [
     items: [
       { id: 'ssl-settings', name: 'SSL/HTTPS', full: 'CloudFlare HTTPS边缘证书批量设置', desc: '设置网址的HTTPS加密模式, TLS版本, 自动重定向到HTTPS等' },
       { id: 'apply-cert', name: '证书申请', full: '一键申请免费SSL证书', desc: '使用 Let\'s Encrypt 申请免费SSL证书，支持通配符域名' },
+      { id: 'dnssec', name: 'DNSSEC', full: 'CloudFlare DNSSEC 批量管理', desc: '批量开启或关闭DNSSEC，导出DS记录并检查注册商处是否已发布' },
       { id: 'copy-rules', name: '规则复制', full: 'CloudFlare 批量复制规则,WAF规则', desc: 'Configuration Rules, 转换规则, 重写URL, 修改请求头, 响应头, WAF自定义规则等' },
       { id: 'del-rules', name: '规则清除', full: 'CloudFlare 批量删除页面规则', desc: '批量清空各种规则, 转换规则, 重写URL, 修改请求/响应头, WAF自定义规则等' }
     ]
@@ -252,18 +326,32 @@ function renderModuleContent() {
     AddZoneModule.render(container, state);
   } else if (state.currentModule === 'dns-records') {
     DNSRecordsModule.render(container, state);
+  } else if (state.currentModule === 'dns-templates') {
+    DNSTemplatesModule.render(container, state);
+  } else if (state.currentModule === 'copy-dns') {
+    CopyDNSModule.render(container, state);
   } else if (state.currentModule === 'del-dns') {
     DelDNSModule.render(container, state);
+  } else if (state.currentModule === 'takeover-scan') {
+    TakeoverScanModule.render(container, state);
   } else if (state.currentModule === 'proxy-toggle') {
     ProxyToggleModule.render(container, state);
   } else if (state.currentModule === 'del-zone') {
     DelZoneModule.render(container, state);
   } else if (state.currentModule === 'export-zones') {
     ExportZonesModule.render(container, state);
+  } else if (state.currentModule === 'onboarding') {
+    OnboardingModule.render(container, state);
+  } else if (state.currentModule === 'zone-migrate') {
+    ZoneMigrateModule.render(container, state);
+  } else if (state.currentModule === 'inventory') {
+    InventoryModule.render(container, state);
   } else if (state.currentModule === 'ssl-settings') {
     SSLSettingsModule.render(container, state);
   } else if (state.currentModule === 'apply-cert') {
     ApplyCertModule.render(container, state);
+  } else if (state.currentModule === 'dnssec') {
+    DNSSECModule.render(container, state);
   } else if (state.currentModule === 'copy-rules') {
     CopyRulesModule.render(container, state);
   } else if (state.currentModule === 'del-rules') {
@@ -342,14 +430,25 @@ async function renderDashboard() {
               <input type="text" id="acc-name" class="form-control form-control-lg border-2 shadow-none" placeholder="例如：我的主托管账号">
             </div>
             <div class="row">
+              <div class="col-12 mb-3">
+                <label class="form-label fw-bold mb-1">认证方式</label>
+                <select id="acc-auth-type" class="form-select form-select-lg border-2 shadow-none" onchange="window.updateAuthType()">
+                  <option value="global_key">Global API Key</option>
+                  <option value="api_token">API Token (Bearer)</option>
+                </select>
+              </div>
               <div class="col-12 mb-3">
                 <label class="form-label fw-bold mb-1">邮箱地址 (Email)</label>
                 <input type="email" id="acc-email" class="form-control form-control-lg border-2 shadow-none" placeholder="user@example.com">
               </div>
               <div class="col-12 mb-2">
-                <label class="form-label fw-bold mb-1">Global API Key</label>
+                <label class="form-label fw-bold mb-1" id="acc-key-label">Global API Key</label>
                 <input type="text" id="acc-key" class="form-control form-control-lg border-2 shadow-none" placeholder="输入 37 位 API 令牌">
               </div>
+              <div class="col-12 mb-2 d-none" id="acc-cf-account-wrap">
+                <label class="form-label fw-bold mb-1">Cloudflare Account ID <span class="text-muted small">(可选，用于证书申请)</span></label>
+                <input type="text" id="acc-cf-account-id" class="form-control form-control-lg border-2 shadow-none" placeholder="留空则按域名自动识别">
+              </div>
             </div>
             <div id="test-alert"></div>
           </div>
@@ -376,13 +475,25 @@ window.resetModal = () => {
   document.getElementById('acc-name').value = '';
   document.getElementById('acc-email').value = '';
   document.getElementById('acc-key').value = '';
+  document.getElementById('acc-auth-type').value = 'global_key';
+  document.getElementById('acc-cf-account-id').value = '';
   document.getElementById('test-alert').innerHTML = '';
+  window.updateAuthType();
+};
+
+window.updateAuthType = () => {
+  const isToken = document.getElementById('acc-auth-type').value === 'api_token';
+  document.getElementById('acc-key-label').innerText = isToken ? 'API Token' : 'Global API Key';
+  document.getElementById('acc-key').placeholder = isToken ? '输入 API Token' : '输入 37 位 API 令牌';
+  document.getElementById('acc-email').placeholder = isToken ? 'user@example.com (可选)' : 'user@example.com';
+  document.getElementById('acc-cf-account-wrap').classList.toggle('d-none', !isToken);
 };
 
 window.testAccount = async () => {
   const email = document.getElementById('acc-email').value;
   const key = document.getElementById('acc-key').value;
-  if (!email || !key) return alert('请先填写 Email 和 API Key');
+  const authType = document.getElementById('acc-auth-type').value;
+  if (authType === 'api_token' ? !key : (!email || !key)) return alert('请先填写 Email 和 API Key');
 
   const btn = document.getElementById('btn-test');
   const alertBox = document.getElementById('test-alert');
@@ -393,10 +504,12 @@ window.testAccount = async () => {
     const res = await fetch('/api/accounts/test', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
-      body: JSON.stringify({ email, key })
+      body: JSON.stringify({ email, key, authType })
     });
     const data = await res.json();
-    if (data.success) {
+    if (data.success && data.authType === 'api_token') {
+      alertBox.innerHTML = `<div class="alert alert-success border-0 py-2 mt-2 small mb-0"><div class="fw-bold">✅ 令牌有效，可访问 ${data.zoneCount} 个域名</div><div class="mt-1">权限: ${(data.permissions || []).join(', ') || '无'}</div><div class="mt-1">域名: ${(data.zones || []).join(', ') || '无'}</div></div>`;
+    } else if (data.success) {
       alertBox.innerHTML = '<div class="alert alert-success border-0 py-2 mt-2 fw-bold small mb-0">✅ 连接测试成功</div>';
     } else {
       alertBox.innerHTML = `<div class="alert alert-danger border-0 py-2 mt-2 fw-bold small mb-0">❌ 失败: ${data.message}</div>`;
@@ -420,7 +533,7 @@ window.testExistingAccount = async (id, btn) => {
     const res = await fetch('/api/accounts/test', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
-      body: JSON.stringify({ email: acc.email, key: acc.key })
+      body: JSON.stringify({ id: acc.id })
     });
     const data = await res.json();
 
@@ -449,31 +562,18 @@ window.testExistingAccount = async (id, btn) => {
   }
 };
 
-window.toggleKey = (id, el) => {
-  const acc = window.accountsCache.find(a => a.id === id);
-  if (!acc) return;
-  const isMasked = el.innerText.startsWith('****');
-  if (isMasked) {
-    el.innerText = acc.key;
-    el.classList.remove('text-azure');
-    el.classList.add('text-dark');
-  } else {
-    el.innerText = `****${acc.key.slice(-4)}`;
-    el.classList.remove('text-dark');
-    el.classList.add('text-azure');
-  }
-};
-
 window.saveAccount = async () => {
   const name = document.getElementById('acc-name').value;
   const email = document.getElementById('acc-email').value;
   const key = document.getElementById('acc-key').value;
-  if (!name || !email || !key) return alert('信息填完整');
+  const authType = document.getElementById('acc-auth-type').value;
+  const cfAccountId = document.getElementById('acc-cf-account-id').value;
+  if (!name || !key || (authType !== 'api_token' && !email)) return alert('信息填完整');
 
   const res = await fetch('/api/accounts', {
     method: 'POST',
     headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
-    body: JSON.stringify({ id: state.editingId, name, email, key })
+    body: JSON.stringify({ id: state.editingId, name, email, key, authType, cfAccountId })
   });
 
   if (res.ok) {
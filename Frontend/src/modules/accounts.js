@@ -140,8 +140,8 @@ export class AccountsModule {
                   <td><div class="fw-bold text-dark">${acc.name}</div></td>
                   <td class="text-secondary">${acc.email}</td>
                   <td>
-                    <code class="bg-azure-lt border-0 px-2 py-1 rounded text-azure fw-bold" onclick="window.toggleKey('${acc.id}', this)" style="cursor: pointer;">
-                      ****${acc.key.slice(-4)}
+                    <code class="bg-azure-lt border-0 px-2 py-1 rounded text-azure fw-bold">
+                      ${acc.key}
                     </code>
                   </td>
                   <td>${statusBadge}</td>
@@ -347,7 +347,7 @@ export class AccountsModule {
                         'Content-Type': 'application/json', 
                         'Authorization': localStorage.getItem('token') 
                     },
-                    body: JSON.stringify({ email: acc.email, key: acc.key })
+                    body: JSON.stringify({ id: acc.id })
                 });
                 const data = await res.json();
                 if (data.success) {
@@ -20,6 +20,28 @@ export class AddZoneModule {
                   ${(window.accountsCache || []).map(a => `<option value="${a.id}">${a.name} (${a.email})</option>`).join('')}
                 </select>
               </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">添加到 Cloudflare 账户</label>
+                <select id="zone-cf-account" class="form-select border-2 shadow-none">
+                  <option value="">默认账户</option>
+                </select>
+              </div>
+              <div class="row g-2 mb-3">
+                <div class="col">
+                  <label class="form-label fw-bold">接入方式</label>
+                  <select id="zone-type" class="form-select border-2 shadow-none">
+                    <option value="full">完全接入 (NS)</option>
+                    <option value="partial">部分接入 (CNAME)</option>
+                    <option value="secondary">辅助 DNS (Secondary)</option>
+                  </select>
+                </div>
+                <div class="col d-flex align-items-end">
+                  <div class="form-check form-switch mb-2">
+                    <input class="form-check-input" type="checkbox" id="zone-jump-start" checked>
+                    <label class="form-check-label" for="zone-jump-start">自动扫描导入现有解析</label>
+                  </div>
+                </div>
+              </div>
               <div class="mb-3">
                 <label class="form-label fw-bold">输入域名列表 <span class="badge bg-blue-lt">每行一个</span></label>
                 <textarea id="zone-domains" class="form-control border-2 shadow-none" rows="12" placeholder="example.com\nexample.net\nexample.org"></textarea>
@@ -48,6 +70,32 @@ export class AddZoneModule {
 
     // Bind event listener properly without polluting window object
     document.getElementById('btn-batch-add').addEventListener('click', () => this.batchAddZones(state));
+    document.getElementById('zone-acc-id').addEventListener('change', () => this.loadMemberships(state));
+    document.getElementById('zone-type').addEventListener('change', e => {
+      document.getElementById('zone-jump-start').disabled = e.target.value !== 'full';
+    });
+    this.loadMemberships(state);
+  }
+
+  static async loadMemberships(state) {
+    const accId = document.getElementById('zone-acc-id').value;
+    const select = document.getElementById('zone-cf-account');
+    select.innerHTML = '<option value="">默认账户</option>';
+    if (!accId) return;
+
+    try {
+      const res = await fetch(`/api/accounts/memberships?accountId=${encodeURIComponent(accId)}`, {
+        headers: { 'Authorization': state.token || localStorage.getItem('token') }
+      });
+      if (window.handleAuthError(res)) return;
+      const data = await res.json();
+      if (!res.ok || !data[0] || data[0].error) return;
+      select.innerHTML += data[0].memberships.map(m => `
+        <option value="${m.id}" ${m.id === data[0].cfAccountId ? 'selected' : ''}>${m.name} (${m.id})</option>
+      `).join('');
+    } catch (e) {
+      console.error(e);
+    }
   }
 
   static async batchAddZones(state) {
@@ -58,8 +106,8 @@ export class AddZoneModule {
 
     console.log('Raw input:', JSON.stringify(domainsText));
 
-    let domains = domainsText.split('\n').map(d => d.trim()).filter(d => d.length > 0);
-    domains = [...new Set(domains)];
+    const domains = await window.checkDomains(domainsText);
+    if (!domains) return;
 
     console.log('Final parsed domains:', domains);
     if (domains.length === 0) return alert('域名列表为空或格式不正确');
@@ -81,10 +129,16 @@ export class AddZoneModule {
     `;
 
     try {
-      const res = await fetch('/api/zones/batch-add', {
+      const res = await window.fetchBatch('/api/zones/batch-add', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
-        body: JSON.stringify({ accountId: accId, domains })
+        body: JSON.stringify({
+          accountId: accId,
+          domains,
+          cfAccountId: document.getElementById('zone-cf-account').value,
+          type: document.getElementById('zone-type').value,
+          jumpStart: document.getElementById('zone-jump-start').checked
+        })
       });
       const data = await res.json();
 
@@ -96,10 +150,18 @@ export class AddZoneModule {
           <tbody>
             ${data.map(r => `
               <tr class="bg-white">
-                <td><div class="fw-bold text-dark">${r.domain}</div></td>
-                <td>${r.success ? '<span class="badge bg-success-lt text-success fw-bold">成功</span>' : '<span class="badge bg-danger-lt text-danger fw-bold">失败</span>'}</td>
                 <td>
-                  ${r.success && r.nameServers ? r.nameServers.map(ns => `<div class="small text-muted font-monospace">${ns}</div>`).join('') : `<span class="text-danger small">${r.message}</span>`}
+                  <div class="fw-bold text-dark">${r.domain}</div>
+                  ${r.zoneId ? `<div class="small text-muted font-monospace">${r.zoneId}</div>` : ''}
+                </td>
+                <td>
+                  ${r.success ? '<span class="badge bg-success-lt text-success fw-bold">成功</span>' : '<span class="badge bg-danger-lt text-danger fw-bold">失败</span>'}
+                  ${r.status ? `<div class="small text-muted mt-1">${r.status}</div>` : ''}
+                </td>
+                <td>
+                  ${!r.success ? `<span class="text-danger small">${r.message}</span>` : ''}
+                  ${r.success && r.nameServers ? r.nameServers.map(ns => `<div class="small text-muted font-monospace">${ns}</div>`).join('') : ''}
+                  ${r.success && r.verificationKey ? `<div class="small text-muted">TXT cloudflare-verify.${r.domain}</div><div class="small font-monospace">${r.verificationKey}</div>` : ''}
                 </td>
               </tr>
             `).join('')}
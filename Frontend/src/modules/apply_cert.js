@@ -143,7 +143,7 @@ export class ApplyCertModule {
     `;
 
     try {
-      const res = await fetch('/api/certs/batch-apply', {
+      const res = await window.fetchBatch('/api/certs/batch-apply', {
         method: 'POST',
         headers: { 
           'Content-Type': 'application/json', 
@@ -256,7 +256,8 @@ export class BulkSettingsModule {
       return alert('请至少选择一项要修改的设置');
     }
 
-    const domains = domainsText.split('\n').map(d => d.trim()).filter(d => d.length > 0);
+    const domains = await window.checkDomains(domainsText);
+    if (!domains) return;
     if (domains.length === 0) return alert('域名列表为空');
 
     const btn = document.getElementById('btn-apply-bulk');
@@ -277,7 +278,7 @@ export class BulkSettingsModule {
     `;
 
     try {
-      const res = await fetch('/api/bulk-settings/batch-apply', {
+      const res = await window.fetchBatch('/api/bulk-settings/batch-apply', {
         method: 'POST',
         headers: { 
           'Content-Type': 'application/json', 
@@ -132,7 +132,8 @@ export class CacheSettingsModule {
       return alert('请至少选择一项要执行的操作');
     }
 
-    const domains = domainsText.split('\n').map(d => d.trim()).filter(d => d.length > 0);
+    const domains = await window.checkDomains(domainsText);
+    if (!domains) return;
     if (domains.length === 0) return alert('域名列表为空');
 
     const btn = document.getElementById('btn-apply-cache');
@@ -153,7 +154,7 @@ export class CacheSettingsModule {
     `;
 
     try {
-      const res = await fetch('/api/cache/batch-settings', {
+      const res = await window.fetchBatch('/api/cache/batch-settings', {
         method: 'POST',
         headers: { 
           'Content-Type': 'application/json', 
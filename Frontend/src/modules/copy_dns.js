@@ -0,0 +1,135 @@
+export class CopyDNSModule {
+  static async render(container, state) {
+    const res = await fetch('/api/accounts', { headers: { 'Authorization': state.token || localStorage.getItem('token') } });
+    if (!res.ok) {
+      window.logout();
+      return;
+    }
+    const accounts = await res.json();
+    const accountOptions = (accounts || []).map(a => `<option value="${a.id}">${a.name} (${a.email})</option>`).join('');
+
+    container.innerHTML = `
+      <div class="page-header d-print-none mb-3">
+        <div class="row align-items-center">
+          <div class="col">
+            <div class="page-pretitle text-muted">DNS Management</div>
+            <h2 class="page-title fw-bold">解析记录复制 (Copy DNS Records)</h2>
+          </div>
+        </div>
+      </div>
+      <div class="row row-cards">
+        <div class="col-md-5">
+          <div class="card border-0 shadow-sm rounded-3 h-100">
+            <div class="card-body">
+              <h3 class="card-title fw-bold border-bottom pb-2">操作配置</h3>
+              <div class="mb-3">
+                <label class="form-label fw-bold">源账号</label>
+                <select id="copydns-source-account" class="form-select border-2 shadow-none">${accountOptions}</select>
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">源域名</label>
+                <input id="copydns-source" class="form-control border-2 shadow-none" placeholder="example.com">
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">目标账号</label>
+                <select id="copydns-account" class="form-select border-2 shadow-none">${accountOptions}</select>
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">目标域名 <span class="badge bg-blue-lt">每行一个</span></label>
+                <textarea id="copydns-targets" class="form-control border-2 shadow-none font-monospace" rows="5" placeholder="example.org"></textarea>
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">记录类型 <span class="text-muted small">(逗号分隔，留空复制全部)</span></label>
+                <input id="copydns-types" class="form-control border-2 shadow-none" placeholder="A,CNAME,MX,TXT">
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">已有同名记录时</label>
+                <select id="copydns-mode" class="form-select border-2 shadow-none">
+                  <option value="skip">跳过</option>
+                  <option value="merge">合并(保留已有记录)</option>
+                  <option value="overwrite">覆盖</option>
+                </select>
+              </div>
+              <div class="form-check form-switch mb-2">
+                <input class="form-check-input" type="checkbox" id="copydns-proxied" checked>
+                <label class="form-check-label" for="copydns-proxied">保留代理状态</label>
+              </div>
+              <div class="form-check form-switch mb-2">
+                <input class="form-check-input" type="checkbox" id="copydns-comments" checked>
+                <label class="form-check-label" for="copydns-comments">保留备注</label>
+              </div>
+              <div class="form-check form-switch mb-3">
+                <input class="form-check-input" type="checkbox" id="copydns-rewrite">
+                <label class="form-check-label" for="copydns-rewrite">记录值中的源域名也替换为目标域名</label>
+              </div>
+              <div class="row g-2">
+                <div class="col"><button id="btn-copydns-preview" class="btn btn-outline-secondary w-100">预览</button></div>
+                <div class="col"><button id="btn-copydns" class="btn btn-primary w-100 fw-bold">开始复制</button></div>
+              </div>
+            </div>
+          </div>
+        </div>
+        <div class="col-md-7">
+          <div class="card border-0 shadow-sm rounded-3 h-100">
+            <div class="card-body">
+              <h3 class="card-title fw-bold border-bottom pb-2">执行结果</h3>
+              <div id="copydns-results" class="mt-2">
+                <div class="text-center py-6 text-muted">填写源域名和目标域名后点击预览</div>
+              </div>
+            </div>
+          </div>
+        </div>
+      </div>
+    `;
+
+    document.getElementById('btn-copydns-preview').addEventListener('click', () => this.copy(state, true));
+    document.getElementById('btn-copydns').addEventListener('click', () => this.copy(state, false));
+  }
+
+  static async copy(state, dryRun) {
+    const body = {
+      sourceAccountId: document.getElementById('copydns-source-account').value,
+      accountId: document.getElementById('copydns-account').value,
+      sourceDomain: document.getElementById('copydns-source').value.trim(),
+      targetDomains: document.getElementById('copydns-targets').value.split('\n').map(d => d.trim()).filter(d => d),
+      types: document.getElementById('copydns-types').value.split(',').map(t => t.trim()).filter(t => t),
+      mode: document.getElementById('copydns-mode').value,
+      keepProxied: document.getElementById('copydns-proxied').checked,
+      keepComments: document.getElementById('copydns-comments').checked,
+      rewriteTargets: document.getElementById('copydns-rewrite').checked,
+      dryRun
+    };
+    if (!body.sourceDomain) return alert('请输入源域名');
+    if (body.targetDomains.length === 0) return alert('请输入目标域名');
+    if (!dryRun && !confirm(`确定要复制 ${body.sourceDomain} 的解析记录到 ${body.targetDomains.length} 个域名吗？`)) return;
+
+    const resultsDiv = document.getElementById('copydns-results');
+    resultsDiv.innerHTML = '<div class="text-center py-6"><span class="spinner-border spinner-border-sm me-2"></span>处理中...</div>';
+    try {
+      const res = await window.fetchBatch('/api/dns/copy', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
+        body: JSON.stringify(body)
+      });
+      if (window.handleAuthError(res)) return;
+      const data = await res.json();
+      if (!res.ok) {
+        resultsDiv.innerHTML = `<div class="alert alert-danger">${data.error}</div>`;
+        return;
+      }
+      resultsDiv.innerHTML = data.map(r => `
+        <div class="border rounded p-3 mb-2 bg-white">
+          <div class="d-flex justify-content-between">
+            <div class="fw-bold text-dark">${r.domain}</div>
+            <span class="badge ${r.success ? 'bg-success-lt text-success' : 'bg-danger-lt text-danger'}">${r.message}</span>
+          </div>
+          <div class="small text-muted mt-1">新增 ${r.created} / 更新 ${r.updated} / 删除 ${r.deleted} / 跳过 ${r.skipped} / 未变 ${r.unchanged}</div>
+          ${r.plan ? `<pre class="small mt-2 mb-0">${r.plan.join('\n')}</pre>` : ''}
+        </div>
+      `).join('');
+    } catch (e) {
+      console.error(e);
+      resultsDiv.innerHTML = '<div class="text-center py-6 text-danger">请求发生错误</div>';
+    }
+  }
+}
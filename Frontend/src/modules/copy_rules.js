@@ -97,7 +97,8 @@ export class CopyRulesModule {
 
     if (ruleTypes.length === 0) return alert('请至少选择一种规则类型');
 
-    const targetDomains = targetsText.split('\n').map(d => d.trim()).filter(d => d.length > 0);
+    const targetDomains = await window.checkDomains(targetsText);
+    if (!targetDomains) return;
     if (targetDomains.length === 0) return alert('目标域名列表为空');
 
     const btn = document.getElementById('btn-copy-rules');
@@ -118,7 +119,7 @@ export class CopyRulesModule {
     `;
 
     try {
-      const res = await fetch('/api/rules/batch-copy', {
+      const res = await window.fetchBatch('/api/rules/batch-copy', {
         method: 'POST',
         headers: { 
           'Content-Type': 'application/json', 
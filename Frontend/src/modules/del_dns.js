@@ -97,7 +97,8 @@ export class DelDNSModule {
     if (!accountId) return alert('请选择操作账号');
     if (!domainsText.trim()) return alert('请输入域名列表');
 
-    const domains = domainsText.split('\n').map(d => d.trim()).filter(d => d.length > 0);
+    const domains = await window.checkDomains(domainsText, true);
+    if (!domains) return;
     if (domains.length === 0) return alert('域名列表为空');
 
     if (!confirm(`确定要删除 ${domains.length} 个域名的DNS记录吗？此操作不可撤销！`)) return;
@@ -120,7 +121,7 @@ export class DelDNSModule {
     `;
 
     try {
-      const res = await fetch('/api/dns/batch-delete', {
+      const res = await window.fetchBatch('/api/dns/batch-delete', {
         method: 'POST',
         headers: { 
           'Content-Type': 'application/json', 
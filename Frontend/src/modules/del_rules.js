@@ -95,7 +95,8 @@ export class DelRulesModule {
 
     if (ruleTypes.length === 0) return alert('请至少选择一种规则类型');
 
-    const domains = domainsText.split('\n').map(d => d.trim()).filter(d => d.length > 0);
+    const domains = await window.checkDomains(domainsText);
+    if (!domains) return;
     if (domains.length === 0) return alert('域名列表为空');
 
     if (!confirm(`确定要删除 ${domains.length} 个域名的规则吗？此操作不可撤销！`)) return;
@@ -118,7 +119,7 @@ export class DelRulesModule {
     `;
 
     try {
-      const res = await fetch('/api/rules/batch-delete', {
+      const res = await window.fetchBatch('/api/rules/batch-delete', {
         method: 'POST',
         headers: { 
           'Content-Type': 'application/json', 
@@ -67,7 +67,8 @@ export class DelZoneModule {
     if (!accountId) return alert('请选择操作账号');
     if (!domainsText.trim()) return alert('请输入域名列表');
 
-    const domains = domainsText.split('\n').map(d => d.trim()).filter(d => d.length > 0);
+    const domains = await window.checkDomains(domainsText);
+    if (!domains) return;
     if (domains.length === 0) return alert('域名列表为空');
 
     if (!confirm(`确定要删除 ${domains.length} 个域名吗？此操作将删除所有DNS记录且不可撤销！`)) return;
@@ -90,7 +91,7 @@ export class DelZoneModule {
     `;
 
     try {
-      const res = await fetch('/api/zones/batch-delete', {
+      const res = await window.fetchBatch('/api/zones/batch-delete', {
         method: 'POST',
         headers: { 
           'Content-Type': 'application/json', 
@@ -38,6 +38,8 @@ export class DNSRecordsModule {
                     <div>例如3：example.com|www|A|44.55.123.111</div>
                     <div>例如4：example.com|www,m,@|A|44.55.123.111</div>
                     <div>例如5：example.com|@|MX|mail.example.com|5</div>
+                    <div>例如6：example.com|_sip._tcp|SRV|10 60 5060 sip.example.com</div>
+                    <div>例如7：example.com|@|CAA|0 issue "letsencrypt.org"</div>
                   </div>
                 </div>
               </div>
@@ -67,6 +69,12 @@ export class DNSRecordsModule {
                     删除原解析
                   </label>
                 </div>
+                <div class="form-check form-switch mb-2">
+                  <input class="form-check-input" type="checkbox" id="dns-upsert">
+                  <label class="form-check-label" for="dns-upsert">
+                    原地更新(不中断解析)
+                  </label>
+                </div>
                 <div class="form-check form-switch">
                   <input class="form-check-input" type="checkbox" id="dns-offline">
                   <label class="form-check-label" for="dns-offline">
@@ -105,6 +113,7 @@ export class DNSRecordsModule {
     const ttl = parseInt(document.getElementById('dns-ttl').value);
     const proxied = document.getElementById('dns-proxy').checked;
     const deleteOld = document.getElementById('dns-delete-old').checked;
+    const upsert = document.getElementById('dns-upsert').checked;
     const offlineMode = document.getElementById('dns-offline').checked;
 
     if (!accountId) return alert('请选择操作账号');
@@ -141,7 +150,7 @@ export class DNSRecordsModule {
     `;
 
     try {
-      const res = await fetch('/api/dns/batch-parse', {
+      const res = await window.fetchBatch('/api/dns/batch-parse', {
         method: 'POST',
         headers: { 
           'Content-Type': 'application/json', 
@@ -153,6 +162,7 @@ export class DNSRecordsModule {
           ttl, 
           proxied, 
           deleteOld, 
+          upsert, 
           offlineMode 
         })
       });
@@ -0,0 +1,228 @@
+export class DNSTemplatesModule {
+  static async render(container, state) {
+    const res = await fetch('/api/accounts', { headers: { 'Authorization': state.token || localStorage.getItem('token') } });
+    if (!res.ok) {
+      window.logout();
+      return;
+    }
+    const accounts = await res.json();
+
+    container.innerHTML = `
+      <div class="page-header d-print-none mb-3">
+        <div class="row align-items-center">
+          <div class="col">
+            <div class="page-pretitle text-muted">DNS Management</div>
+            <h2 class="page-title fw-bold">解析模板 (DNS Templates)</h2>
+          </div>
+        </div>
+      </div>
+      <div class="row row-cards">
+        <div class="col-md-5">
+          <div class="card border-0 shadow-sm rounded-3 mb-3">
+            <div class="card-body">
+              <h3 class="card-title fw-bold border-bottom pb-2">编辑模板</h3>
+              <div class="mb-3">
+                <label class="form-label fw-bold">模板名称</label>
+                <input id="tpl-name" class="form-control border-2 shadow-none" placeholder="site">
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">解析记录 <span class="badge bg-blue-lt">每行一个</span></label>
+                <textarea id="tpl-lines" class="form-control border-2 shadow-none font-monospace" rows="6" placeholder="@|A|{{ip}}"></textarea>
+                <div class="bg-light border rounded p-2 mt-2">
+                  <div class="fw-bold small text-dark mb-1">格式：主机记录|记录类型|记录值，可使用 {{domain}} 及自定义变量</div>
+                  <div class="small text-primary" style="line-height: 1.6;">
+                    <div>@|A|{{ip}}</div>
+                    <div>www|CNAME|{{domain}}</div>
+                    <div>@|MX|mx.{{mail}}|10</div>
+                    <div>_dmarc|TXT|v=DMARC1; p=none</div>
+                  </div>
+                </div>
+              </div>
+              <button id="btn-save-template" class="btn btn-outline-primary w-100">保存模板</button>
+            </div>
+          </div>
+          <div class="card border-0 shadow-sm rounded-3">
+            <div class="card-body">
+              <h3 class="card-title fw-bold border-bottom pb-2">应用模板</h3>
+              <div class="mb-3">
+                <label class="form-label fw-bold">选择 Cloudflare 账号</label>
+                <select id="tpl-account" class="form-select border-2 shadow-none">
+                  ${(accounts || []).map(a => `<option value="${a.id}">${a.name} (${a.email})</option>`).join('')}
+                </select>
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">选择模板</label>
+                <select id="tpl-select" class="form-select border-2 shadow-none"></select>
+                <div id="tpl-variables" class="small text-muted mt-1"></div>
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">域名及变量 <span class="badge bg-blue-lt">CSV</span></label>
+                <textarea id="tpl-csv" class="form-control border-2 shadow-none font-monospace" rows="6" placeholder="domain,ip&#10;example.com,1.2.3.4"></textarea>
+                <div class="small text-muted mt-1">第一行为列名，必须包含 domain 列，其余列为变量</div>
+              </div>
+              <div class="form-check form-switch mb-2">
+                <input class="form-check-input" type="checkbox" id="tpl-proxy">
+                <label class="form-check-label" for="tpl-proxy">开启代理</label>
+              </div>
+              <div class="form-check form-switch mb-2">
+                <input class="form-check-input" type="checkbox" id="tpl-delete-old">
+                <label class="form-check-label" for="tpl-delete-old">删除原解析</label>
+              </div>
+              <div class="form-check form-switch mb-3">
+                <input class="form-check-input" type="checkbox" id="tpl-upsert">
+                <label class="form-check-label" for="tpl-upsert">原地更新(不中断解析)</label>
+              </div>
+              <div class="row g-2">
+                <div class="col"><button id="btn-preview-template" class="btn btn-outline-secondary w-100">预览</button></div>
+                <div class="col"><button id="btn-apply-template" class="btn btn-primary w-100 fw-bold">应用</button></div>
+              </div>
+            </div>
+          </div>
+        </div>
+        <div class="col-md-7">
+          <div class="card border-0 shadow-sm rounded-3 h-100">
+            <div class="card-body">
+              <h3 class="card-title fw-bold border-bottom pb-2">执行结果</h3>
+              <div id="tpl-results" class="table-responsive mt-2">
+                <div class="text-center py-6 text-muted">填写域名后点击预览</div>
+              </div>
+            </div>
+          </div>
+        </div>
+      </div>
+    `;
+
+    document.getElementById('btn-save-template').addEventListener('click', () => this.saveTemplate(state));
+    document.getElementById('btn-preview-template').addEventListener('click', () => this.preview(state));
+    document.getElementById('btn-apply-template').addEventListener('click', () => this.apply(state));
+    document.getElementById('tpl-select').addEventListener('change', () => this.showTemplate());
+    await this.loadTemplates(state);
+  }
+
+  static async loadTemplates(state, selected) {
+    const res = await fetch('/api/dns/templates', { headers: { 'Authorization': state.token || localStorage.getItem('token') } });
+    if (window.handleAuthError(res)) return;
+    this.templates = await res.json();
+    const select = document.getElementById('tpl-select');
+    select.innerHTML = this.templates.map(t => `<option value="${t.name}" ${t.name === selected ? 'selected' : ''}>${t.name}</option>`).join('');
+    this.showTemplate();
+  }
+
+  static showTemplate() {
+    const name = document.getElementById('tpl-select').value;
+    const t = (this.templates || []).find(t => t.name === name);
+    const varsDiv = document.getElementById('tpl-variables');
+    if (!t) {
+      varsDiv.textContent = '暂无模板';
+      return;
+    }
+    document.getElementById('tpl-name').value = t.name;
+    document.getElementById('tpl-lines').value = t.records.map(r => [r.host, r.type, r.value].concat(r.priority != null ? [r.priority] : []).join('|')).join('\n');
+    varsDiv.textContent = t.variables.length ? `变量: domain, ${t.variables.join(', ')}` : '变量: domain';
+  }
+
+  static async saveTemplate(state) {
+    const name = document.getElementById('tpl-name').value.trim();
+    const lines = document.getElementById('tpl-lines').value.split('\n').filter(l => l.trim());
+    if (!name) return alert('请输入模板名称');
+    if (lines.length === 0) return alert('请输入解析记录');
+
+    const res = await fetch('/api/dns/templates', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
+      body: JSON.stringify({ name, lines })
+    });
+    if (window.handleAuthError(res)) return;
+    const data = await res.json();
+    if (!res.ok) return alert(data.error);
+    await this.loadTemplates(state, data.name);
+  }
+
+  static request() {
+    return {
+      accountId: document.getElementById('tpl-account').value,
+      template: document.getElementById('tpl-select').value,
+      csv: document.getElementById('tpl-csv').value,
+      proxied: document.getElementById('tpl-proxy').checked,
+      deleteOld: document.getElementById('tpl-delete-old').checked,
+      upsert: document.getElementById('tpl-upsert').checked
+    };
+  }
+
+  static async preview(state) {
+    const req = this.request();
+    if (!req.template) return alert('请先保存模板');
+    const resultsDiv = document.getElementById('tpl-results');
+
+    const res = await fetch('/api/dns/templates/preview', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
+      body: JSON.stringify(req)
+    });
+    if (window.handleAuthError(res)) return;
+    const data = await res.json();
+    if (!res.ok) {
+      resultsDiv.innerHTML = `<div class="alert alert-danger">${data.error}</div>`;
+      return;
+    }
+
+    resultsDiv.innerHTML = `
+      <div class="mb-2 text-muted small">共 ${data.records.length} 条记录，${data.errors} 条有错误</div>
+      ${this.table(data.records.map(r => ({ ...r, success: !r.error, message: r.error || '待添加' })))}
+    `;
+  }
+
+  static async apply(state) {
+    const req = this.request();
+    if (!req.template) return alert('请先保存模板');
+    if (!confirm('确定要应用模板吗？')) return;
+
+    const btn = document.getElementById('btn-apply-template');
+    const resultsDiv = document.getElementById('tpl-results');
+    btn.disabled = true;
+    btn.innerHTML = '<span class="spinner-border spinner-border-sm me-2"></span>执行中...';
+    try {
+      const res = await window.fetchBatch('/api/dns/templates/apply', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
+        body: JSON.stringify(req)
+      });
+      if (window.handleAuthError(res)) return;
+      const data = await res.json();
+      if (!res.ok) {
+        resultsDiv.innerHTML = `<div class="alert alert-danger">${data.error}</div>`;
+        return;
+      }
+      resultsDiv.innerHTML = this.table(data);
+    } catch (e) {
+      console.error(e);
+      alert('请求发生错误');
+    } finally {
+      btn.disabled = false;
+      btn.innerHTML = '应用';
+    }
+  }
+
+  static table(rows) {
+    return `
+      <table class="table table-vcenter card-table table-hover">
+        <thead class="bg-light">
+          <tr><th>域名</th><th>主机记录</th><th>类型</th><th>记录值</th><th>状态</th></tr>
+        </thead>
+        <tbody>
+          ${rows.map(r => `
+            <tr class="bg-white">
+              <td class="fw-bold text-dark">${r.domain}</td>
+              <td>${r.host}</td>
+              <td>${r.type}</td>
+              <td class="small font-monospace text-break">${r.value}</td>
+              <td>${r.success
+                ? `<span class="badge bg-success-lt text-success">${r.message}</span>`
+                : `<span class="badge bg-danger-lt text-danger">${r.message}</span>`}</td>
+            </tr>
+          `).join('')}
+        </tbody>
+      </table>
+    `;
+  }
+}
@@ -0,0 +1,170 @@
+export class DNSSECModule {
+  static async render(container, state) {
+    const res = await fetch('/api/accounts', { headers: { 'Authorization': state.token || localStorage.getItem('token') } });
+    if (!res.ok) {
+      window.logout();
+      return;
+    }
+    const accounts = await res.json();
+
+    container.innerHTML = `
+      <div class="page-header d-print-none mb-3">
+        <div class="row align-items-center">
+          <div class="col">
+            <div class="page-pretitle text-muted">Security</div>
+            <h2 class="page-title fw-bold">DNSSEC 批量管理 (DNSSEC)</h2>
+          </div>
+        </div>
+      </div>
+      <div class="row row-cards">
+        <div class="col-md-4">
+          <div class="card border-0 shadow-sm rounded-3 h-100">
+            <div class="card-body">
+              <h3 class="card-title fw-bold border-bottom pb-2">操作配置</h3>
+              <div class="mb-3">
+                <label class="form-label fw-bold">选择 Cloudflare 账号</label>
+                <select id="dnssec-account" class="form-select border-2 shadow-none">
+                  ${(accounts || []).map(a => `<option value="${a.id}">${a.name} (${a.email})</option>`).join('')}
+                </select>
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">域名 <span class="badge bg-blue-lt">每行一个</span></label>
+                <textarea id="dnssec-domains" class="form-control border-2 shadow-none font-monospace" rows="8" placeholder="example.com"></textarea>
+                <div class="small text-muted mt-1">查询状态时留空表示账号下全部域名</div>
+              </div>
+              <div class="form-check form-switch mb-2">
+                <input class="form-check-input" type="checkbox" id="dnssec-verify">
+                <label class="form-check-label" for="dnssec-verify">检查上级域是否已发布 DS 记录</label>
+              </div>
+              <div class="mb-3">
+                <input id="dnssec-resolver" class="form-control border-2 shadow-none" placeholder="DNS 服务器，默认使用配置中的第一个公共 DNS">
+              </div>
+              <button id="btn-dnssec-status" class="btn btn-primary w-100 mb-2 fw-bold">查询状态</button>
+              <div class="row g-2">
+                <div class="col"><button id="btn-dnssec-enable" class="btn btn-outline-success w-100">批量开启</button></div>
+                <div class="col"><button id="btn-dnssec-disable" class="btn btn-outline-danger w-100">批量关闭</button></div>
+              </div>
+              <button id="btn-dnssec-export" class="btn btn-outline-secondary w-100 mt-2" style="display: none;">导出 DS 记录 (CSV)</button>
+            </div>
+          </div>
+        </div>
+        <div class="col-md-8">
+          <div class="card border-0 shadow-sm rounded-3 h-100">
+            <div class="card-body">
+              <h3 class="card-title fw-bold border-bottom pb-2">DS 记录</h3>
+              <div id="dnssec-results" class="table-responsive mt-2">
+                <div class="text-center py-6 text-muted">选择账号后查询状态</div>
+              </div>
+            </div>
+          </div>
+        </div>
+      </div>
+    `;
+
+    document.getElementById('btn-dnssec-status').addEventListener('click', () => this.status(state));
+    document.getElementById('btn-dnssec-enable').addEventListener('click', () => this.batch(state, 'enable'));
+    document.getElementById('btn-dnssec-disable').addEventListener('click', () => this.batch(state, 'disable'));
+    document.getElementById('btn-dnssec-export').addEventListener('click', () => this.exportCSV());
+  }
+
+  static domains() {
+    return document.getElementById('dnssec-domains').value.split('\n').map(d => d.trim()).filter(d => d);
+  }
+
+  static async status(state) {
+    const accountId = document.getElementById('dnssec-account').value;
+    if (!accountId) return alert('请选择操作账号');
+    await this.request(state, '/api/dnssec/status', {
+      accountId,
+      domains: this.domains(),
+      verify: document.getElementById('dnssec-verify').checked,
+      resolver: document.getElementById('dnssec-resolver').value.trim()
+    });
+  }
+
+  static async batch(state, action) {
+    const accountId = document.getElementById('dnssec-account').value;
+    const domains = this.domains();
+    if (!accountId) return alert('请选择操作账号');
+    if (domains.length === 0) return alert('请输入域名');
+    if (action === 'disable' && !confirm('关闭 DNSSEC 前请先在注册商处删除 DS 记录，否则域名将无法解析。确定继续吗？')) return;
+    await this.request(state, '/api/dnssec/batch', { accountId, domains, action });
+  }
+
+  static async request(state, url, body) {
+    const resultsDiv = document.getElementById('dnssec-results');
+    resultsDiv.innerHTML = '<div class="text-center py-6"><span class="spinner-border spinner-border-sm me-2"></span>处理中...</div>';
+    try {
+      const send = url === '/api/dnssec/batch' ? window.fetchBatch : fetch;
+      const res = await send(url, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
+        body: JSON.stringify(body)
+      });
+      if (window.handleAuthError(res)) return;
+      const data = await res.json();
+      if (!res.ok) {
+        resultsDiv.innerHTML = `<div class="alert alert-danger">${data.error}</div>`;
+        return;
+      }
+      this.results = data;
+      document.getElementById('btn-dnssec-export').style.display = data.length ? 'block' : 'none';
+      resultsDiv.innerHTML = this.table(data);
+    } catch (e) {
+      console.error(e);
+      resultsDiv.innerHTML = '<div class="text-center py-6 text-danger">请求发生错误</div>';
+    }
+  }
+
+  static table(rows) {
+    const parentBadge = {
+      match: '<span class="badge bg-success-lt text-success">已发布</span>',
+      missing: '<span class="badge bg-warning-lt text-warning">未发布</span>',
+      mismatch: '<span class="badge bg-danger-lt text-danger">不一致</span>',
+      stale: '<span class="badge bg-danger-lt text-danger">需删除</span>'
+    };
+    return `
+      <table class="table table-vcenter card-table table-hover">
+        <thead class="bg-light">
+          <tr><th>域名</th><th>状态</th><th>Key Tag</th><th>算法</th><th>摘要类型</th><th>摘要</th><th>上级域</th></tr>
+        </thead>
+        <tbody>
+          ${rows.map(r => `
+            <tr class="bg-white">
+              <td>
+                <div class="fw-bold text-dark">${r.domain}</div>
+                ${!r.success || r.parentStatus ? `<div class="small ${r.success ? 'text-muted' : 'text-danger'}">${r.message}</div>` : ''}
+              </td>
+              <td>${r.status ? `<span class="badge ${r.status === 'active' ? 'bg-success-lt text-success' : 'bg-secondary-lt text-secondary'}">${r.status}</span>` : '-'}</td>
+              <td class="font-monospace">${r.ds ? r.ds.keyTag : '-'}</td>
+              <td class="font-monospace">${r.ds ? r.ds.algorithm : '-'}</td>
+              <td class="font-monospace">${r.ds ? r.ds.digestType : '-'}</td>
+              <td class="small font-monospace text-break">${r.ds ? r.ds.digest : '-'}</td>
+              <td>${parentBadge[r.parentStatus] || '-'}</td>
+            </tr>
+          `).join('')}
+        </tbody>
+      </table>
+    `;
+  }
+
+  static exportCSV() {
+    if (!this.results || this.results.length === 0) return;
+
+    const quote = v => `"${String(v ?? '').replace(/"/g, '""')}"`;
+    const lines = [['domain', 'status', 'key_tag', 'algorithm', 'digest_type', 'digest', 'ds_record', 'parent_status'].join(',')];
+    for (const r of this.results) {
+      const ds = r.ds || {};
+      lines.push([r.domain, r.status, ds.keyTag, ds.algorithm, ds.digestType, ds.digest, ds.record, r.parentStatus].map(quote).join(','));
+    }
+    const blob = new Blob([lines.join('\n')], { type: 'text/csv' });
+    const url = URL.createObjectURL(blob);
+    const a = document.createElement('a');
+    a.href = url;
+    a.download = `dnssec-${new Date().getTime()}.csv`;
+    document.body.appendChild(a);
+    a.click();
+    document.body.removeChild(a);
+    URL.revokeObjectURL(url);
+  }
+}
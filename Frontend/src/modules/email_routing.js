@@ -60,8 +60,8 @@ export class EmailRoutingModule {
 
     if (!accId || !worker || !domainsText.trim()) return alert('请选择账号并输入 Worker 名称和域名列表');
 
-    let domains = domainsText.split('\n').map(d => d.trim()).filter(d => d.length > 0);
-    domains = [...new Set(domains)];
+    const domains = await window.checkDomains(domainsText);
+    if (!domains) return;
 
     if (domains.length === 0) return alert('域名列表为空或格式不正确');
 
@@ -82,7 +82,7 @@ export class EmailRoutingModule {
     `;
 
     try {
-      const res = await fetch('/api/email/batch-routing', {
+      const res = await window.fetchBatch('/api/email/batch-routing', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
         body: JSON.stringify({ accountId: accId, domains, worker })
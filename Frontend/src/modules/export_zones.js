@@ -27,6 +27,28 @@ export class ExportZonesModule {
                   ${(accounts || []).map(a => `<option value="${a.id}">${a.name} (${a.email})</option>`).join('')}
                 </select>
               </div>
+              <div class="form-check form-switch mb-3">
+                <input class="form-check-input" type="checkbox" id="export-all-accounts">
+                <label class="form-check-label" for="export-all-accounts">导出全部账号(带账号列)</label>
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">表格列 <span class="text-muted small">(CSV / Excel 下载)</span></label>
+                <div class="row">
+                  ${this.columns.map(c => `
+                    <div class="col-6">
+                      <label class="form-check mb-1">
+                        <input class="form-check-input export-column" type="checkbox" value="${c.id}" ${c.checked ? 'checked' : ''}>
+                        <span class="form-check-label small">${c.name}</span>
+                      </label>
+                    </div>
+                  `).join('')}
+                </div>
+                <div class="small text-muted">解析数量、代理比例和 SSL 模式需要逐个读取域名，域名较多时较慢</div>
+              </div>
+              <div class="row g-2 mb-2">
+                <div class="col"><button id="btn-export-csv" class="btn btn-outline-secondary w-100">下载 CSV</button></div>
+                <div class="col"><button id="btn-export-xlsx" class="btn btn-outline-success w-100">下载 Excel</button></div>
+              </div>
               <div class="form-footer mt-4">
                 <button id="btn-export-zones" class="btn btn-primary w-100 py-2 fw-bold shadow-sm">
                   <svg xmlns="http://www.w3.org/2000/svg" class="icon" width="24" height="24" viewBox="0 0 24 24" stroke-width="2" stroke="currentColor" fill="none" stroke-linecap="round" stroke-linejoin="round"><path stroke="none" d="M0 0h24v24H0z" fill="none"/><path d="M14 3v4a1 1 0 0 0 1 1h4" /><path d="M17 21h-10a2 2 0 0 1 -2 -2v-14a2 2 0 0 1 2 -2h7l5 5v11a2 2 0 0 1 -2 2z" /><path d="M12 11v6" /><path d="M9 14l3 3l3 -3" /></svg>
@@ -60,12 +82,83 @@ export class ExportZonesModule {
     `;
 
     document.getElementById('btn-export-zones').addEventListener('click', () => this.exportZones(state));
+    document.getElementById('btn-export-csv').addEventListener('click', () => this.download(state, 'csv'));
+    document.getElementById('btn-export-xlsx').addEventListener('click', () => this.download(state, 'xlsx'));
+    document.getElementById('export-all-accounts').addEventListener('change', e => {
+      document.getElementById('export-account').disabled = e.target.checked;
+      document.querySelector('.export-column[value="account"]').checked = e.target.checked;
+    });
+  }
+
+  static get columns() {
+    return [
+      { id: 'account', name: '账号' },
+      { id: 'domain', name: '域名', checked: true },
+      { id: 'zone_id', name: 'Zone ID' },
+      { id: 'status', name: '状态', checked: true },
+      { id: 'type', name: '接入方式' },
+      { id: 'plan', name: '套餐' },
+      { id: 'paused', name: '已暂停' },
+      { id: 'nameservers', name: 'NS 服务器', checked: true },
+      { id: 'original_registrar', name: '原注册商' },
+      { id: 'original_nameservers', name: '原 NS' },
+      { id: 'created_on', name: '添加时间', checked: true },
+      { id: 'dns_records', name: '解析数量' },
+      { id: 'proxied_records', name: '代理记录数' },
+      { id: 'proxied_ratio', name: '代理比例' },
+      { id: 'ssl_mode', name: 'SSL 模式' }
+    ];
+  }
+
+  static exportBody() {
+    return {
+      accountId: document.getElementById('export-account').value,
+      allAccounts: document.getElementById('export-all-accounts').checked
+    };
+  }
+
+  static async download(state, format) {
+    const body = this.exportBody();
+    body.columns = Array.from(document.querySelectorAll('.export-column:checked')).map(el => el.value);
+    if (body.columns.length === 0) return alert('请至少选择一列');
+
+    const btn = document.getElementById(`btn-export-${format}`);
+    const label = btn.innerHTML;
+    btn.disabled = true;
+    btn.innerHTML = '<span class="spinner-border spinner-border-sm"></span>';
+    try {
+      const res = await fetch(`/api/zones/export?format=${format}`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
+        body: JSON.stringify(body)
+      });
+      if (window.handleAuthError(res)) return;
+      if (!res.ok) {
+        const data = await res.json();
+        return alert(data.error);
+      }
+      const blob = await res.blob();
+      const url = URL.createObjectURL(blob);
+      const a = document.createElement('a');
+      a.href = url;
+      a.download = `cloudflare-zones-${new Date().getTime()}.${format}`;
+      document.body.appendChild(a);
+      a.click();
+      document.body.removeChild(a);
+      URL.revokeObjectURL(url);
+    } catch (e) {
+      console.error(e);
+      alert('导出请求发生错误');
+    } finally {
+      btn.disabled = false;
+      btn.innerHTML = label;
+    }
   }
 
   static async exportZones(state) {
-    const accountId = document.getElementById('export-account').value;
+    const body = this.exportBody();
 
-    if (!accountId) return alert('请选择操作账号');
+    if (!body.allAccounts && !body.accountId) return alert('请选择操作账号');
 
     const btn = document.getElementById('btn-export-zones');
     const resultsDiv = document.getElementById('export-results');
@@ -82,10 +175,14 @@ export class ExportZonesModule {
           'Content-Type': 'application/json', 
           'Authorization': state.token || localStorage.getItem('token') 
         },
-        body: JSON.stringify({ accountId })
+        body: JSON.stringify(body)
       });
 
       const data = await res.json();
+      if (!res.ok) {
+        resultsDiv.innerHTML = `<div class="alert alert-danger">${data.error}</div>`;
+        return;
+      }
 
       if (data.length === 0) {
         resultsDiv.innerHTML = '<div class="text-center py-6 text-muted">该账号下没有域名</div>';
@@ -103,11 +200,15 @@ export class ExportZonesModule {
           <tbody>
             ${data.map(z => `
               <tr class="bg-white">
-                <td><div class="fw-bold text-dark">${z.domain}</div></td>
+                <td>
+                  <div class="fw-bold text-dark">${z.domain}</div>
+                  ${body.allAccounts ? `<div class="small text-muted">${z.account}</div>` : ''}
+                  ${z.error ? `<div class="small text-danger">${z.error}</div>` : ''}
+                </td>
                 <td>
                   ${z.status === 'active' 
                     ? '<span class="badge bg-success-lt text-success">Active</span>' 
-                    : `<span class="badge bg-warning-lt text-warning">${z.status}</span>`
+                    : z.status ? `<span class="badge bg-warning-lt text-warning">${z.status}</span>` : '-'
                   }
                 </td>
                 <td>
@@ -139,7 +240,7 @@ export class ExportZonesModule {
   static copyZones() {
     if (!window.exportedZones || window.exportedZones.length === 0) return;
 
-    const text = window.exportedZones.map(z => z.domain).join('\n');
+    const text = window.exportedZones.filter(z => z.domain).map(z => z.domain).join('\n');
     
     navigator.clipboard.writeText(text).then(() => {
       alert(`已复制 ${window.exportedZones.length} 个域名到剪贴板`);
@@ -157,7 +258,7 @@ export class ExportZonesModule {
   static downloadTxt() {
     if (!window.exportedZones || window.exportedZones.length === 0) return;
 
-    const text = window.exportedZones.map(z => z.domain).join('\n');
+    const text = window.exportedZones.filter(z => z.domain).map(z => z.domain).join('\n');
     const blob = new Blob([text], { type: 'text/plain' });
     const url = URL.createObjectURL(blob);
     const a = document.createElement('a');
@@ -0,0 +1,165 @@
+export class InventoryModule {
+  static async render(container, state) {
+    container.innerHTML = `
+      <div class="page-header d-print-none mb-3">
+        <div class="row align-items-center">
+          <div class="col">
+            <div class="page-pretitle text-muted">Zone Management</div>
+            <h2 class="page-title fw-bold">域名索引 (Zone Inventory)</h2>
+          </div>
+          <div class="col-auto">
+            <button id="btn-inventory-refresh" class="btn btn-outline-primary">刷新全部账号</button>
+          </div>
+        </div>
+      </div>
+      <div class="card border-0 shadow-sm rounded-3 mb-3">
+        <div class="card-body">
+          <div class="row g-2">
+            <div class="col-md-6">
+              <input id="inventory-query" class="form-control border-2 shadow-none font-monospace" placeholder="域名关键字或通配符，如 *.example.com">
+            </div>
+            <div class="col-md-3">
+              <select id="inventory-account" class="form-select border-2 shadow-none"><option value="">全部账号</option></select>
+            </div>
+            <div class="col-md-2">
+              <select id="inventory-status" class="form-select border-2 shadow-none">
+                <option value="">全部状态</option>
+                <option value="active">active</option>
+                <option value="pending">pending</option>
+                <option value="moved">moved</option>
+              </select>
+            </div>
+            <div class="col-md-1">
+              <button id="btn-inventory-search" class="btn btn-primary w-100">搜索</button>
+            </div>
+          </div>
+        </div>
+      </div>
+      <div class="row row-cards">
+        <div class="col-md-4">
+          <div class="card border-0 shadow-sm rounded-3 h-100">
+            <div class="card-body">
+              <h3 class="card-title fw-bold border-bottom pb-2">账号刷新状态</h3>
+              <div id="inventory-accounts" class="mt-2">
+                <div class="text-center py-6 text-muted">加载中...</div>
+              </div>
+            </div>
+          </div>
+        </div>
+        <div class="col-md-8">
+          <div class="card border-0 shadow-sm rounded-3 h-100">
+            <div class="card-body">
+              <h3 class="card-title fw-bold border-bottom pb-2">域名 <span id="inventory-total" class="badge bg-blue-lt"></span></h3>
+              <div id="inventory-zones" class="table-responsive mt-2">
+                <div class="text-center py-6 text-muted">加载中...</div>
+              </div>
+            </div>
+          </div>
+        </div>
+      </div>
+    `;
+
+    this.accountsLoaded = false;
+    document.getElementById('btn-inventory-search').addEventListener('click', () => this.search(state));
+    document.getElementById('inventory-query').addEventListener('keydown', e => {
+      if (e.key === 'Enter') this.search(state);
+    });
+    document.getElementById('btn-inventory-refresh').addEventListener('click', () => this.refresh(state, ''));
+    await this.search(state);
+  }
+
+  static async search(state) {
+    const params = new URLSearchParams({
+      q: document.getElementById('inventory-query').value.trim(),
+      accountId: document.getElementById('inventory-account').value,
+      status: document.getElementById('inventory-status').value
+    });
+    const zonesDiv = document.getElementById('inventory-zones');
+    try {
+      const res = await fetch(`/api/inventory?${params}`, { headers: { 'Authorization': state.token || localStorage.getItem('token') } });
+      if (window.handleAuthError(res)) return;
+      const data = await res.json();
+      if (!res.ok) {
+        zonesDiv.innerHTML = `<div class="alert alert-danger">${data.error}</div>`;
+        return;
+      }
+      this.renderAccounts(state, data.accounts);
+      document.getElementById('inventory-total').textContent = data.total > data.zones.length ? `${data.zones.length} / ${data.total}` : data.total;
+      if (data.zones.length === 0) {
+        zonesDiv.innerHTML = '<div class="text-center py-6 text-muted">没有匹配的域名</div>';
+        return;
+      }
+      zonesDiv.innerHTML = `
+        <table class="table table-vcenter card-table table-hover">
+          <thead class="bg-light">
+            <tr><th>域名</th><th>账号</th><th>状态</th><th>套餐</th><th>NS</th></tr>
+          </thead>
+          <tbody>
+            ${data.zones.map(z => `
+              <tr class="bg-white">
+                <td><div class="fw-bold text-dark">${z.domain}</div><div class="small text-muted font-monospace">${z.zoneId}</div></td>
+                <td class="small">${z.account || z.accountId}</td>
+                <td><span class="badge ${z.status === 'active' ? 'bg-success-lt text-success' : 'bg-secondary-lt text-dark'}">${z.status || '-'}</span></td>
+                <td class="small">${z.plan || '-'}</td>
+                <td class="small font-monospace">${(z.nameServers || []).join('<br>') || '-'}</td>
+              </tr>
+            `).join('')}
+          </tbody>
+        </table>
+      `;
+    } catch (e) {
+      console.error(e);
+      zonesDiv.innerHTML = '<div class="text-center py-6 text-danger">加载失败</div>';
+    }
+  }
+
+  static renderAccounts(state, accounts) {
+    if (!this.accountsLoaded) {
+      document.getElementById('inventory-account').innerHTML = '<option value="">全部账号</option>' +
+        accounts.map(a => `<option value="${a.accountId}">${a.name}</option>`).join('');
+      this.accountsLoaded = true;
+    }
+
+    const accountsDiv = document.getElementById('inventory-accounts');
+    if (accounts.length === 0) {
+      accountsDiv.innerHTML = '<div class="text-center py-6 text-muted">暂无账号</div>';
+      return;
+    }
+    accountsDiv.innerHTML = accounts.map(a => `
+      <div class="border rounded p-2 mb-2 bg-white">
+        <div class="d-flex justify-content-between align-items-center">
+          <div class="fw-bold text-dark">${a.name}</div>
+          <button class="btn btn-sm btn-outline-secondary btn-inventory-account" data-id="${a.accountId}">刷新</button>
+        </div>
+        <div class="small text-muted">${a.zones} 个域名 · ${a.refreshedAt ? `更新于 ${new Date(a.refreshedAt).toLocaleString()}` : '尚未刷新'}</div>
+        ${a.error ? `<div class="small text-danger">${a.error}</div>` : ''}
+      </div>
+    `).join('');
+    accountsDiv.querySelectorAll('.btn-inventory-account').forEach(b => {
+      b.addEventListener('click', () => this.refresh(state, b.dataset.id));
+    });
+  }
+
+  static async refresh(state, accountId) {
+    const btn = document.getElementById('btn-inventory-refresh');
+    btn.disabled = true;
+    btn.innerHTML = '<span class="spinner-border spinner-border-sm me-2"></span>刷新中...';
+    try {
+      const res = await fetch('/api/inventory/refresh', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
+        body: JSON.stringify({ accountId })
+      });
+      if (window.handleAuthError(res)) return;
+      const data = await res.json();
+      if (!res.ok) return alert(data.error);
+      await this.search(state);
+    } catch (e) {
+      console.error(e);
+      alert('请求发生错误');
+    } finally {
+      btn.disabled = false;
+      btn.innerHTML = '刷新全部账号';
+    }
+  }
+}
@@ -0,0 +1,135 @@
+export class OnboardingModule {
+  static async render(container, state) {
+    container.innerHTML = `
+      <div class="page-header d-print-none mb-3">
+        <div class="row align-items-center">
+          <div class="col">
+            <div class="page-pretitle text-muted">Zone Management</div>
+            <h2 class="page-title fw-bold">域名接入跟踪 (Onboarding)</h2>
+          </div>
+          <div class="col-auto">
+            <button id="btn-check-onboarding" class="btn btn-primary fw-bold shadow-sm">立即检查</button>
+          </div>
+        </div>
+      </div>
+      <div class="row row-cards mb-3">
+        <div class="col-md-4">
+          <div class="card border-0 shadow-sm rounded-3"><div class="card-body">
+            <div class="text-muted small">等待修改 NS (pending)</div>
+            <div id="onboarding-pending" class="h1 fw-bold text-warning mb-0">-</div>
+          </div></div>
+        </div>
+        <div class="col-md-4">
+          <div class="card border-0 shadow-sm rounded-3"><div class="card-body">
+            <div class="text-muted small">NS 已生效 (delegated)</div>
+            <div id="onboarding-delegated" class="h1 fw-bold text-azure mb-0">-</div>
+          </div></div>
+        </div>
+        <div class="col-md-4">
+          <div class="card border-0 shadow-sm rounded-3"><div class="card-body">
+            <div class="text-muted small">已激活 (active)</div>
+            <div id="onboarding-active" class="h1 fw-bold text-success mb-0">-</div>
+          </div></div>
+        </div>
+      </div>
+      <div class="card border-0 shadow-sm rounded-3">
+        <div class="card-body">
+          <h3 class="card-title fw-bold border-bottom pb-2">域名列表</h3>
+          <div id="onboarding-results" class="table-responsive mt-2">
+            <div class="text-center py-6 text-muted">加载中...</div>
+          </div>
+        </div>
+      </div>
+    `;
+
+    document.getElementById('btn-check-onboarding').addEventListener('click', () => this.check(state));
+    await this.load(state);
+  }
+
+  static async load(state) {
+    const resultsDiv = document.getElementById('onboarding-results');
+    try {
+      const res = await fetch('/api/onboarding', { headers: { 'Authorization': state.token || localStorage.getItem('token') } });
+      if (window.handleAuthError(res)) return;
+      const data = await res.json();
+
+      document.getElementById('onboarding-pending').textContent = data.pending;
+      document.getElementById('onboarding-delegated').textContent = data.delegated;
+      document.getElementById('onboarding-active').textContent = data.active;
+
+      if (!data.zones || data.zones.length === 0) {
+        resultsDiv.innerHTML = '<div class="text-center py-6 text-muted">暂无跟踪中的域名，通过批量增域添加的域名会自动加入</div>';
+        return;
+      }
+
+      resultsDiv.innerHTML = `
+        <table class="table table-vcenter card-table table-hover">
+          <thead class="bg-light">
+            <tr><th>域名</th><th>状态</th><th>分配的 NS</th><th>当前 NS</th><th>等待时间</th></tr>
+          </thead>
+          <tbody>
+            ${data.zones.map(z => `
+              <tr class="bg-white">
+                <td>
+                  <div class="fw-bold text-dark">${z.domain}</div>
+                  ${z.lastError ? `<div class="small text-danger">${z.lastError}</div>` : ''}
+                </td>
+                <td>${this.statusBadge(z.status)}</td>
+                <td>${this.nameServers(z.assignedNameServers)}</td>
+                <td>${this.nameServers(z.currentNameServers)}</td>
+                <td class="text-muted small">${this.duration(z.waitingSeconds)}</td>
+              </tr>
+            `).join('')}
+          </tbody>
+        </table>
+      `;
+    } catch (e) {
+      console.error(e);
+      resultsDiv.innerHTML = '<div class="text-center py-6 text-danger">加载失败</div>';
+    }
+  }
+
+  static async check(state) {
+    const btn = document.getElementById('btn-check-onboarding');
+    btn.disabled = true;
+    btn.innerHTML = '<span class="spinner-border spinner-border-sm me-2"></span>正在检查...';
+    try {
+      const res = await fetch('/api/onboarding/check', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+          'Authorization': state.token || localStorage.getItem('token')
+        },
+        body: JSON.stringify({})
+      });
+      if (window.handleAuthError(res)) return;
+      await this.load(state);
+    } catch (e) {
+      console.error(e);
+      alert('检查请求发生错误');
+    } finally {
+      btn.disabled = false;
+      btn.innerHTML = '立即检查';
+    }
+  }
+
+  static statusBadge(status) {
+    if (status === 'active') return '<span class="badge bg-success-lt text-success">Active</span>';
+    if (status === 'delegated') return '<span class="badge bg-azure-lt text-azure">Delegated</span>';
+    return '<span class="badge bg-warning-lt text-warning">Pending</span>';
+  }
+
+  static nameServers(list) {
+    if (!list || list.length === 0) return '<span class="text-muted small">-</span>';
+    return list.map(ns => `<div class="small text-muted font-monospace">${ns}</div>`).join('');
+  }
+
+  static duration(seconds) {
+    const days = Math.floor(seconds / 86400);
+    const hours = Math.floor((seconds % 86400) / 3600);
+    const minutes = Math.floor((seconds % 3600) / 60);
+    if (days > 0) return `${days} 天 ${hours} 小时`;
+    if (hours > 0) return `${hours} 小时 ${minutes} 分钟`;
+    return `${minutes} 分钟`;
+  }
+}
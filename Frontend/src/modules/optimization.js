@@ -198,7 +198,8 @@ export class OptimizationModule {
       return alert('请至少选择一项要修改的设置');
     }
 
-    const domains = domainsText.split('\n').map(d => d.trim()).filter(d => d.length > 0);
+    const domains = await window.checkDomains(domainsText);
+    if (!domains) return;
     if (domains.length === 0) return alert('域名列表为空');
 
     const btn = document.getElementById('btn-apply-opt');
@@ -219,7 +220,7 @@ export class OptimizationModule {
     `;
 
     try {
-      const res = await fetch('/api/optimization/batch-settings', {
+      const res = await window.fetchBatch('/api/optimization/batch-settings', {
         method: 'POST',
         headers: { 
           'Content-Type': 'application/json', 
@@ -95,7 +95,8 @@ export class ProxyToggleModule {
     if (!accountId) return alert('请选择操作账号');
     if (!domainsText.trim()) return alert('请输入域名列表');
 
-    const domains = domainsText.split('\n').map(d => d.trim()).filter(d => d.length > 0);
+    const domains = await window.checkDomains(domainsText, true);
+    if (!domains) return;
     if (domains.length === 0) return alert('域名列表为空');
 
     const btn = document.getElementById('btn-start-toggle');
@@ -116,7 +117,7 @@ export class ProxyToggleModule {
     `;
 
     try {
-      const res = await fetch('/api/dns/proxy-toggle', {
+      const res = await window.fetchBatch('/api/dns/proxy-toggle', {
         method: 'POST',
         headers: { 
           'Content-Type': 'application/json', 
@@ -116,7 +116,8 @@ export class SSLSettingsModule {
       return alert('请至少选择一项要修改的设置');
     }
 
-    const domains = domainsText.split('\n').map(d => d.trim()).filter(d => d.length > 0);
+    const domains = await window.checkDomains(domainsText);
+    if (!domains) return;
     if (domains.length === 0) return alert('域名列表为空');
 
     const btn = document.getElementById('btn-apply-ssl');
@@ -137,7 +138,7 @@ export class SSLSettingsModule {
     `;
 
     try {
-      const res = await fetch('/api/ssl/batch-settings', {
+      const res = await window.fetchBatch('/api/ssl/batch-settings', {
         method: 'POST',
         headers: { 
           'Content-Type': 'application/json', 
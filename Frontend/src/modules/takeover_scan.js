@@ -0,0 +1,170 @@
+export class TakeoverScanModule {
+  static async render(container, state) {
+    const res = await fetch('/api/accounts', { headers: { 'Authorization': state.token || localStorage.getItem('token') } });
+    if (!res.ok) {
+      window.logout();
+      return;
+    }
+    const accounts = await res.json();
+
+    container.innerHTML = `
+      <div class="page-header d-print-none mb-3">
+        <div class="row align-items-center">
+          <div class="col">
+            <div class="page-pretitle text-muted">DNS Management</div>
+            <h2 class="page-title fw-bold">悬挂解析扫描 (Dangling DNS Scan)</h2>
+          </div>
+        </div>
+      </div>
+      <div class="row row-cards">
+        <div class="col-md-4">
+          <div class="card border-0 shadow-sm rounded-3 h-100">
+            <div class="card-body">
+              <h3 class="card-title fw-bold border-bottom pb-2">操作配置</h3>
+              <div class="mb-3">
+                <label class="form-label fw-bold">选择 Cloudflare 账号</label>
+                <select id="tko-account" class="form-select border-2 shadow-none">
+                  ${(accounts || []).map(a => `<option value="${a.id}">${a.name} (${a.email})</option>`).join('')}
+                </select>
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">域名 <span class="badge bg-blue-lt">每行一个，留空扫描全部</span></label>
+                <textarea id="tko-domains" class="form-control border-2 shadow-none font-monospace" rows="6" placeholder="example.com"></textarea>
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">DNS 服务器</label>
+                <input id="tko-resolver" class="form-control border-2 shadow-none" placeholder="默认使用配置中的第一个公共 DNS">
+              </div>
+              <div class="form-check form-switch mb-3">
+                <input class="form-check-input" type="checkbox" id="tko-probe">
+                <label class="form-check-label" for="tko-probe">访问网页确认服务商的未认领页面</label>
+              </div>
+              <button id="btn-tko-scan" class="btn btn-primary w-100 py-2 fw-bold shadow-sm">开始扫描</button>
+              <button id="btn-tko-export" class="btn btn-outline-secondary w-100 mt-2" style="display: none;">导出 CSV</button>
+            </div>
+          </div>
+        </div>
+        <div class="col-md-8">
+          <div class="card border-0 shadow-sm rounded-3 h-100">
+            <div class="card-body">
+              <h3 class="card-title fw-bold border-bottom pb-2">扫描结果</h3>
+              <div id="tko-results" class="table-responsive mt-2">
+                <div class="text-center py-6 text-muted">选择账号后点击开始扫描</div>
+              </div>
+            </div>
+          </div>
+        </div>
+      </div>
+    `;
+
+    document.getElementById('btn-tko-scan').addEventListener('click', () => this.scan(state));
+    document.getElementById('btn-tko-export').addEventListener('click', () => this.exportCSV());
+  }
+
+  static async scan(state) {
+    const accountId = document.getElementById('tko-account').value;
+    if (!accountId) return alert('请选择操作账号');
+    const domains = document.getElementById('tko-domains').value.split('\n').map(d => d.trim()).filter(d => d);
+
+    const btn = document.getElementById('btn-tko-scan');
+    const resultsDiv = document.getElementById('tko-results');
+    btn.disabled = true;
+    btn.innerHTML = '<span class="spinner-border spinner-border-sm me-2"></span>正在扫描...';
+
+    try {
+      const res = await fetch('/api/dns/takeover/scan', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
+        body: JSON.stringify({
+          accountId,
+          domains,
+          resolver: document.getElementById('tko-resolver').value.trim(),
+          probeHttp: document.getElementById('tko-probe').checked
+        })
+      });
+      if (window.handleAuthError(res)) return;
+      const data = await res.json();
+      if (!res.ok) {
+        resultsDiv.innerHTML = `<div class="alert alert-danger">${data.error}</div>`;
+        return;
+      }
+
+      this.accountId = accountId;
+      this.findings = data.flatMap(r => r.findings);
+      const failed = data.filter(r => !r.success);
+      const scanned = data.reduce((n, r) => n + r.scanned, 0);
+      document.getElementById('btn-tko-export').style.display = this.findings.length ? 'block' : 'none';
+
+      resultsDiv.innerHTML = `
+        <div class="mb-2 text-muted small">扫描 ${data.length} 个域名 ${scanned} 条记录，发现 ${this.findings.length} 个问题</div>
+        ${failed.map(r => `<div class="alert alert-warning py-2">${r.domain}: ${r.message}</div>`).join('')}
+        ${this.findings.length === 0 ? '<div class="text-center py-6 text-muted">没有发现问题</div>' : `
+        <table class="table table-vcenter card-table table-hover">
+          <thead class="bg-light">
+            <tr><th>级别</th><th>记录</th><th>记录值</th><th>说明</th><th></th></tr>
+          </thead>
+          <tbody>
+            ${this.findings.map((f, i) => `
+              <tr class="bg-white" id="tko-row-${i}">
+                <td>${this.severityBadge(f.severity)}</td>
+                <td><div class="fw-bold text-dark">${f.name}</div><div class="small text-muted">${f.type}</div></td>
+                <td class="small font-monospace text-break">${f.content}</td>
+                <td class="small">${f.provider ? `<span class="badge bg-azure-lt text-azure me-1">${f.provider}</span>` : ''}${f.detail}</td>
+                <td><button class="btn btn-sm btn-outline-danger btn-tko-delete" data-idx="${i}">删除</button></td>
+              </tr>
+            `).join('')}
+          </tbody>
+        </table>`}
+      `;
+
+      resultsDiv.querySelectorAll('.btn-tko-delete').forEach(b => {
+        b.addEventListener('click', () => this.deleteRecord(state, parseInt(b.dataset.idx)));
+      });
+    } catch (e) {
+      console.error(e);
+      alert('扫描请求发生错误');
+    } finally {
+      btn.disabled = false;
+      btn.innerHTML = '开始扫描';
+    }
+  }
+
+  static async deleteRecord(state, idx) {
+    const f = this.findings[idx];
+    if (!confirm(`确定要删除 ${f.type} ${f.name} -> ${f.content} 吗？`)) return;
+
+    const res = await window.fetchBatch('/api/dns/batch-delete', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
+      body: JSON.stringify({ accountId: this.accountId, domains: [f.domain], recordType: f.type, hostRecord: f.name, recordIds: [f.recordId] })
+    });
+    if (window.handleAuthError(res)) return;
+    const data = await res.json();
+    const result = Array.isArray(data) ? data[0] : data;
+    if (!res.ok || !result.success) return alert(result.error || result.message);
+    document.getElementById(`tko-row-${idx}`).classList.add('text-decoration-line-through', 'opacity-50');
+  }
+
+  static severityBadge(severity) {
+    if (severity === 'high') return '<span class="badge bg-danger-lt text-danger">高</span>';
+    if (severity === 'medium') return '<span class="badge bg-warning-lt text-warning">中</span>';
+    return '<span class="badge bg-secondary-lt text-secondary">低</span>';
+  }
+
+  static exportCSV() {
+    if (!this.findings || this.findings.length === 0) return;
+
+    const quote = v => `"${String(v ?? '').replace(/"/g, '""')}"`;
+    const columns = ['domain', 'name', 'type', 'content', 'proxied', 'kind', 'severity', 'provider', 'detail', 'recordId'];
+    const text = [columns.join(',')].concat(this.findings.map(f => columns.map(c => quote(f[c])).join(','))).join('\n');
+    const blob = new Blob([text], { type: 'text/csv' });
+    const url = URL.createObjectURL(blob);
+    const a = document.createElement('a');
+    a.href = url;
+    a.download = `takeover-scan-${new Date().getTime()}.csv`;
+    document.body.appendChild(a);
+    a.click();
+    document.body.removeChild(a);
+    URL.revokeObjectURL(url);
+  }
+}
@@ -0,0 +1,209 @@
+export class ZoneMigrateModule {
+  static async render(container, state) {
+    const res = await fetch('/api/accounts', { headers: { 'Authorization': state.token || localStorage.getItem('token') } });
+    if (!res.ok) {
+      window.logout();
+      return;
+    }
+    const accounts = await res.json();
+    const accountOptions = (accounts || []).map(a => `<option value="${a.id}">${a.name} (${a.email})</option>`).join('');
+
+    container.innerHTML = `
+      <div class="page-header d-print-none mb-3">
+        <div class="row align-items-center">
+          <div class="col">
+            <div class="page-pretitle text-muted">Zone Management</div>
+            <h2 class="page-title fw-bold">跨账号迁移 (Zone Migration)</h2>
+          </div>
+        </div>
+      </div>
+      <div class="row row-cards mb-3">
+        <div class="col-md-5">
+          <div class="card border-0 shadow-sm rounded-3 h-100">
+            <div class="card-body">
+              <h3 class="card-title fw-bold border-bottom pb-2">操作配置</h3>
+              <div class="mb-3">
+                <label class="form-label fw-bold">源账号</label>
+                <select id="migrate-source-account" class="form-select border-2 shadow-none">${accountOptions}</select>
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">目标账号</label>
+                <select id="migrate-account" class="form-select border-2 shadow-none">${accountOptions}</select>
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">域名 <span class="badge bg-blue-lt">每行一个</span></label>
+                <textarea id="migrate-domains" class="form-control border-2 shadow-none font-monospace" rows="5" placeholder="example.com"></textarea>
+              </div>
+              <div class="mb-3">
+                <label class="form-label fw-bold">同时迁移的规则</label>
+                <label class="form-check"><input class="form-check-input migrate-rule" type="checkbox" value="page_rules" checked><span class="form-check-label">页面规则</span></label>
+                <label class="form-check"><input class="form-check-input migrate-rule" type="checkbox" value="firewall_rules" checked><span class="form-check-label">防火墙规则</span></label>
+                <label class="form-check"><input class="form-check-input migrate-rule" type="checkbox" value="rate_limiting" checked><span class="form-check-label">速率限制</span></label>
+              </div>
+              <div class="row g-2">
+                <div class="col"><button id="btn-migrate-preview" class="btn btn-outline-secondary w-100">预览</button></div>
+                <div class="col"><button id="btn-migrate" class="btn btn-primary w-100 fw-bold">开始迁移</button></div>
+              </div>
+              <div class="small text-muted mt-2">迁移后源账号中的域名会保留，在注册商处把 NS 改为新的 NS 并确认后再删除</div>
+            </div>
+          </div>
+        </div>
+        <div class="col-md-7">
+          <div class="card border-0 shadow-sm rounded-3 h-100">
+            <div class="card-body">
+              <h3 class="card-title fw-bold border-bottom pb-2">执行结果</h3>
+              <div id="migrate-results" class="mt-2">
+                <div class="text-center py-6 text-muted">选择账号并填写域名后点击预览</div>
+              </div>
+            </div>
+          </div>
+        </div>
+      </div>
+      <div class="card border-0 shadow-sm rounded-3">
+        <div class="card-body">
+          <h3 class="card-title fw-bold border-bottom pb-2">迁移记录</h3>
+          <div id="migrate-list" class="table-responsive mt-2">
+            <div class="text-center py-6 text-muted">加载中...</div>
+          </div>
+        </div>
+      </div>
+    `;
+
+    this.accounts = accounts || [];
+    document.getElementById('btn-migrate-preview').addEventListener('click', () => this.migrate(state, true));
+    document.getElementById('btn-migrate').addEventListener('click', () => this.migrate(state, false));
+    await this.load(state);
+  }
+
+  static async migrate(state, dryRun) {
+    const body = {
+      sourceAccountId: document.getElementById('migrate-source-account').value,
+      accountId: document.getElementById('migrate-account').value,
+      domains: document.getElementById('migrate-domains').value.split('\n').map(d => d.trim()).filter(d => d),
+      ruleTypes: Array.from(document.querySelectorAll('.migrate-rule:checked')).map(el => el.value),
+      dryRun
+    };
+    if (body.sourceAccountId === body.accountId) return alert('源账号和目标账号不能相同');
+    if (body.domains.length === 0) return alert('请输入域名');
+    if (body.ruleTypes.length === 0) return alert('请至少选择一种规则');
+    if (!dryRun && !confirm(`确定要把 ${body.domains.length} 个域名迁移到目标账号吗？`)) return;
+
+    const resultsDiv = document.getElementById('migrate-results');
+    resultsDiv.innerHTML = '<div class="text-center py-6"><span class="spinner-border spinner-border-sm me-2"></span>处理中...</div>';
+    try {
+      const res = await window.fetchBatch('/api/zones/migrate', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
+        body: JSON.stringify(body)
+      });
+      if (window.handleAuthError(res)) return;
+      const data = await res.json();
+      if (!res.ok) {
+        resultsDiv.innerHTML = `<div class="alert alert-danger">${data.error}</div>`;
+        return;
+      }
+      resultsDiv.innerHTML = data.map(r => `
+        <div class="border rounded p-3 mb-2 bg-white">
+          <div class="d-flex justify-content-between">
+            <div class="fw-bold text-dark">${r.domain}</div>
+            <span class="badge ${r.success ? 'bg-success-lt text-success' : 'bg-danger-lt text-danger'}">${r.success ? '成功' : '失败'}</span>
+          </div>
+          <div class="small text-muted mt-1">${r.message}</div>
+          <div class="small text-muted">解析 ${r.records} / 设置 ${r.settings} / 规则 ${r.rules}</div>
+          ${r.nameServers ? `<div class="mt-2"><span class="small text-muted">新的 NS:</span> ${r.nameServers.map(ns => `<code>${ns}</code>`).join(' ')}</div>` : ''}
+          ${r.steps ? `<pre class="small mt-2 mb-0">${r.steps.join('\n')}</pre>` : ''}
+          ${r.plan ? `<pre class="small mt-2 mb-0">${r.plan.join('\n')}</pre>` : ''}
+        </div>
+      `).join('');
+      if (!dryRun) await this.load(state);
+    } catch (e) {
+      console.error(e);
+      resultsDiv.innerHTML = '<div class="text-center py-6 text-danger">请求发生错误</div>';
+    }
+  }
+
+  static async load(state) {
+    const listDiv = document.getElementById('migrate-list');
+    try {
+      const res = await fetch('/api/zones/migrations', { headers: { 'Authorization': state.token || localStorage.getItem('token') } });
+      if (window.handleAuthError(res)) return;
+      const data = await res.json();
+      if (!res.ok) {
+        listDiv.innerHTML = `<div class="alert alert-danger">${data.error}</div>`;
+        return;
+      }
+      if (data.length === 0) {
+        listDiv.innerHTML = '<div class="text-center py-6 text-muted">暂无迁移记录</div>';
+        return;
+      }
+
+      listDiv.innerHTML = `
+        <table class="table table-vcenter card-table table-hover">
+          <thead class="bg-light">
+            <tr><th>域名</th><th>源账号</th><th>目标账号</th><th>新的 NS</th><th>状态</th><th></th></tr>
+          </thead>
+          <tbody>
+            ${data.map(m => `
+              <tr class="bg-white">
+                <td>
+                  <div class="fw-bold text-dark">${m.domain}</div>
+                  <div class="small text-muted">${new Date(m.createdAt).toLocaleString()}</div>
+                  ${m.error ? `<div class="small text-danger">${m.error}</div>` : ''}
+                </td>
+                <td class="small">${this.accountName(m.sourceAccountId)}</td>
+                <td class="small">${this.accountName(m.targetAccountId)}</td>
+                <td class="small font-monospace">${(m.nameServers || []).join('<br>') || '-'}</td>
+                <td>${this.statusBadge(m.status)}</td>
+                <td>${m.status === 'restored' ? `<button class="btn btn-sm btn-outline-danger btn-migrate-complete" data-id="${m.id}" data-domain="${m.domain}">删除源域名</button>` : ''}</td>
+              </tr>
+            `).join('')}
+          </tbody>
+        </table>
+      `;
+
+      listDiv.querySelectorAll('.btn-migrate-complete').forEach(b => {
+        b.addEventListener('click', () => this.complete(state, b.dataset.id, b.dataset.domain));
+      });
+    } catch (e) {
+      console.error(e);
+      listDiv.innerHTML = '<div class="text-center py-6 text-danger">加载失败</div>';
+    }
+  }
+
+  static async complete(state, id, domain) {
+    const confirmText = prompt(`删除源账号中的 ${domain} 后无法恢复。请输入域名确认:`);
+    if (confirmText === null) return;
+
+    let res = await this.sendComplete(state, id, { confirm: confirmText });
+    if (!res) return;
+    let data = await res.json();
+    if (res.status === 409 && data.error.startsWith('Target zone') && confirm(`${data.error}\n\n仍然删除源域名吗？`)) {
+      res = await this.sendComplete(state, id, { confirm: confirmText, force: true });
+      if (!res) return;
+      data = await res.json();
+    }
+    if (!res.ok) return alert(data.error);
+    await this.load(state);
+  }
+
+  static async sendComplete(state, id, body) {
+    const res = await fetch(`/api/zones/migrations/${id}/complete`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', 'Authorization': state.token || localStorage.getItem('token') },
+      body: JSON.stringify(body)
+    });
+    if (window.handleAuthError(res)) return null;
+    return res;
+  }
+
+  static accountName(id) {
+    const acc = this.accounts.find(a => a.id === id);
+    return acc ? acc.name : id;
+  }
+
+  static statusBadge(status) {
+    if (status === 'completed') return '<span class="badge bg-success-lt text-success">已完成</span>';
+    if (status === 'restored') return '<span class="badge bg-azure-lt text-azure">待确认</span>';
+    return '<span class="badge bg-danger-lt text-danger">失败</span>';
+  }
+}
@@ -0,0 +1,245 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const DefaultPath = "logs/audit.jsonl"
+
+// Entry records one batch operation: who ran it, against which account, with
+// what payload, and the result row of every domain it touched.
+type Entry struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	IP        string    `json:"ip"`
+	Endpoint  string    `json:"endpoint"`
+	Action    string    `json:"action"`
+	AccountID string    `json:"accountId"`
+	// Accounts lists the accounts of a batch routed by domain, which has
+	// no single AccountID
+	Accounts []string      `json:"accounts,omitempty"`
+	DryRun   bool          `json:"dryRun,omitempty"`
+	Payload  interface{}   `json:"payload,omitempty"`
+	Domains  []string      `json:"domains,omitempty"`
+	Results  []interface{} `json:"results"`
+}
+
+// Filter selects entries in Query. Zero values match everything.
+type Filter struct {
+	From      time.Time
+	To        time.Time
+	Domain    string
+	AccountID string
+	Action    string
+	User      string
+	Limit     int
+}
+
+var (
+	path = DefaultPath
+	mu   sync.Mutex
+)
+
+func SetPath(p string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if p == "" {
+		p = DefaultPath
+	}
+	path = p
+}
+
+// Record appends entry to the log. The log is append-only; entries are never
+// rewritten.
+func Record(entry Entry) error {
+	if entry.ID == "" {
+		entry.ID = uuid.New().String()
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.Domains == nil {
+		entry.Domains = resultDomains(entry.Results)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Query returns the entries matching filter, newest first.
+func Query(filter Filter) ([]Entry, error) {
+	// hold the lock while reading so a concurrent Record can't leave us a
+	// half-written last line
+	mu.Lock()
+	defer mu.Unlock()
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Entry{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	// a damaged line (a crash mid-write, a manual edit) is skipped so the rest
+	// of the log stays readable
+	var matched []Entry
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var entry Entry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				log.Printf("Warning: Skipping audit log line %d: %v", n, err)
+			} else if filter.matches(&entry) {
+				matched = append(matched, entry)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make([]Entry, 0, len(matched))
+	for i := len(matched) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(entries) >= filter.Limit {
+			break
+		}
+		entries = append(entries, matched[i])
+	}
+	return entries, nil
+}
+
+func (f *Filter) matches(entry *Entry) bool {
+	if !f.From.IsZero() && entry.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && entry.Time.After(f.To) {
+		return false
+	}
+	if f.AccountID != "" && entry.AccountID != f.AccountID && !contains(entry.Accounts, f.AccountID) {
+		return false
+	}
+	if f.User != "" && entry.User != f.User {
+		return false
+	}
+	// "dns" matches every dns.* action, "dns.proxy-toggle" only itself
+	if f.Action != "" && entry.Action != f.Action && !strings.HasPrefix(entry.Action, f.Action+".") {
+		return false
+	}
+	if f.Domain != "" {
+		found := false
+		for _, d := range entry.Domains {
+			if strings.EqualFold(d, f.Domain) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// resultDomains collects the distinct "domain" fields of the result rows.
+func resultDomains(results []interface{}) []string {
+	seen := make(map[string]bool)
+	var domains []string
+	for _, r := range results {
+		data, err := json.Marshal(r)
+		if err != nil {
+			continue
+		}
+		var row struct {
+			Domain string `json:"domain"`
+		}
+		if json.Unmarshal(data, &row) != nil || row.Domain == "" || seen[row.Domain] {
+			continue
+		}
+		seen[row.Domain] = true
+		domains = append(domains, row.Domain)
+	}
+	return domains
+}
+
+// Sanitize converts a request payload to plain JSON values and masks every
+// field whose name suggests a credential.
+func Sanitize(payload interface{}) interface{} {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil
+	}
+	return redact(v)
+}
+
+func redact(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if sensitiveKey(k) {
+				t[k] = "****"
+				continue
+			}
+			t[k] = redact(val)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = redact(val)
+		}
+	}
+	return v
+}
+
+func sensitiveKey(key string) bool {
+	k := strings.ToLower(key)
+	for _, s := range []string{"key", "token", "password", "secret"} {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+package cfapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBaseURL = "https://api.cloudflare.com/client/v4"
+	DefaultTimeout = 30 * time.Second
+
+	maxRetryDelay = 30 * time.Second
+)
+
+type Client struct {
+	BaseURL    string
+	Email      string
+	Key        string
+	Token      string
+	HTTPClient *http.Client
+
+	// Limiter, when set, throttles requests to the account's API quota.
+	Limiter *Limiter
+	// MaxRetries is how often 429 and 5xx responses are retried.
+	MaxRetries int
+	// Stats, when set, records retries for reporting back to the caller.
+	Stats *Stats
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type ResultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+	TotalPages int `json:"total_pages"`
+}
+
+// Response is the standard v4 envelope wrapped around every API result.
+type Response struct {
+	Success    bool            `json:"success"`
+	Errors     []Error         `json:"errors"`
+	Messages   []Error         `json:"messages"`
+	Result     json.RawMessage `json:"result"`
+	ResultInfo ResultInfo      `json:"result_info"`
+}
+
+// APIError is returned when Cloudflare answers with a non-2xx status or an
+// envelope whose success flag is false.
+type APIError struct {
+	StatusCode int
+	Errors     []Error
+}
+
+func (e *APIError) Error() string {
+	if len(e.Errors) > 0 {
+		return e.Errors[0].Message
+	}
+	if e.StatusCode == http.StatusForbidden {
+		return "Auth failed (403)"
+	}
+	return fmt.Sprintf("HTTP %d", e.StatusCode)
+}
+
+// RequestError is returned when the request never produced an HTTP response.
+type RequestError struct {
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return "Request failed"
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// NewClient authenticates with a Global API Key via X-Auth-Email/X-Auth-Key.
+func NewClient(email, key string) *Client {
+	return &Client{
+		BaseURL:    DefaultBaseURL,
+		Email:      email,
+		Key:        key,
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// NewTokenClient authenticates with a scoped API Token sent as a Bearer token.
+func NewTokenClient(token string) *Client {
+	return &Client{
+		BaseURL:    DefaultBaseURL,
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// Do sends a request to path (relative to BaseURL) and decodes the envelope.
+// When out is non-nil the envelope's result is unmarshalled into it.
+func (c *Client) Do(method, path string, query url.Values, body interface{}, out interface{}) (*Response, error) {
+	endpoint := strings.TrimRight(c.BaseURL, "/") + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var payload []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = data
+	}
+
+	var (
+		status int
+		data   []byte
+	)
+	for attempt := 0; ; attempt++ {
+		var header http.Header
+		var err error
+		status, header, data, err = c.send(method, endpoint, payload)
+		if err != nil {
+			if !notSent(err) || attempt >= c.MaxRetries {
+				return nil, err
+			}
+			c.Stats.addRetry()
+			time.Sleep(retryDelay(nil, attempt))
+			continue
+		}
+		if !retryable(method, status) || attempt >= c.MaxRetries {
+			break
+		}
+		c.Stats.addRetry()
+		time.Sleep(retryDelay(header, attempt))
+	}
+
+	var envelope Response
+	decodeErr := json.Unmarshal(data, &envelope)
+
+	if status < 200 || status > 299 {
+		return &envelope, &APIError{StatusCode: status, Errors: envelope.Errors}
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("invalid response: %v", decodeErr)
+	}
+	if !envelope.Success {
+		return &envelope, &APIError{StatusCode: status, Errors: envelope.Errors}
+	}
+
+	if out != nil && len(envelope.Result) > 0 {
+		if err := json.Unmarshal(envelope.Result, out); err != nil {
+			return &envelope, fmt.Errorf("invalid result: %v", err)
+		}
+	}
+	return &envelope, nil
+}
+
+func (c *Client) send(method, endpoint string, payload []byte) (int, http.Header, []byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else {
+		req.Header.Set("X-Auth-Email", c.Email)
+		req.Header.Set("X-Auth-Key", c.Key)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.Limiter != nil {
+		release := c.Limiter.Acquire()
+		defer release()
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return 0, nil, nil, &RequestError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, &RequestError{Err: err}
+	}
+	return resp.StatusCode, resp.Header, data, nil
+}
+
+// retryable reports whether a response is worth sending again. A POST that
+// failed with a 5xx may still have created what it asked for, so POSTs are
+// only retried on 429, which Cloudflare answers before doing anything.
+func retryable(method string, status int) bool {
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	return status >= 500 && method != http.MethodPost
+}
+
+// notSent reports whether err happened while connecting, before the request
+// reached Cloudflare, so that any method can safely be sent again.
+func notSent(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "dial"
+}
+
+// retryDelay honours Retry-After when Cloudflare sends it and otherwise backs
+// off exponentially from one second. Either way a single wait is capped at
+// maxRetryDelay so a bad header can't stall a batch.
+func retryDelay(header http.Header, attempt int) time.Duration {
+	if v := header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return time.Duration(min(secs, int(maxRetryDelay/time.Second))) * time.Second
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			if d := time.Until(at); d > 0 {
+				return min(d, maxRetryDelay)
+			}
+		}
+	}
+	delay := min(time.Second<<attempt, maxRetryDelay)
+	return min(delay+time.Duration(rand.Int63n(int64(delay/4)+1)), maxRetryDelay)
+}
+
+func (c *Client) Get(path string, query url.Values, out interface{}) (*Response, error) {
+	return c.Do(http.MethodGet, path, query, nil, out)
+}
+
+func (c *Client) Post(path string, body interface{}, out interface{}) (*Response, error) {
+	return c.Do(http.MethodPost, path, nil, body, out)
+}
+
+func (c *Client) Put(path string, body interface{}, out interface{}) (*Response, error) {
+	return c.Do(http.MethodPut, path, nil, body, out)
+}
+
+func (c *Client) Patch(path string, body interface{}, out interface{}) (*Response, error) {
+	return c.Do(http.MethodPatch, path, nil, body, out)
+}
+
+func (c *Client) Delete(path string, out interface{}) (*Response, error) {
+	return c.Do(http.MethodDelete, path, nil, nil, out)
+}
+
+// GetAll walks every page of a paginated list endpoint and collects the results.
+func GetAll[T any](c *Client, path string, query url.Values, perPage int) ([]T, error) {
+	var all []T
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("per_page", fmt.Sprint(perPage))
+
+	for page := 1; ; page++ {
+		q.Set("page", fmt.Sprint(page))
+		var items []T
+		resp, err := c.Get(path, q, &items)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if page >= resp.ResultInfo.TotalPages || len(items) == 0 {
+			break
+		}
+	}
+	return all, nil
+}
@@ -0,0 +1,119 @@
+package cfapi
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Cloudflare allows 1200 requests per 5 minutes per user.
+	DefaultRateLimit      = 1200
+	DefaultRateWindow     = 5 * time.Minute
+	DefaultMaxConcurrency = 8
+	DefaultMaxRetries     = 4
+)
+
+// Limiter throttles the requests made with one set of credentials: a token
+// bucket matched to the API quota plus a cap on in-flight requests.
+type Limiter struct {
+	mu       sync.Mutex
+	tokens   float64
+	burst    float64
+	perSec   float64
+	lastFill time.Time
+	slots    chan struct{}
+}
+
+func NewLimiter(requests int, window time.Duration, concurrency int) *Limiter {
+	if requests <= 0 {
+		requests = DefaultRateLimit
+	}
+	if window <= 0 {
+		window = DefaultRateWindow
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultMaxConcurrency
+	}
+	// Keep the burst small so a large batch spreads over the window instead
+	// of spending the whole quota in the first seconds.
+	burst := float64(requests) / 20
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		tokens:   burst,
+		burst:    burst,
+		perSec:   float64(requests) / window.Seconds(),
+		lastFill: time.Now(),
+		slots:    make(chan struct{}, concurrency),
+	}
+}
+
+// Acquire blocks until a request may be sent. The returned func releases the
+// concurrency slot and must be called once the response has been read.
+func (l *Limiter) Acquire() func() {
+	l.slots <- struct{}{}
+	for {
+		wait := l.take()
+		if wait == 0 {
+			break
+		}
+		time.Sleep(wait)
+	}
+	return func() { <-l.slots }
+}
+
+func (l *Limiter) take() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.lastFill).Seconds() * l.perSec
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.lastFill = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.perSec * float64(time.Second))
+}
+
+var (
+	limiters   = make(map[string]*Limiter)
+	limitersMu sync.Mutex
+)
+
+// LimiterFor returns the shared limiter for key, creating it on first use so
+// every client built for the same account draws from the same quota.
+func LimiterFor(key string, requests int, concurrency int) *Limiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	if l, ok := limiters[key]; ok {
+		return l
+	}
+	l := NewLimiter(requests, DefaultRateWindow, concurrency)
+	limiters[key] = l
+	return l
+}
+
+// Stats counts throttling seen by the clients that share it.
+type Stats struct {
+	retries int64
+}
+
+func (s *Stats) Retries() int {
+	if s == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(&s.retries))
+}
+
+func (s *Stats) addRetry() {
+	if s != nil {
+		atomic.AddInt64(&s.retries, 1)
+	}
+}
@@ -10,6 +10,43 @@ type Config struct {
 		Username string `yaml:"username"`
 		Password string `yaml:"password"`
 	} `yaml:"admin"`
+	Cloudflare struct {
+		APIBaseURL     string `yaml:"api_base_url"`
+		Timeout        int    `yaml:"timeout"`
+		MaxConcurrency int    `yaml:"max_concurrency"`
+		RateLimit      int    `yaml:"rate_limit"`
+		MaxRetries     int    `yaml:"max_retries"`
+		ZoneCacheTTL   int    `yaml:"zone_cache_ttl"`
+	} `yaml:"cloudflare"`
+	Security struct {
+		MasterKey string `yaml:"master_key"`
+	} `yaml:"security"`
+	Audit struct {
+		Path string `yaml:"path"`
+	} `yaml:"audit"`
+	Snapshots struct {
+		Dir string `yaml:"dir"`
+	} `yaml:"snapshots"`
+	DNSCheck struct {
+		Resolvers   []string `yaml:"resolvers"`
+		NameServers []string `yaml:"nameservers"`
+		Timeout     int      `yaml:"timeout"`
+		Wait        int      `yaml:"wait"`
+	} `yaml:"dns_check"`
+	Onboarding struct {
+		Path     string `yaml:"path"`
+		Interval int    `yaml:"interval"`
+	} `yaml:"onboarding"`
+	Templates struct {
+		Path string `yaml:"path"`
+	} `yaml:"templates"`
+	Migrations struct {
+		Path string `yaml:"path"`
+	} `yaml:"migrations"`
+	Inventory struct {
+		Path     string `yaml:"path"`
+		Interval int    `yaml:"interval"`
+	} `yaml:"inventory"`
 }
 
 var GlobalConfig Config
@@ -23,5 +60,20 @@ func LoadConfig() error {
 	if err != nil {
 		return err
 	}
-	return yaml.Unmarshal(data, &GlobalConfig)
+	if err := yaml.Unmarshal(data, &GlobalConfig); err != nil {
+		return err
+	}
+	if v := os.Getenv("CF_API_BASE_URL"); v != "" {
+		GlobalConfig.Cloudflare.APIBaseURL = v
+	}
+	return nil
+}
+
+// MasterKey returns the key used to encrypt stored API keys. The
+// CF_TOOLS_MASTER_KEY environment variable takes precedence over config.yaml.
+func MasterKey() string {
+	if v := os.Getenv("CF_TOOLS_MASTER_KEY"); v != "" {
+		return v
+	}
+	return GlobalConfig.Security.MasterKey
 }
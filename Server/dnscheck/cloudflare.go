@@ -0,0 +1,56 @@
+package dnscheck
+
+import "net"
+
+// cloudflareRanges are the address ranges Cloudflare answers proxied records
+// with, as published at https://www.cloudflare.com/ips/.
+var cloudflareRanges = parseRanges(
+	"173.245.48.0/20",
+	"103.21.244.0/22",
+	"103.22.200.0/22",
+	"103.31.4.0/22",
+	"141.101.64.0/18",
+	"108.162.192.0/18",
+	"190.93.240.0/20",
+	"188.114.96.0/20",
+	"197.234.240.0/22",
+	"198.41.128.0/17",
+	"162.158.0.0/15",
+	"104.16.0.0/13",
+	"104.24.0.0/14",
+	"172.64.0.0/13",
+	"131.0.72.0/22",
+	"2400:cb00::/32",
+	"2606:4700::/32",
+	"2803:f800::/32",
+	"2405:b500::/32",
+	"2405:8100::/32",
+	"2a06:98c0::/29",
+	"2c0f:f248::/32",
+)
+
+func parseRanges(cidrs ...string) []*net.IPNet {
+	ranges := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ranges = append(ranges, n)
+	}
+	return ranges
+}
+
+// IsCloudflareIP reports whether ip belongs to Cloudflare's proxy network.
+func IsCloudflareIP(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, n := range cloudflareRanges {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,444 @@
+// Package dnscheck sends DNS queries to explicitly chosen servers, such as a
+// zone's authoritative nameservers or a list of public resolvers, and
+// returns the answers in zone file presentation form.
+package dnscheck
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const DefaultTimeout = 3 * time.Second
+
+// Client queries DNS servers directly, without the system resolver.
+type Client struct {
+	Timeout time.Duration
+}
+
+func NewClient() *Client {
+	return &Client{Timeout: DefaultTimeout}
+}
+
+// Record is one answer record. Value is in presentation form with names
+// lower-cased and without the trailing dot, e.g. "10 mail.example.com" for
+// MX or `0 issue "letsencrypt.org"` for CAA.
+type Record struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	TTL   uint32 `json:"ttl"`
+	Value string `json:"value"`
+}
+
+type Answer struct {
+	Server        string   `json:"server"`
+	RCode         string   `json:"rcode"`
+	Authoritative bool     `json:"authoritative"`
+	Records       []Record `json:"records,omitempty"`
+	// Authority holds the authority section, where referrals list the
+	// delegated nameservers
+	Authority []Record `json:"authority,omitempty"`
+}
+
+// Values returns the values of the answer records of type rtype, leaving out
+// the CNAME chain that led to them.
+func (a *Answer) Values(rtype string) []string {
+	var values []string
+	for _, r := range a.Records {
+		if r.Type == rtype {
+			values = append(values, r.Value)
+		}
+	}
+	return values
+}
+
+// NXDomain reports whether the server said the name doesn't exist.
+func (a *Answer) NXDomain() bool {
+	return a.RCode == "NXDOMAIN"
+}
+
+var types = map[string]dnsmessage.Type{
+	"A":      dnsmessage.TypeA,
+	"AAAA":   dnsmessage.TypeAAAA,
+	"CNAME":  dnsmessage.TypeCNAME,
+	"NS":     dnsmessage.TypeNS,
+	"PTR":    dnsmessage.TypePTR,
+	"MX":     dnsmessage.TypeMX,
+	"TXT":    dnsmessage.TypeTXT,
+	"SRV":    dnsmessage.TypeSRV,
+	"SOA":    dnsmessage.TypeSOA,
+	"DS":     dnsmessage.Type(43),
+	"DNSKEY": dnsmessage.Type(48),
+	"SVCB":   dnsmessage.Type(64),
+	"HTTPS":  dnsmessage.Type(65),
+	"CAA":    dnsmessage.Type(257),
+}
+
+func typeName(t dnsmessage.Type) string {
+	for name, v := range types {
+		if v == t {
+			return name
+		}
+	}
+	return fmt.Sprintf("TYPE%d", t)
+}
+
+// Query asks server for the records of type rtype at name. server is an IP
+// address or host name, optionally with a port; 53 is used when it has none.
+// Truncated UDP answers are retried over TCP.
+func (c *Client) Query(server string, name string, rtype string) (*Answer, error) {
+	qtype, ok := types[strings.ToUpper(rtype)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported query type %s", rtype)
+	}
+	qname, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, fmt.Errorf("invalid name %q", name)
+	}
+
+	addr, err := c.resolveServer(server)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uint16(rand.Intn(1 << 16))
+	query, err := buildQuery(id, qname, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.exchange("udp", addr, id, query)
+	if err != nil {
+		return nil, err
+	}
+	var p dnsmessage.Parser
+	header, err := p.Start(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response from %s: %v", server, err)
+	}
+	if header.Truncated {
+		if resp, err = c.exchange("tcp", addr, id, query); err != nil {
+			return nil, err
+		}
+		if header, err = p.Start(resp); err != nil {
+			return nil, fmt.Errorf("invalid response from %s: %v", server, err)
+		}
+	}
+
+	answer := &Answer{
+		Server:        server,
+		RCode:         rcodeName(header.RCode),
+		Authoritative: header.Authoritative,
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, fmt.Errorf("invalid response from %s: %v", server, err)
+	}
+	if answer.Records, err = parseSection(&p, p.AnswerHeader); err != nil {
+		return nil, fmt.Errorf("invalid response from %s: %v", server, err)
+	}
+	if answer.Authority, err = parseSection(&p, p.AuthorityHeader); err != nil {
+		return nil, fmt.Errorf("invalid response from %s: %v", server, err)
+	}
+	return answer, nil
+}
+
+// Delegation returns the nameservers the parent zone delegates domain to. It
+// finds the parent's nameservers through resolver and asks them directly, so
+// a change at the registrar shows up before resolver caches expire. When the
+// parent can't be asked, the resolver's own answer is used. A domain the
+// parent doesn't know has no nameservers.
+func (c *Client) Delegation(resolver string, domain string) ([]string, error) {
+	domain = canonicalName(domain)
+	for parent := parentOf(domain); parent != ""; parent = parentOf(parent) {
+		answer, err := c.Query(resolver, parent, "NS")
+		if err != nil {
+			break
+		}
+		servers := answer.Values("NS")
+		if len(servers) == 0 {
+			// no zone cut here, e.g. a name inside the registrable domain
+			continue
+		}
+		for _, server := range servers {
+			referral, err := c.Query(server, domain, "NS")
+			if err != nil {
+				continue
+			}
+			if referral.NXDomain() {
+				return nil, nil
+			}
+			ns := referral.Values("NS")
+			for _, r := range referral.Authority {
+				if r.Type == "NS" && r.Name == domain {
+					ns = append(ns, r.Value)
+				}
+			}
+			if len(ns) > 0 {
+				return uniqueSorted(ns), nil
+			}
+		}
+		break
+	}
+
+	answer, err := c.Query(resolver, domain, "NS")
+	if err != nil {
+		return nil, err
+	}
+	return uniqueSorted(answer.Values("NS")), nil
+}
+
+func parseSection(p *dnsmessage.Parser, next func() (dnsmessage.ResourceHeader, error)) ([]Record, error) {
+	var records []Record
+	for {
+		rh, err := next()
+		if err == dnsmessage.ErrSectionDone {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value, err := parseValue(p, rh.Type)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, Record{
+			Name:  canonicalName(rh.Name.String()),
+			Type:  typeName(rh.Type),
+			TTL:   rh.TTL,
+			Value: value,
+		})
+	}
+}
+
+func parentOf(name string) string {
+	if i := strings.Index(name, "."); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+func uniqueSorted(values []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func buildQuery(id uint16, name dnsmessage.Name, qtype dnsmessage.Type) ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: name, Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	// EDNS0 so DNSKEY and DS answers fit into UDP
+	if err := b.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(4096, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	if err := b.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+func (c *Client) exchange(network string, addr string, id uint16, query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout(network, addr, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+
+	if network == "tcp" {
+		msg := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(msg, uint16(len(query)))
+		copy(msg[2:], query)
+		if _, err := conn.Write(msg); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// ignore stray datagrams that don't answer our query
+		if n >= 2 && binary.BigEndian.Uint16(buf) == id {
+			return buf[:n], nil
+		}
+	}
+}
+
+// resolveServer turns server into an address to dial, looking up host names
+// through the system resolver.
+func (c *Client) resolveServer(server string) (string, error) {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		host, port = strings.Trim(server, "[]"), "53"
+	}
+	if net.ParseIP(host) != nil {
+		return net.JoinHostPort(host, port), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve %s: %v", host, err)
+	}
+	return net.JoinHostPort(addrs[0], port), nil
+}
+
+func parseValue(p *dnsmessage.Parser, t dnsmessage.Type) (string, error) {
+	switch t {
+	case dnsmessage.TypeA:
+		r, err := p.AResource()
+		return net.IP(r.A[:]).String(), err
+	case dnsmessage.TypeAAAA:
+		r, err := p.AAAAResource()
+		return net.IP(r.AAAA[:]).String(), err
+	case dnsmessage.TypeCNAME:
+		r, err := p.CNAMEResource()
+		return canonicalName(r.CNAME.String()), err
+	case dnsmessage.TypeNS:
+		r, err := p.NSResource()
+		return canonicalName(r.NS.String()), err
+	case dnsmessage.TypePTR:
+		r, err := p.PTRResource()
+		return canonicalName(r.PTR.String()), err
+	case dnsmessage.TypeMX:
+		r, err := p.MXResource()
+		return fmt.Sprintf("%d %s", r.Pref, canonicalName(r.MX.String())), err
+	case dnsmessage.TypeTXT:
+		r, err := p.TXTResource()
+		return strings.Join(r.TXT, ""), err
+	case dnsmessage.TypeSRV:
+		r, err := p.SRVResource()
+		return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, canonicalName(r.Target.String())), err
+	case dnsmessage.TypeSOA:
+		r, err := p.SOAResource()
+		return fmt.Sprintf("%s %s %d", canonicalName(r.NS.String()), canonicalName(r.MBox.String()), r.Serial), err
+	}
+
+	r, err := p.UnknownResource()
+	if err != nil {
+		return "", err
+	}
+	return formatUnknown(t, r.Data)
+}
+
+// formatUnknown formats the record types dnsmessage has no parser for.
+func formatUnknown(t dnsmessage.Type, data []byte) (string, error) {
+	malformed := fmt.Errorf("malformed %s record", typeName(t))
+	switch typeName(t) {
+	case "CAA":
+		if len(data) < 2 || len(data) < 2+int(data[1]) {
+			return "", malformed
+		}
+		tag := string(data[2 : 2+int(data[1])])
+		return fmt.Sprintf("%d %s %s", data[0], tag, strconv.Quote(string(data[2+int(data[1]):]))), nil
+	case "DS":
+		if len(data) < 5 {
+			return "", malformed
+		}
+		return fmt.Sprintf("%d %d %d %s", binary.BigEndian.Uint16(data), data[2], data[3], strings.ToUpper(hex.EncodeToString(data[4:]))), nil
+	case "DNSKEY":
+		if len(data) < 4 {
+			return "", malformed
+		}
+		return fmt.Sprintf("%d %d %d %s", binary.BigEndian.Uint16(data), data[2], data[3], base64.StdEncoding.EncodeToString(data[4:])), nil
+	case "HTTPS", "SVCB":
+		// priority and target only; the service parameters are left out
+		if len(data) < 3 {
+			return "", malformed
+		}
+		target, ok := wireName(data[2:])
+		if !ok {
+			return "", malformed
+		}
+		return fmt.Sprintf("%d %s", binary.BigEndian.Uint16(data), target), nil
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// wireName decodes an uncompressed name in wire format; "." is the root.
+func wireName(data []byte) (string, bool) {
+	var labels []string
+	for len(data) > 0 {
+		n := int(data[0])
+		if n == 0 {
+			if len(labels) == 0 {
+				return ".", true
+			}
+			return strings.ToLower(strings.Join(labels, ".")), true
+		}
+		if n > 63 || len(data) < 1+n {
+			return "", false
+		}
+		labels = append(labels, string(data[1:1+n]))
+		data = data[1+n:]
+	}
+	return "", false
+}
+
+func canonicalName(name string) string {
+	if name == "." {
+		return name
+	}
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+func rcodeName(rcode dnsmessage.RCode) string {
+	switch rcode {
+	case dnsmessage.RCodeSuccess:
+		return "NOERROR"
+	case dnsmessage.RCodeFormatError:
+		return "FORMERR"
+	case dnsmessage.RCodeServerFailure:
+		return "SERVFAIL"
+	case dnsmessage.RCodeNameError:
+		return "NXDOMAIN"
+	case dnsmessage.RCodeNotImplemented:
+		return "NOTIMP"
+	case dnsmessage.RCodeRefused:
+		return "REFUSED"
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
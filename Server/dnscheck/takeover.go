@@ -0,0 +1,101 @@
+package dnscheck
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Fingerprint describes a hosting provider where a CNAME left behind after the
+// resource was deleted can be claimed by someone else.
+type Fingerprint struct {
+	Provider string
+	// Pattern matches the CNAME targets served by the provider
+	Pattern *regexp.Regexp
+	// Body holds texts the provider shows for a name that isn't claimed
+	Body []string
+}
+
+// fingerprints is based on the list maintained at
+// https://github.com/EdOverflow/can-i-take-over-xyz.
+var fingerprints = []Fingerprint{
+	{"AWS S3", regexp.MustCompile(`(^|\.)s3([.-][a-z0-9-]+)*\.amazonaws\.com$`), []string{"NoSuchBucket", "The specified bucket does not exist"}},
+	{"AWS Elastic Beanstalk", regexp.MustCompile(`\.elasticbeanstalk\.com$`), nil},
+	{"Heroku", regexp.MustCompile(`\.(herokuapp|herokudns|herokussl)\.com$`), []string{"No such app", "herokucdn.com/error-pages/no-such-app.html"}},
+	{"GitHub Pages", regexp.MustCompile(`\.github\.io$`), []string{"There isn't a GitHub Pages site here"}},
+	{"Cloudflare Pages", regexp.MustCompile(`\.pages\.dev$`), nil},
+	{"Cloudflare Workers", regexp.MustCompile(`\.workers\.dev$`), nil},
+	{"Azure", regexp.MustCompile(`\.(azurewebsites\.net|cloudapp\.net|cloudapp\.azure\.com|trafficmanager\.net|blob\.core\.windows\.net|azureedge\.net|azure-api\.net|azurefd\.net)$`), nil},
+	{"Netlify", regexp.MustCompile(`\.netlify\.(app|com)$`), []string{"Not Found - Request ID"}},
+	{"Google Cloud Storage", regexp.MustCompile(`(^|\.)c\.storage\.googleapis\.com$`), []string{"The specified bucket does not exist"}},
+	{"Shopify", regexp.MustCompile(`\.myshopify\.com$`), []string{"Sorry, this shop is currently unavailable"}},
+	{"Fastly", regexp.MustCompile(`\.fastly\.net$`), []string{"Fastly error: unknown domain"}},
+	{"Zendesk", regexp.MustCompile(`\.zendesk\.com$`), []string{"Help Center Closed"}},
+	{"Ghost", regexp.MustCompile(`\.ghost\.io$`), []string{"The thing you were looking for is no longer here"}},
+	{"Surge", regexp.MustCompile(`\.surge\.sh$`), []string{"project not found"}},
+	{"Bitbucket", regexp.MustCompile(`\.bitbucket\.io$`), []string{"Repository not found"}},
+	{"ReadMe", regexp.MustCompile(`\.readme\.io$`), []string{"Project doesnt exist... yet!"}},
+	{"Pantheon", regexp.MustCompile(`\.pantheonsite\.io$`), []string{"The gods are wise"}},
+	{"Tumblr", regexp.MustCompile(`(^|\.)domains\.tumblr\.com$`), []string{"Whatever you were looking for doesn't currently exist at this address"}},
+	{"Unbounce", regexp.MustCompile(`(^|\.)unbouncepages\.com$`), []string{"The requested URL was not found on this server"}},
+	{"Fly.io", regexp.MustCompile(`\.fly\.dev$`), nil},
+}
+
+// MatchFingerprint returns the takeover-prone provider serving target, if any.
+func MatchFingerprint(target string) *Fingerprint {
+	target = canonicalName(target)
+	for i := range fingerprints {
+		if fingerprints[i].Pattern.MatchString(target) {
+			return &fingerprints[i]
+		}
+	}
+	return nil
+}
+
+// MatchesBody reports whether body contains one of the provider's texts for
+// an unclaimed name.
+func (f *Fingerprint) MatchesBody(body string) bool {
+	for _, text := range f.Body {
+		if strings.Contains(body, text) {
+			return true
+		}
+	}
+	return false
+}
+
+type reservedRange struct {
+	name string
+	nets []*net.IPNet
+}
+
+// reservedRanges are the special purpose ranges (RFC 6890 and friends) a
+// public record shouldn't point at.
+var reservedRanges = []reservedRange{
+	{"private", parseRanges("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")},
+	{"loopback", parseRanges("127.0.0.0/8", "::1/128")},
+	{"link-local", parseRanges("169.254.0.0/16", "fe80::/10")},
+	{"shared address space", parseRanges("100.64.0.0/10")},
+	{"this network", parseRanges("0.0.0.0/8", "::/128")},
+	{"documentation", parseRanges("192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24", "2001:db8::/32")},
+	{"benchmarking", parseRanges("198.18.0.0/15", "2001:2::/48")},
+	{"IETF protocol assignments", parseRanges("192.0.0.0/24")},
+	{"multicast", parseRanges("224.0.0.0/4", "ff00::/8")},
+	{"reserved", parseRanges("240.0.0.0/4", "100::/64")},
+}
+
+// ReservedRange returns the name of the special purpose range ip belongs to,
+// or "" for a public address.
+func ReservedRange(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ""
+	}
+	for _, r := range reservedRanges {
+		for _, n := range r.nets {
+			if n.Contains(addr) {
+				return r.name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+// Package domains cleans up domain names as they are pasted into batch
+// forms: URLs, upper case, trailing dots, duplicates and Unicode names. Each
+// name is mapped to the zone it belongs to, using the public suffix list.
+package domains
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Domain is a parsed input. Zone is the registrable domain, e.g.
+// example.co.uk for shop.example.co.uk, and Host the labels in front of it,
+// empty for the zone itself. Names are ASCII, IDNs in punycode.
+type Domain struct {
+	Line  int    `json:"line"`
+	Input string `json:"input"`
+	Name  string `json:"name"`
+	Zone  string `json:"zone"`
+	Host  string `json:"host,omitempty"`
+}
+
+// Rejection is an input that isn't a domain name. Line is 1-based.
+type Rejection struct {
+	Line  int    `json:"line"`
+	Input string `json:"input"`
+	Error string `json:"error"`
+}
+
+// profile maps names the way a resolver does (case folding, Unicode
+// normalization) and checks the DNS label and length rules.
+var profile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.VerifyDNSLength(true))
+
+// Parse turns one input into a domain. It accepts URLs
+// (https://www.example.com/path), e-mail addresses, host:port and names with
+// a trailing dot.
+func Parse(input string) (Domain, error) {
+	d := Domain{Input: input}
+
+	s := strings.TrimSpace(input)
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+	}
+	if i := strings.IndexAny(s, "/?#"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.LastIndexByte(s, '@'); i >= 0 {
+		s = s[i+1:]
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(s, ".")
+	if s == "" {
+		return d, errors.New("Empty domain")
+	}
+	if net.ParseIP(strings.Trim(s, "[]")) != nil {
+		return d, errors.New("IP address is not a domain")
+	}
+
+	name, err := profile.ToASCII(s)
+	if err != nil {
+		return d, fmt.Errorf("Invalid domain: %v", err)
+	}
+	if !strings.Contains(name, ".") {
+		return d, errors.New("Domain needs a top-level domain")
+	}
+	zone, err := registrable(name)
+	if err != nil {
+		return d, err
+	}
+
+	d.Name = name
+	d.Zone = zone
+	d.Host = strings.TrimSuffix(strings.TrimSuffix(name, zone), ".")
+	return d, nil
+}
+
+// registrable returns the registrable domain of name. Only the ICANN part of
+// the public suffix list is used: the private part lists names such as
+// github.io, whose owners may well keep them as one Cloudflare zone.
+func registrable(name string) (string, error) {
+	suffix, icann := publicsuffix.PublicSuffix(name)
+	for !icann {
+		i := strings.IndexByte(suffix, '.')
+		if i < 0 {
+			return "", fmt.Errorf("Unknown top-level domain %s", suffix)
+		}
+		suffix, icann = publicsuffix.PublicSuffix(suffix[i+1:])
+	}
+	if name == suffix {
+		return "", fmt.Errorf("%s is a public suffix", name)
+	}
+
+	rest := strings.TrimSuffix(name, "."+suffix)
+	return rest[strings.LastIndexByte(rest, '.')+1:] + "." + suffix, nil
+}
+
+// ParseLines parses one input per entry, as split from a textarea. Blank
+// entries are skipped but still counted, so Line points at the row the
+// input came from. Repeats of an earlier name are dropped.
+func ParseLines(lines []string) ([]Domain, []Rejection) {
+	var list []Domain
+	var rejected []Rejection
+	seen := map[string]bool{}
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		d, err := Parse(line)
+		if err != nil {
+			rejected = append(rejected, Rejection{Line: i + 1, Input: line, Error: err.Error()})
+			continue
+		}
+		if seen[d.Name] {
+			continue
+		}
+		seen[d.Name] = true
+		d.Line = i + 1
+		list = append(list, d)
+	}
+	return list, rejected
+}
+
+// Zones returns the distinct zones of list, in order.
+func Zones(list []Domain) []string {
+	zones := []string{}
+	seen := map[string]bool{}
+	for _, d := range list {
+		if !seen[d.Zone] {
+			seen[d.Zone] = true
+			zones = append(zones, d.Zone)
+		}
+	}
+	return zones
+}
+
+// Names returns the names of list, for inputs that stand for hosts rather
+// than zones, such as certificate names.
+func Names(list []Domain) []string {
+	names := make([]string, len(list))
+	for i, d := range list {
+		names[i] = d.Name
+	}
+	return names
+}
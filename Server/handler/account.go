@@ -1,20 +1,23 @@
 package handler
 
 import (
+	"cloudflare-tools/server/cfapi"
 	"cloudflare-tools/server/models"
+	"errors"
 	"net/http"
+	"net/url"
+	"sort"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"io/ioutil"
 	"fmt"
 )
 
 func ListAccounts(c *gin.Context) {
-	if models.Accounts == nil {
-		c.JSON(http.StatusOK, []models.Account{})
-		return
+	masked := make([]models.Account, 0, len(models.Accounts))
+	for _, acc := range models.Accounts {
+		masked = append(masked, acc.Masked())
 	}
-	c.JSON(http.StatusOK, models.Accounts)
+	c.JSON(http.StatusOK, masked)
 }
 
 func AddAccount(c *gin.Context) {
@@ -24,10 +27,26 @@ func AddAccount(c *gin.Context) {
 		return
 	}
 
+	switch acc.AuthType {
+	case "":
+		acc.AuthType = models.AuthTypeGlobalKey
+	case models.AuthTypeGlobalKey, models.AuthTypeAPIToken:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid auth type"})
+		return
+	}
+	if !models.HasMasterKey() {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": models.ErrNoMasterKey.Error()})
+		return
+	}
+
 	if acc.ID != "" {
 		found := false
 		for i, existing := range models.Accounts {
 			if existing.ID == acc.ID {
+				if acc.Key == "" || acc.Key == existing.Masked().Key {
+					acc.Key = existing.Key
+				}
 				models.Accounts[i] = acc
 				found = true
 				break
@@ -46,7 +65,7 @@ func AddAccount(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, acc)
+	c.JSON(http.StatusOK, acc.Masked())
 }
 
 func DeleteAccount(c *gin.Context) {
@@ -77,23 +96,139 @@ func TestAccount(c *gin.Context) {
 		return
 	}
 
-	client := &http.Client{}
-	req, _ := http.NewRequest("GET", "https://api.cloudflare.com/client/v4/zones?per_page=1", nil)
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-	req.Header.Add("Content-Type", "application/json")
+	// Stored accounts are tested by ID since the browser only sees masked keys.
+	if acc.ID != "" {
+		stored := findAccount(acc.ID)
+		if stored == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+			return
+		}
+		acc = *stored
+	}
+
+	if acc.UsesAPIToken() {
+		testAPIToken(c, &acc)
+		return
+	}
 
-	resp, err := client.Do(req)
+	_, err := newCFClient(&acc).Get("/zones", url.Values{"per_page": {"1"}}, nil)
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": "无法连接到 Cloudflare API"})
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": testFailureMessage(err)})
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
-		c.JSON(http.StatusOK, gin.H{"success": true})
-	} else {
-		body, _ := ioutil.ReadAll(resp.Body)
-		c.JSON(http.StatusOK, gin.H{"success": false, "message": fmt.Sprintf("校验失败 (HTTP %d): %s", resp.StatusCode, string(body))})
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// AccountMemberships lists the Cloudflare accounts a stored credential can
+// create zones in.
+type AccountMemberships struct {
+	AccountID   string      `json:"accountId"`
+	Name        string      `json:"name"`
+	CFAccountID string      `json:"cfAccountId,omitempty"`
+	Memberships []cfAccount `json:"memberships"`
+	Error       string      `json:"error,omitempty"`
+}
+
+type cfAccount struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ListAccountMemberships answers GET /api/accounts/memberships, for every
+// stored credential or only the one given by accountId.
+func ListAccountMemberships(c *gin.Context) {
+	accounts := models.Accounts
+	if id := c.Query("accountId"); id != "" {
+		acc := findAccount(id)
+		if acc == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+			return
+		}
+		accounts = []models.Account{*acc}
+	}
+
+	results := make([]AccountMemberships, len(accounts))
+	forEachBounded(len(accounts), func(idx int) {
+		acc := accounts[idx]
+		result := AccountMemberships{AccountID: acc.ID, Name: acc.Name, CFAccountID: acc.CFAccountID, Memberships: []cfAccount{}}
+		list, err := cfapi.GetAll[cfAccount](newCFClient(&acc), "/accounts", nil, 50)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Memberships = list
+		}
+		results[idx] = result
+	})
+	c.JSON(http.StatusOK, results)
+}
+
+func findAccount(id string) *models.Account {
+	for _, a := range models.Accounts {
+		if a.ID == id {
+			return &a
+		}
+	}
+	return nil
+}
+
+func testAPIToken(c *gin.Context, acc *models.Account) {
+	client := newCFClient(acc)
+
+	var token struct {
+		ID        string `json:"id"`
+		Status    string `json:"status"`
+		ExpiresOn string `json:"expires_on"`
+	}
+	if _, err := client.Get("/user/tokens/verify", nil, &token); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": testFailureMessage(err)})
+		return
+	}
+	if token.Status != "active" {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": fmt.Sprintf("令牌状态异常: %s", token.Status)})
+		return
+	}
+
+	var zones []struct {
+		Name        string   `json:"name"`
+		Permissions []string `json:"permissions"`
+	}
+	resp, err := client.Get("/zones", url.Values{"per_page": {"50"}}, &zones)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "令牌有效，但无法读取 Zone: " + err.Error()})
+		return
+	}
+
+	zoneNames := []string{}
+	permissions := []string{}
+	seen := map[string]bool{}
+	for _, zone := range zones {
+		zoneNames = append(zoneNames, zone.Name)
+		for _, perm := range zone.Permissions {
+			if !seen[perm] {
+				seen[perm] = true
+				permissions = append(permissions, perm)
+			}
+		}
+	}
+	sort.Strings(permissions)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"authType":    models.AuthTypeAPIToken,
+		"tokenStatus": token.Status,
+		"expiresOn":   token.ExpiresOn,
+		"permissions": permissions,
+		"zones":       zoneNames,
+		"zoneCount":   resp.ResultInfo.TotalCount,
+	})
+}
+
+func testFailureMessage(err error) string {
+	var apiErr *cfapi.APIError
+	if errors.As(err, &apiErr) {
+		return fmt.Sprintf("校验失败 (HTTP %d): %s", apiErr.StatusCode, apiErr.Error())
 	}
+	return "无法连接到 Cloudflare API"
 }
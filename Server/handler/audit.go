@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"cloudflare-tools/server/audit"
+	"cloudflare-tools/server/models"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newAuditEntry captures who is running the batch before the handler returns,
+// so async jobs can still record it once they finish. acc is nil for batches
+// routed by domain.
+func newAuditEntry(c *gin.Context, action string, acc *models.Account, req interface{}) audit.Entry {
+	entry := audit.Entry{
+		Time:     time.Now(),
+		IP:       c.ClientIP(),
+		Endpoint: c.Request.Method + " " + c.Request.URL.Path,
+		Action:   action,
+		Payload:  audit.Sanitize(req),
+	}
+	if acc != nil {
+		entry.AccountID = acc.ID
+	}
+	if user, ok := c.Get("user"); ok && user != nil {
+		entry.User = fmt.Sprint(user)
+	}
+	if payload, ok := entry.Payload.(map[string]interface{}); ok {
+		entry.DryRun, _ = payload["dryRun"].(bool)
+	}
+	return entry
+}
+
+func recordAudit(entry audit.Entry) {
+	if err := audit.Record(entry); err != nil {
+		log.Printf("Warning: Failed to write audit log: %v", err)
+	}
+}
+
+// ListAudit answers GET /api/audit. Supported filters: from, to (RFC3339 or
+// YYYY-MM-DD), domain, accountId, action, user and limit (default 200).
+func ListAudit(c *gin.Context) {
+	filter := audit.Filter{
+		Domain:    c.Query("domain"),
+		AccountID: c.Query("accountId"),
+		Action:    c.Query("action"),
+		User:      c.Query("user"),
+		Limit:     200,
+	}
+
+	var err error
+	if v := c.Query("from"); v != "" {
+		if filter.From, err = parseAuditTime(v, false); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from"})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if filter.To, err = parseAuditTime(v, true); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to"})
+			return
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		filter.Limit = n
+	}
+
+	entries, err := audit.Query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// parseAuditTime accepts RFC3339 or a plain date. A plain date used as the
+// upper bound covers the whole day.
+func parseAuditTime(v string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
@@ -120,9 +120,16 @@ func Login(c *gin.Context) {
 	})
 }
 
+const jobEventsPath = "/api/jobs/:id/events"
+
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.GetHeader("Authorization")
+		// EventSource can't set headers, so the job event stream also
+		// accepts the token as ?token=
+		if tokenString == "" && c.FullPath() == jobEventsPath {
+			tokenString = c.Query("token")
+		}
 		if tokenString == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未提供认证令牌"})
 			return
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"cloudflare-tools/server/cfapi"
+	"cloudflare-tools/server/jobs"
+	"cloudflare-tools/server/models"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runBatch runs work once per item on a bounded worker pool. By default it
+// waits and answers with the result array; with ?async=1 it answers 202 with
+// a job ID right away and the results are collected by the jobs package.
+//
+// Each item gets its own copy of acc so the retries its requests needed can
+// be reported back through retriesFor. Once every item is done the request
+// and its results are written to the audit log.
+func runBatch[T any](c *gin.Context, jobType string, acc *models.Account, req interface{}, n int, work func(idx int, acc *models.Account) T) {
+	runRoutedBatch(c, jobType, &batchRoute{acc: acc}, req, n, work)
+}
+
+// runRoutedBatch is runBatch with the account of each item taken from route.
+func runRoutedBatch[T any](c *gin.Context, jobType string, route *batchRoute, req interface{}, n int, work func(idx int, acc *models.Account) T) {
+	runVerifiedBatch(c, jobType, route, req, n, work, 0, nil)
+}
+
+// runVerifiedBatch is runRoutedBatch for writes that are checked once they
+// are done. Each written item goes to a second pool that runs verify, so the
+// write workers don't sit waiting for DNS, and its result is reported when
+// the check returns. verify gets what is left of wait counted from the end
+// of the item's write, which caps the whole batch at its last write plus
+// wait. A nil verify runs the batch without checks.
+func runVerifiedBatch[T any](c *gin.Context, jobType string, route *batchRoute, req interface{}, n int, work func(idx int, acc *models.Account) T, wait time.Duration, verify func(idx int, acc *models.Account, result *T, wait time.Duration)) {
+	runItem := func(idx int) T {
+		var itemAcc models.Account
+		if acc := route.account(idx); acc != nil {
+			itemAcc = *acc
+		}
+		itemStats.Store(&itemAcc, &cfapi.Stats{})
+		defer itemStats.Delete(&itemAcc)
+		return work(idx, &itemAcc)
+	}
+	each := func(publish func(idx int, result T)) {
+		if verify == nil {
+			forEachBounded(n, func(idx int) {
+				publish(idx, runItem(idx))
+			})
+			return
+		}
+		forEachVerified(n, wait, runItem, func(idx int, result *T, left time.Duration) {
+			verify(idx, route.account(idx), result, left)
+		}, publish)
+	}
+
+	entry := newAuditEntry(c, jobType, route.acc, req)
+	entry.Accounts = route.accountIDs()
+
+	if isAsync(c) {
+		job := jobs.New(jobType, n)
+		go func() {
+			each(func(idx int, result T) {
+				job.SetResult(idx, result)
+			})
+			job.Finish()
+			entry.Results = job.Snapshot().Results
+			recordAudit(entry)
+		}()
+		c.JSON(http.StatusAccepted, gin.H{"jobId": job.ID, "total": n})
+		return
+	}
+
+	results := make([]T, n)
+	each(func(idx int, result T) {
+		results[idx] = result
+	})
+	entry.Results = make([]interface{}, n)
+	for i, r := range results {
+		entry.Results[i] = r
+	}
+	recordAudit(entry)
+	c.JSON(http.StatusOK, results)
+}
+
+func forEachBounded(n int, fn func(idx int)) {
+	workers := maxConcurrency()
+	if workers > n {
+		workers = n
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range next {
+				fn(idx)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// forEachVerified runs work on a bounded pool like forEachBounded and hands
+// each result to verify on a pool of its own, then to done. The deadline of
+// a check is wait after its write finished, however long it queued.
+func forEachVerified[T any](n int, wait time.Duration, work func(idx int) T, verify func(idx int, result *T, wait time.Duration), done func(idx int, result T)) {
+	type written struct {
+		idx      int
+		result   T
+		deadline time.Time
+	}
+
+	workers := maxConcurrency()
+	if workers > n {
+		workers = n
+	}
+
+	queue := make(chan written, n)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				verify(item.idx, &item.result, time.Until(item.deadline))
+				done(item.idx, item.result)
+			}
+		}()
+	}
+	forEachBounded(n, func(idx int) {
+		result := work(idx)
+		queue <- written{idx: idx, result: result, deadline: time.Now().Add(wait)}
+	})
+	close(queue)
+	wg.Wait()
+}
+
+func isAsync(c *gin.Context) bool {
+	switch c.Query("async") {
+	case "1", "true":
+		return true
+	}
+	return false
+}
@@ -2,11 +2,7 @@ package handler
 
 import (
 	"cloudflare-tools/server/models"
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"net/http"
-	"sync"
 
 	"github.com/gin-gonic/gin"
 )
@@ -30,12 +26,15 @@ type BatchBulkSettingsRequest struct {
 	SortQueryString     string   `json:"sortQueryString"`
 	TrueClientIP        string   `json:"trueClientIp"`
 	CrawlerHints        string   `json:"crawlerHints"`
+	DryRun              bool     `json:"dryRun"`
 }
 
 type BulkSettingsResult struct {
 	Domain  string `json:"domain"`
 	Success bool   `json:"success"`
 	Message string `json:"message"`
+	Retries int    `json:"retries,omitempty"`
+	Plan    []string `json:"plan,omitempty"`
 }
 
 func BatchBulkSettings(c *gin.Context) {
@@ -45,185 +44,64 @@ func BatchBulkSettings(c *gin.Context) {
 		return
 	}
 
-	var acc *models.Account
-	for _, a := range models.Accounts {
-		if a.ID == req.AccountID {
-			acc = &a
-			break
-		}
+	if !normalizeZones(c, &req.Domains) {
+		return
 	}
 
-	if acc == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	route := routeBatch(c, req.AccountID, req.Domains)
+	if route == nil {
 		return
 	}
 
-	results := make([]BulkSettingsResult, len(req.Domains))
-	var wg sync.WaitGroup
-
-	for i, domain := range req.Domains {
-		wg.Add(1)
-		go func(idx int, dom string) {
-			defer wg.Done()
-			success, msg := applyBulkSettings(acc, dom, &req)
-			results[idx] = BulkSettingsResult{
-				Domain:  dom,
-				Success: success,
-				Message: msg,
-			}
-		}(i, domain)
-	}
+	runRoutedBatch(c, "bulk-settings.batch-apply", route, &req, len(req.Domains), func(idx int, acc *models.Account) BulkSettingsResult {
+		dom := req.Domains[idx]
+		var (
+			success bool
+			msg     string
+			plan    []string
+		)
+		if req.DryRun {
+			success, msg, plan = planZoneSettings(acc, dom, req.settingChanges())
+		} else {
+			success, msg = applyBulkSettings(acc, dom, &req)
+		}
+		return BulkSettingsResult{
+			Domain:  dom,
+			Success: success,
+			Message: msg,
+			Retries: retriesFor(acc),
+			Plan:    plan,
+		}
+	})
+}
 
-	wg.Wait()
-	c.JSON(http.StatusOK, results)
+func (s *BatchBulkSettingsRequest) settingChanges() []settingChange {
+	return collectSettings(
+		"security_level", s.SecurityLevel,
+		"challenge_ttl", s.ChallengePassage,
+		"browser_check", s.BrowserIntegrity,
+		"hotlink_protection", s.HotlinkProtection,
+		"email_obfuscation", s.EmailObfuscation,
+		"server_side_exclude", s.ServerSideExcludes,
+		"waf", s.WAF,
+		"privacy_pass", s.PrivacyPass,
+		"automatic_platform_optimization", s.AutomaticPlatform,
+		"orange_to_orange", s.OrangeToOrange,
+		"proxy_read_timeout", s.ProxyReadTimeout,
+		"prefetch_preload", s.PrefetchPreload,
+		"response_buffering", s.ResponseBuffering,
+		"sort_query_string_for_cache", s.SortQueryString,
+		"true_client_ip_header", s.TrueClientIP,
+		"crawler_hints", s.CrawlerHints,
+	)
 }
 
 func applyBulkSettings(acc *models.Account, domain string, settings *BatchBulkSettingsRequest) (bool, string) {
-	reqGet, _ := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones?name=%s", domain), nil)
-	reqGet.Header.Add("X-Auth-Email", acc.Email)
-	reqGet.Header.Add("X-Auth-Key", acc.Key)
-
-	client := &http.Client{}
-	resp, err := client.Do(reqGet)
+	zoneID, err := getZoneID(acc, domain)
 	if err != nil {
-		return false, "Request failed"
-	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Result []struct {
-			ID string `json:"id"`
-		} `json:"result"`
-	}
-
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
-
-	if len(result.Result) == 0 {
-		return false, "Zone not found"
-	}
-
-	zoneID := result.Result[0].ID
-	successCount := 0
-	totalOperations := 0
-
-	if settings.SecurityLevel != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "security_level", settings.SecurityLevel) {
-			successCount++
-		}
-	}
-
-	if settings.ChallengePassage != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "challenge_ttl", settings.ChallengePassage) {
-			successCount++
-		}
-	}
-
-	if settings.BrowserIntegrity != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "browser_check", settings.BrowserIntegrity) {
-			successCount++
-		}
-	}
-
-	if settings.HotlinkProtection != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "hotlink_protection", settings.HotlinkProtection) {
-			successCount++
-		}
-	}
-
-	if settings.EmailObfuscation != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "email_obfuscation", settings.EmailObfuscation) {
-			successCount++
-		}
-	}
-
-	if settings.ServerSideExcludes != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "server_side_exclude", settings.ServerSideExcludes) {
-			successCount++
-		}
-	}
-
-	if settings.WAF != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "waf", settings.WAF) {
-			successCount++
-		}
-	}
-
-	if settings.PrivacyPass != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "privacy_pass", settings.PrivacyPass) {
-			successCount++
-		}
-	}
-
-	if settings.AutomaticPlatform != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "automatic_platform_optimization", settings.AutomaticPlatform) {
-			successCount++
-		}
-	}
-
-	if settings.OrangeToOrange != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "orange_to_orange", settings.OrangeToOrange) {
-			successCount++
-		}
-	}
-
-	if settings.ProxyReadTimeout != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "proxy_read_timeout", settings.ProxyReadTimeout) {
-			successCount++
-		}
-	}
-
-	if settings.PrefetchPreload != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "prefetch_preload", settings.PrefetchPreload) {
-			successCount++
-		}
-	}
-
-	if settings.ResponseBuffering != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "response_buffering", settings.ResponseBuffering) {
-			successCount++
-		}
-	}
-
-	if settings.SortQueryString != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "sort_query_string_for_cache", settings.SortQueryString) {
-			successCount++
-		}
-	}
-
-	if settings.TrueClientIP != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "true_client_ip_header", settings.TrueClientIP) {
-			successCount++
-		}
-	}
-
-	if settings.CrawlerHints != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "crawler_hints", settings.CrawlerHints) {
-			successCount++
-		}
-	}
-
-	if successCount == totalOperations && totalOperations > 0 {
-		return true, fmt.Sprintf("Success (%d/%d)", successCount, totalOperations)
-	} else if successCount > 0 {
-		return true, fmt.Sprintf("Partial success (%d/%d)", successCount, totalOperations)
+		return false, err.Error()
 	}
 
-	return false, "No operations performed"
+	successCount, totalOperations := countSettingUpdates(acc, zoneID, settings.settingChanges())
+	return summarizeOperations(successCount, totalOperations, "No operations performed")
 }
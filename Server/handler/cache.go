@@ -1,13 +1,9 @@
 package handler
 
 import (
-	"bytes"
 	"cloudflare-tools/server/models"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"sync"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,12 +16,15 @@ type BatchCacheRequest struct {
 	BrowserTTL     string   `json:"browserTtl"`
 	AlwaysOnline   string   `json:"alwaysOnline"`
 	DevelopmentMode string  `json:"developmentMode"`
+	DryRun          bool    `json:"dryRun"`
 }
 
 type CacheResult struct {
 	Domain  string `json:"domain"`
 	Success bool   `json:"success"`
 	Message string `json:"message"`
+	Retries int    `json:"retries,omitempty"`
+	Plan    []string `json:"plan,omitempty"`
 }
 
 func BatchCacheSettings(c *gin.Context) {
@@ -35,65 +34,56 @@ func BatchCacheSettings(c *gin.Context) {
 		return
 	}
 
-	var acc *models.Account
-	for _, a := range models.Accounts {
-		if a.ID == req.AccountID {
-			acc = &a
-			break
-		}
+	if !normalizeZones(c, &req.Domains) {
+		return
 	}
 
-	if acc == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	route := routeBatch(c, req.AccountID, req.Domains)
+	if route == nil {
 		return
 	}
 
-	results := make([]CacheResult, len(req.Domains))
-	var wg sync.WaitGroup
-
-	for i, domain := range req.Domains {
-		wg.Add(1)
-		go func(idx int, dom string) {
-			defer wg.Done()
-			success, msg := applyCacheSettings(acc, dom, &req)
-			results[idx] = CacheResult{
-				Domain:  dom,
-				Success: success,
-				Message: msg,
+	runRoutedBatch(c, "cache.batch-settings", route, &req, len(req.Domains), func(idx int, acc *models.Account) CacheResult {
+		dom := req.Domains[idx]
+		var (
+			success bool
+			msg     string
+			plan    []string
+		)
+		if req.DryRun {
+			var extra []string
+			if req.PurgeCache {
+				extra = append(extra, "purge_cache: would purge everything")
 			}
-		}(i, domain)
-	}
+			success, msg, plan = planZoneSettings(acc, dom, req.settingChanges(), extra...)
+		} else {
+			success, msg = applyCacheSettings(acc, dom, &req)
+		}
+		return CacheResult{
+			Domain:  dom,
+			Success: success,
+			Message: msg,
+			Retries: retriesFor(acc),
+			Plan:    plan,
+		}
+	})
+}
 
-	wg.Wait()
-	c.JSON(http.StatusOK, results)
+func (s *BatchCacheRequest) settingChanges() []settingChange {
+	return collectSettings(
+		"cache_level", s.CacheLevel,
+		"browser_cache_ttl", s.BrowserTTL,
+		"always_online", s.AlwaysOnline,
+		"development_mode", s.DevelopmentMode,
+	)
 }
 
 func applyCacheSettings(acc *models.Account, domain string, settings *BatchCacheRequest) (bool, string) {
-	reqGet, _ := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones?name=%s", domain), nil)
-	reqGet.Header.Add("X-Auth-Email", acc.Email)
-	reqGet.Header.Add("X-Auth-Key", acc.Key)
-
-	client := &http.Client{}
-	resp, err := client.Do(reqGet)
+	zoneID, err := getZoneID(acc, domain)
 	if err != nil {
-		return false, "Request failed"
-	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Result []struct {
-			ID string `json:"id"`
-		} `json:"result"`
+		return false, err.Error()
 	}
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
-
-	if len(result.Result) == 0 {
-		return false, "Zone not found"
-	}
-
-	zoneID := result.Result[0].ID
 	successCount := 0
 	totalOperations := 0
 
@@ -104,61 +94,15 @@ func applyCacheSettings(acc *models.Account, domain string, settings *BatchCache
 		}
 	}
 
-	if settings.CacheLevel != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "cache_level", settings.CacheLevel) {
-			successCount++
-		}
-	}
-
-	if settings.BrowserTTL != "" {
-		totalOperations++
-		ttlValue := settings.BrowserTTL
-		if updateZoneSetting(acc, zoneID, "browser_cache_ttl", ttlValue) {
-			successCount++
-		}
-	}
-
-	if settings.AlwaysOnline != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "always_online", settings.AlwaysOnline) {
-			successCount++
-		}
-	}
-
-	if settings.DevelopmentMode != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "development_mode", settings.DevelopmentMode) {
-			successCount++
-		}
-	}
-
-	if successCount == totalOperations && totalOperations > 0 {
-		return true, fmt.Sprintf("Success (%d/%d)", successCount, totalOperations)
-	} else if successCount > 0 {
-		return true, fmt.Sprintf("Partial success (%d/%d)", successCount, totalOperations)
-	}
-
-	return false, "No operations performed"
+	updated, total := countSettingUpdates(acc, zoneID, settings.settingChanges())
+	return summarizeOperations(successCount+updated, totalOperations+total, "No operations performed")
 }
 
 func purgeAllCache(acc *models.Account, zoneID string) bool {
 	payload := map[string]interface{}{
 		"purge_everything": true,
 	}
-	body, _ := json.Marshal(payload)
-
-	req, _ := http.NewRequest("POST", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/purge_cache", zoneID), bytes.NewBuffer(body))
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-	req.Header.Add("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return false
-	}
-	defer resp.Body.Close()
 
-	return resp.StatusCode == http.StatusOK
+	_, err := newCFClient(acc).Post(fmt.Sprintf("/zones/%s/purge_cache", zoneID), payload, nil)
+	return err == nil
 }
@@ -7,11 +7,11 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"sync"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,6 +20,7 @@ type BatchApplyCertRequest struct {
 	AccountID      string   `json:"accountId"`
 	Domains        []string `json:"domains"`
 	IncludeWildcard bool    `json:"includeWildcard"`
+	DryRun          bool    `json:"dryRun"`
 }
 
 type CertResult struct {
@@ -29,6 +30,8 @@ type CertResult struct {
 	Steps        []string `json:"steps"`
 	CertPath     string   `json:"certPath,omitempty"`
 	DownloadURL  string   `json:"downloadUrl,omitempty"`
+	Retries      int      `json:"retries,omitempty"`
+	Plan         []string `json:"plan,omitempty"`
 }
 
 func BatchApplyCert(c *gin.Context) {
@@ -38,44 +41,43 @@ func BatchApplyCert(c *gin.Context) {
 		return
 	}
 
-	var acc *models.Account
-	for _, a := range models.Accounts {
-		if a.ID == req.AccountID {
-			acc = &a
-			break
-		}
+	if !normalizeNames(c, &req.Domains) {
+		return
 	}
 
-	if acc == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	route := routeBatch(c, req.AccountID, req.Domains)
+	if route == nil {
 		return
 	}
 
-	results := make([]CertResult, len(req.Domains))
-	var wg sync.WaitGroup
-
-	for i, domain := range req.Domains {
-		wg.Add(1)
-		go func(idx int, dom string) {
-			defer wg.Done()
-			success, msg, steps, certPath := applyCertificate(acc, dom, req.IncludeWildcard)
-			downloadURL := ""
-			if success && certPath != "" {
-				downloadURL = fmt.Sprintf("/api/certs/download/%s", filepath.Base(certPath))
-			}
-			results[idx] = CertResult{
-				Domain:      dom,
-				Success:     success,
-				Message:     msg,
-				Steps:       steps,
-				CertPath:    certPath,
-				DownloadURL: downloadURL,
+	runRoutedBatch(c, "certs.batch-apply", route, &req, len(req.Domains), func(idx int, acc *models.Account) CertResult {
+		dom := req.Domains[idx]
+		if req.DryRun {
+			success, msg, plan := planCertificate(acc, dom, req.IncludeWildcard)
+			return CertResult{
+				Domain:  dom,
+				Success: success,
+				Message: msg,
+				Steps:   []string{},
+				Retries: retriesFor(acc),
+				Plan:    plan,
 			}
-		}(i, domain)
-	}
-
-	wg.Wait()
-	c.JSON(http.StatusOK, results)
+		}
+		success, msg, steps, certPath := applyCertificate(acc, dom, req.IncludeWildcard)
+		downloadURL := ""
+		if success && certPath != "" {
+			downloadURL = fmt.Sprintf("/api/certs/download/%s", filepath.Base(certPath))
+		}
+		return CertResult{
+			Domain:      dom,
+			Success:     success,
+			Message:     msg,
+			Steps:       steps,
+			CertPath:    certPath,
+			DownloadURL: downloadURL,
+			Retries:     retriesFor(acc),
+		}
+	})
 }
 
 func applyCertificate(acc *models.Account, domain string, includeWildcard bool) (bool, string, []string, string) {
@@ -105,10 +107,7 @@ func applyCertificate(acc *models.Account, domain string, includeWildcard bool)
 		"--dns", "dns_cf",
 	}, domainArgs...)...)
 
-	cmd.Env = append(os.Environ(),
-		fmt.Sprintf("CF_Key=%s", acc.Key),
-		fmt.Sprintf("CF_Email=%s", acc.Email),
-	)
+	cmd.Env = append(os.Environ(), acmeCredentialEnv(acc, domain)...)
 
 	steps = append(steps, "→ 调用 acme.sh 申请证书...")
 	output, err := cmd.CombinedOutput()
@@ -127,6 +126,53 @@ func applyCertificate(acc *models.Account, domain string, includeWildcard bool)
 	return installExistingCert(acmeShPath, domain, certDir, includeWildcard, steps)
 }
 
+func planCertificate(acc *models.Account, domain string, includeWildcard bool) (bool, string, []string) {
+	acmeShPath := os.Getenv("HOME") + "/.acme.sh/acme.sh"
+	if _, err := os.Stat(acmeShPath); os.IsNotExist(err) {
+		return false, "acme.sh not installed", nil
+	}
+
+	if _, err := getZoneID(acc, domain); err != nil {
+		return false, err.Error(), nil
+	}
+
+	domainList := domain
+	if includeWildcard {
+		domainList = domain + " + *." + domain
+	}
+	plan := []string{
+		fmt.Sprintf("issue certificate for %s via acme.sh (dns_cf)", domainList),
+		fmt.Sprintf("install certificate to %s", filepath.Join("certs", domain)),
+	}
+	return true, dryRunMessage(len(plan)), plan
+}
+
+func acmeCredentialEnv(acc *models.Account, domain string) []string {
+	if !acc.UsesAPIToken() {
+		return []string{
+			fmt.Sprintf("CF_Key=%s", acc.Key),
+			fmt.Sprintf("CF_Email=%s", acc.Email),
+		}
+	}
+
+	env := []string{fmt.Sprintf("CF_Token=%s", acc.Key)}
+	accountID := acc.CFAccountID
+	if accountID == "" {
+		var zones []struct {
+			Account struct {
+				ID string `json:"id"`
+			} `json:"account"`
+		}
+		if _, err := newCFClient(acc).Get("/zones", url.Values{"name": {domain}}, &zones); err == nil && len(zones) > 0 {
+			accountID = zones[0].Account.ID
+		}
+	}
+	if accountID != "" {
+		env = append(env, fmt.Sprintf("CF_Account_ID=%s", accountID))
+	}
+	return env
+}
+
 func installExistingCert(acmeShPath, domain, certDir string, includeWildcard bool, steps []string) (bool, string, []string, string) {
 	domainArgs := []string{"-d", domain}
 	if includeWildcard {
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"cloudflare-tools/server/cfapi"
+	"cloudflare-tools/server/config"
+	"cloudflare-tools/server/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// itemStats maps the per-item account copies made by runBatch to the retry
+// counters of that item, so every client built for it reports into one place.
+var itemStats sync.Map
+
+func newCFClient(acc *models.Account) *cfapi.Client {
+	var client *cfapi.Client
+	if acc.UsesAPIToken() {
+		client = cfapi.NewTokenClient(acc.Key)
+	} else {
+		client = cfapi.NewClient(acc.Email, acc.Key)
+	}
+	cfg := config.GlobalConfig.Cloudflare
+	if base := cfg.APIBaseURL; base != "" {
+		client.BaseURL = base
+	}
+	if timeout := cfg.Timeout; timeout > 0 {
+		client.HTTPClient.Timeout = time.Duration(timeout) * time.Second
+	}
+
+	client.Limiter = cfapi.LimiterFor(credentialKey(acc), cfg.RateLimit, maxConcurrency())
+	client.MaxRetries = cfapi.DefaultMaxRetries
+	if cfg.MaxRetries > 0 {
+		client.MaxRetries = cfg.MaxRetries
+	}
+	if stats, ok := itemStats.Load(acc); ok {
+		client.Stats = stats.(*cfapi.Stats)
+	}
+	return client
+}
+
+func credentialKey(acc *models.Account) string {
+	sum := sha256.Sum256([]byte(acc.AuthType + "|" + acc.Email + "|" + acc.Key))
+	return hex.EncodeToString(sum[:])
+}
+
+func maxConcurrency() int {
+	if n := config.GlobalConfig.Cloudflare.MaxConcurrency; n > 0 {
+		return n
+	}
+	return cfapi.DefaultMaxConcurrency
+}
+
+// retriesFor reports how many throttled requests were retried for a batch item.
+func retriesFor(acc *models.Account) int {
+	if stats, ok := itemStats.Load(acc); ok {
+		return stats.(*cfapi.Stats).Retries()
+	}
+	return 0
+}
@@ -1,14 +1,15 @@
 package handler
 
 import (
-	"bytes"
+	"cloudflare-tools/server/cfapi"
 	"cloudflare-tools/server/models"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,10 +17,17 @@ import (
 type BatchParseDNSRequest struct {
 	AccountID  string   `json:"accountId"`
 	Records    []string `json:"records"`
+	Items      []DNSRecord `json:"items"`
 	TTL        int      `json:"ttl"`
 	Proxied    bool     `json:"proxied"`
 	DeleteOld  bool     `json:"deleteOld"`
+	// Upsert updates existing records in place instead of deleting them,
+	// applying each zone's changes in one transaction
+	Upsert      bool    `json:"upsert"`
+	// Verify checks each added record on the zone's nameservers
+	Verify      bool    `json:"verify"`
 	OfflineMode bool    `json:"offlineMode"`
+	DryRun      bool    `json:"dryRun"`
 }
 
 type BatchDeleteDNSRequest struct {
@@ -28,6 +36,9 @@ type BatchDeleteDNSRequest struct {
 	RecordType string  `json:"recordType"`
 	HostRecord string  `json:"hostRecord"`
 	DeleteAll  bool    `json:"deleteAll"`
+	// RecordIDs limits the deletion to these records, e.g. scanner findings
+	RecordIDs  []string `json:"recordIds"`
+	DryRun     bool    `json:"dryRun"`
 }
 
 type BatchProxyToggleRequest struct {
@@ -36,6 +47,8 @@ type BatchProxyToggleRequest struct {
 	RecordType string   `json:"recordType"`
 	HostRecord string   `json:"hostRecord"`
 	ProxyStatus bool    `json:"proxyStatus"`
+	DryRun      bool    `json:"dryRun"`
+	Verify      bool    `json:"verify"`
 }
 
 type DNSRecord struct {
@@ -43,6 +56,12 @@ type DNSRecord struct {
 	Host   string `json:"host"`
 	Type   string `json:"type"`
 	Value  string `json:"value"`
+	// structured fields for MX/SRV/CAA/HTTPS/SVCB; TTL and Proxied override
+	// the request-wide settings when set
+	Priority *int                   `json:"priority,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	TTL      int                    `json:"ttl,omitempty"`
+	Proxied  *bool                  `json:"proxied,omitempty"`
 }
 
 type DNSResult struct {
@@ -52,6 +71,9 @@ type DNSResult struct {
 	Value  string `json:"value"`
 	Success bool  `json:"success"`
 	Message string `json:"message"`
+	Retries int    `json:"retries,omitempty"`
+	Plan    []string `json:"plan,omitempty"`
+	Verification *DNSCheckResult `json:"verification,omitempty"`
 }
 
 type DeleteResult struct {
@@ -59,6 +81,8 @@ type DeleteResult struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 	Count   int    `json:"count"`
+	Retries int    `json:"retries,omitempty"`
+	Plan    []string `json:"plan,omitempty"`
 }
 
 type ProxyToggleResult struct {
@@ -66,6 +90,85 @@ type ProxyToggleResult struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 	Count   int    `json:"count"`
+	Retries int    `json:"retries,omitempty"`
+	Plan    []string `json:"plan,omitempty"`
+	Verification []DNSCheckResult `json:"verification,omitempty"`
+}
+
+// cfDNSRecord is a DNS record as returned by the Cloudflare API.
+type cfDNSRecord struct {
+	ID       string                 `json:"id"`
+	Type     string                 `json:"type"`
+	Name     string                 `json:"name"`
+	Content  string                 `json:"content"`
+	Proxied  bool                   `json:"proxied"`
+	TTL      int                    `json:"ttl"`
+	Comment  string                 `json:"comment,omitempty"`
+	Priority *int                   `json:"priority,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	Tags     []string               `json:"tags,omitempty"`
+}
+
+func (r cfDNSRecord) describe() string {
+	content := r.Content
+	if content == "" && r.Data != nil {
+		data, _ := json.Marshal(r.Data)
+		content = string(data)
+	}
+	return fmt.Sprintf("%s %s -> %s", r.Type, r.Name, content)
+}
+
+func (r cfDNSRecord) proxiable() bool {
+	return r.Type == "A" || r.Type == "AAAA" || r.Type == "CNAME"
+}
+
+// payload is the body that recreates the record, or overwrites another record
+// with its values, via POST/PUT.
+func (r cfDNSRecord) payload() map[string]interface{} {
+	payload := map[string]interface{}{
+		"type": r.Type,
+		"name": r.Name,
+		"ttl":  r.TTL,
+	}
+	if r.Data != nil {
+		payload["data"] = r.Data
+	} else {
+		payload["content"] = r.Content
+	}
+	if r.proxiable() {
+		payload["proxied"] = r.Proxied
+	}
+	if r.Priority != nil {
+		payload["priority"] = *r.Priority
+	}
+	if r.Comment != "" {
+		payload["comment"] = r.Comment
+	}
+	if len(r.Tags) > 0 {
+		payload["tags"] = r.Tags
+	}
+	return payload
+}
+
+// listDNSRecords returns every record in the zone matching query, following
+// pagination.
+func listDNSRecords(acc *models.Account, zoneID string, query url.Values) ([]cfDNSRecord, error) {
+	return cfapi.GetAll[cfDNSRecord](newCFClient(acc), fmt.Sprintf("/zones/%s/dns_records", zoneID), query, 100)
+}
+
+// recordFQDN expands a host record as entered in the UI ("www", "@", "*") to
+// the full name the API filters on. Names that are already absolute are kept.
+func recordFQDN(host string, domain string) string {
+	host = strings.TrimSuffix(strings.TrimSpace(host), ".")
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if host == "" || host == "@" {
+		return domain
+	}
+	lower := strings.ToLower(host)
+	if lower == domain || strings.HasSuffix(lower, "."+domain) {
+		return host
+	}
+	return host + "." + domain
 }
 
 func BatchParseDNS(c *gin.Context) {
@@ -75,48 +178,71 @@ func BatchParseDNS(c *gin.Context) {
 		return
 	}
 
-	var acc *models.Account
-	for _, a := range models.Accounts {
-		if a.ID == req.AccountID {
-			acc = &a
-			break
-		}
+	records := append(parseRecords(req.Records), req.Items...)
+	if len(records) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid records"})
+		return
 	}
-
-	if acc == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	if !normalizeRecordDomains(c, records) {
 		return
 	}
 
-	records := parseRecords(req.Records)
-	if len(records) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid records"})
+	domains := make([]string, len(records))
+	for i, r := range records {
+		domains[i] = r.Domain
+	}
+	route := routeBatch(c, req.AccountID, domains)
+	if route == nil {
 		return
 	}
 
-	results := make([]DNSResult, len(records))
-	var wg sync.WaitGroup
-
-	for i, record := range records {
-		wg.Add(1)
-		go func(idx int, rec DNSRecord) {
-			defer wg.Done()
-			success, msg := addDNSRecord(acc, rec, req.TTL, req.Proxied, req.DeleteOld)
-			results[idx] = DNSResult{
-				Domain:  rec.Domain,
-				Host:    rec.Host,
-				Type:    rec.Type,
-				Value:   rec.Value,
-				Success: success,
-				Message: msg,
+	var upserts map[string]*zoneUpsert
+	if req.Upsert {
+		upserts = groupUpserts(records)
+	}
+
+	var verify func(idx int, acc *models.Account, result *DNSResult, wait time.Duration)
+	if req.Verify && !req.DryRun {
+		verify = func(idx int, acc *models.Account, result *DNSResult, wait time.Duration) {
+			if result.Success {
+				result.Verification = verifyAddedRecord(acc, records[idx], req.TTL, req.Proxied, wait)
 			}
-		}(i, record)
+		}
 	}
 
-	wg.Wait()
-	c.JSON(http.StatusOK, results)
+	runVerifiedBatch(c, "dns.batch-parse", route, &req, len(records), func(idx int, acc *models.Account) DNSResult {
+		rec := records[idx]
+		var (
+			success bool
+			msg     string
+			plan    []string
+		)
+		switch {
+		case req.Upsert:
+			success, msg, plan = upsertFor(upserts, rec).result(acc, records, idx, req.TTL, req.Proxied, req.DryRun)
+		case req.DryRun:
+			success, msg, plan = planDNSRecord(acc, rec, req.TTL, req.Proxied, req.DeleteOld)
+		default:
+			success, msg = addDNSRecord(acc, rec, req.TTL, req.Proxied, req.DeleteOld)
+		}
+		return DNSResult{
+			Domain:  rec.Domain,
+			Host:    rec.Host,
+			Type:    rec.Type,
+			Value:   rec.Value,
+			Success: success,
+			Message: msg,
+			Plan:    plan,
+			Retries: retriesFor(acc),
+		}
+	}, verifyWait(), verify)
 }
 
+// parseRecords reads "domain|host|type|value" lines, where host may list
+// several hosts separated by commas. MX records may append
+// the priority as a fifth field ("...|MX|mail.example.com|10") or give the
+// value as "10 mail.example.com"; SRV, CAA and HTTPS values use zone file
+// presentation form.
 func parseRecords(lines []string) []DNSRecord {
 	var records []DNSRecord
 	for _, line := range lines {
@@ -124,128 +250,94 @@ func parseRecords(lines []string) []DNSRecord {
 		if len(parts) < 4 {
 			continue
 		}
-		records = append(records, DNSRecord{
+		record := DNSRecord{
 			Domain: strings.TrimSpace(parts[0]),
-			Host:   strings.TrimSpace(parts[1]),
-			Type:   strings.TrimSpace(parts[2]),
-			Value:  strings.TrimSpace(parts[3]),
-		})
+			Type:   strings.ToUpper(strings.TrimSpace(parts[2])),
+			Value:  strings.TrimSpace(strings.Join(parts[3:], "|")),
+		}
+		if record.Type == "MX" && len(parts) == 5 {
+			if prio, err := strconv.Atoi(strings.TrimSpace(parts[4])); err == nil {
+				record.Value = strings.TrimSpace(parts[3])
+				record.Priority = &prio
+			}
+		}
+		// "www,m,@" adds the same record for several hosts
+		for _, host := range strings.Split(parts[1], ",") {
+			record.Host = strings.TrimSpace(host)
+			records = append(records, record)
+		}
 	}
 	return records
 }
 
 func addDNSRecord(acc *models.Account, record DNSRecord, ttl int, proxied bool, deleteOld bool) (bool, string) {
-	zoneID, err := getZoneID(acc, record.Domain)
+	rec, err := record.prepare(ttl, proxied)
 	if err != nil {
 		return false, err.Error()
 	}
 
-	if deleteOld {
-		deleteExistingRecords(acc, zoneID, record.Host, record.Type)
-	}
-
-	if ttl == 0 {
-		ttl = 1
-	}
-
-	payload := map[string]interface{}{
-		"type":    record.Type,
-		"name":    record.Host,
-		"content": record.Value,
-		"ttl":     ttl,
-		"proxied": proxied,
-	}
-	body, _ := json.Marshal(payload)
-
-	req, _ := http.NewRequest("POST", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records", zoneID), bytes.NewBuffer(body))
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-	req.Header.Add("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	zoneID, err := getZoneID(acc, record.Domain)
 	if err != nil {
-		return false, "Request failed"
-	}
-	defer resp.Body.Close()
-
-	respBody, _ := ioutil.ReadAll(resp.Body)
-	if resp.StatusCode == http.StatusOK {
-		return true, "Success"
+		return false, err.Error()
 	}
 
-	var errorRes struct {
-		Errors []struct {
-			Message string `json:"message"`
-		} `json:"errors"`
+	if deleteOld {
+		if err := deleteExistingRecords(acc, record.Domain, zoneID, recordFQDN(record.Host, record.Domain), rec.Type); err != nil {
+			return false, err.Error()
+		}
 	}
-	json.Unmarshal(respBody, &errorRes)
 
-	msg := "Unknown error"
-	if len(errorRes.Errors) > 0 {
-		msg = errorRes.Errors[0].Message
-	} else {
-		msg = fmt.Sprintf("HTTP %d", resp.StatusCode)
+	if _, err := newCFClient(acc).Post(fmt.Sprintf("/zones/%s/dns_records", zoneID), rec.payload(), nil); err != nil {
+		return false, err.Error()
 	}
-
-	return false, msg
+	return true, "Success"
 }
 
-func getZoneID(acc *models.Account, domain string) (string, error) {
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones?name=%s", domain), nil)
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("Request failed")
+// deleteExistingRecords removes the records a new one replaces. Listing
+// failures are ignored, but nothing is deleted unless a snapshot was saved.
+func deleteExistingRecords(acc *models.Account, domain string, zoneID string, name string, recordType string) error {
+	records, err := listDNSRecords(acc, zoneID, url.Values{"name": {name}, "type": {recordType}})
+	if err != nil || len(records) == 0 {
+		return nil
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		Result []struct {
-			ID string `json:"id"`
-		} `json:"result"`
+	if err := snapshotRecords(acc, domain, zoneID, "dns.delete-old", records); err != nil {
+		return err
 	}
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
-
-	if len(result.Result) == 0 {
-		return "", fmt.Errorf("Zone not found")
+	client := newCFClient(acc)
+	for _, record := range records {
+		client.Delete(fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, record.ID), nil)
 	}
-
-	return result.Result[0].ID, nil
+	return nil
 }
 
-func deleteExistingRecords(acc *models.Account, zoneID string, name string, recordType string) {
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records?name=%s&type=%s", zoneID, name, recordType), nil)
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// planDNSRecord describes what addDNSRecord would do for record.
+func planDNSRecord(acc *models.Account, record DNSRecord, ttl int, proxied bool, deleteOld bool) (bool, string, []string) {
+	rec, err := record.prepare(ttl, proxied)
 	if err != nil {
-		return
+		return false, err.Error(), nil
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		Result []struct {
-			ID string `json:"id"`
-		} `json:"result"`
+	zoneID, err := getZoneID(acc, record.Domain)
+	if err != nil {
+		return false, err.Error(), nil
 	}
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
-
-	for _, record := range result.Result {
-		delReq, _ := http.NewRequest("DELETE", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records/%s", zoneID, record.ID), nil)
-		delReq.Header.Add("X-Auth-Email", acc.Email)
-		delReq.Header.Add("X-Auth-Key", acc.Key)
-		client.Do(delReq)
+	var plan []string
+	if deleteOld {
+		existing, err := listDNSRecords(acc, zoneID, url.Values{"name": {recordFQDN(record.Host, record.Domain)}, "type": {rec.Type}})
+		if err != nil {
+			return false, err.Error(), nil
+		}
+		for _, r := range existing {
+			plan = append(plan, "delete "+r.describe())
+		}
 	}
+
+	rec.Name = recordFQDN(record.Host, record.Domain)
+	plan = append(plan, fmt.Sprintf("create %s (ttl %d, proxied %t)", rec.describe(), rec.TTL, rec.Proxied))
+	return true, dryRunMessage(len(plan)), plan
 }
 
 func BatchDeleteDNS(c *gin.Context) {
@@ -255,16 +347,13 @@ func BatchDeleteDNS(c *gin.Context) {
 		return
 	}
 
-	var acc *models.Account
-	for _, a := range models.Accounts {
-		if a.ID == req.AccountID {
-			acc = &a
-			break
-		}
+	subdomains, ok := normalizeRecordTargets(c, &req.Domains)
+	if !ok {
+		return
 	}
 
-	if acc == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	route := routeBatch(c, req.AccountID, req.Domains)
+	if route == nil {
 		return
 	}
 
@@ -273,92 +362,127 @@ func BatchDeleteDNS(c *gin.Context) {
 		return
 	}
 
-	results := make([]DeleteResult, len(req.Domains))
-	var wg sync.WaitGroup
-
-	for i, domain := range req.Domains {
-		wg.Add(1)
-		go func(idx int, dom string) {
-			defer wg.Done()
-			success, msg, count := deleteDNSRecords(acc, dom, req.RecordType, req.HostRecord, req.DeleteAll)
-			results[idx] = DeleteResult{
-				Domain:  dom,
-				Success: success,
-				Message: msg,
-				Count:   count,
+	runRoutedBatch(c, "dns.batch-delete", route, &req, len(req.Domains), func(idx int, acc *models.Account) DeleteResult {
+		dom := req.Domains[idx]
+		recordType, host, all := req.RecordType, req.HostRecord, req.DeleteAll
+		// for a subdomain, deleteAll means every record of that name
+		if sub := subdomains[idx]; sub != "" {
+			if all {
+				recordType, host, all = "", "", false
 			}
-		}(i, domain)
-	}
-
-	wg.Wait()
-	c.JSON(http.StatusOK, results)
+			host = underSubdomain(host, sub, dom)
+		}
+		var (
+			success bool
+			msg     string
+			count   int
+			plan    []string
+		)
+		if req.DryRun {
+			success, msg, count, plan = planDeleteDNSRecords(acc, dom, recordType, host, all, req.RecordIDs)
+		} else {
+			success, msg, count = deleteDNSRecords(acc, dom, recordType, host, all, req.RecordIDs)
+		}
+		return DeleteResult{
+			Domain:  recordFQDN(subdomains[idx], dom),
+			Success: success,
+			Message: msg,
+			Count:   count,
+			Retries: retriesFor(acc),
+			Plan:    plan,
+		}
+	})
 }
 
-func deleteDNSRecords(acc *models.Account, domain string, recordType string, hostRecord string, deleteAll bool) (bool, string, int) {
-	zoneID, err := getZoneID(acc, domain)
+func deleteDNSRecords(acc *models.Account, domain string, recordType string, hostRecord string, deleteAll bool, recordIDs []string) (bool, string, int) {
+	zoneID, records, err := matchDNSRecords(acc, domain, recordType, hostRecord, deleteAll)
 	if err != nil {
 		return false, err.Error(), 0
 	}
+	records = filterRecordIDs(records, recordIDs)
 
-	var url string
-	if deleteAll {
-		url = fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records", zoneID)
-	} else {
-		url = fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records", zoneID)
-		if recordType != "" {
-			url += "?type=" + recordType
-		}
-		if hostRecord != "" {
-			if recordType != "" {
-				url += "&name=" + hostRecord
-			} else {
-				url += "?name=" + hostRecord
-			}
+	if len(records) == 0 {
+		return false, "No records found", 0
+	}
+
+	if err := snapshotRecords(acc, domain, zoneID, "dns.batch-delete", records); err != nil {
+		return false, err.Error(), 0
+	}
+
+	client := newCFClient(acc)
+	count := 0
+	for _, record := range records {
+		if _, err := client.Delete(fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, record.ID), nil); err == nil {
+			count++
 		}
 	}
 
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
+	if count > 0 {
+		return true, fmt.Sprintf("Deleted %d records", count), count
+	}
+	return false, "Failed to delete records", 0
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func planDeleteDNSRecords(acc *models.Account, domain string, recordType string, hostRecord string, deleteAll bool, recordIDs []string) (bool, string, int, []string) {
+	_, records, err := matchDNSRecords(acc, domain, recordType, hostRecord, deleteAll)
 	if err != nil {
-		return false, "Request failed", 0
+		return false, err.Error(), 0, nil
 	}
-	defer resp.Body.Close()
+	records = filterRecordIDs(records, recordIDs)
 
-	var result struct {
-		Result []struct {
-			ID string `json:"id"`
-		} `json:"result"`
+	if len(records) == 0 {
+		return false, "No records found", 0, nil
 	}
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
+	plan := make([]string, 0, len(records))
+	for _, record := range records {
+		plan = append(plan, record.describe())
+	}
+	return true, fmt.Sprintf("Dry run: would delete %d records", len(records)), len(records), plan
+}
 
-	if len(result.Result) == 0 {
-		return false, "No records found", 0
+// matchDNSRecords resolves the zone for domain and lists the records that the
+// type and host filters select. With all set every record in the zone matches.
+func matchDNSRecords(acc *models.Account, domain string, recordType string, hostRecord string, all bool) (string, []cfDNSRecord, error) {
+	zoneID, err := getZoneID(acc, domain)
+	if err != nil {
+		return "", nil, err
 	}
 
-	count := 0
-	for _, record := range result.Result {
-		delReq, _ := http.NewRequest("DELETE", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records/%s", zoneID, record.ID), nil)
-		delReq.Header.Add("X-Auth-Email", acc.Email)
-		delReq.Header.Add("X-Auth-Key", acc.Key)
-		delResp, err := client.Do(delReq)
-		if err == nil && delResp.StatusCode == http.StatusOK {
-			count++
+	query := url.Values{}
+	if !all {
+		if recordType != "" {
+			query.Set("type", recordType)
 		}
-		if delResp != nil {
-			delResp.Body.Close()
+		if hostRecord != "" {
+			query.Set("name", recordFQDN(hostRecord, domain))
 		}
 	}
 
-	if count > 0 {
-		return true, fmt.Sprintf("Deleted %d records", count), count
+	records, err := listDNSRecords(acc, zoneID, query)
+	if err != nil {
+		return "", nil, err
 	}
-	return false, "Failed to delete records", 0
+	return zoneID, records, nil
+}
+
+// filterRecordIDs keeps the records whose ID is listed; an empty list keeps
+// them all.
+func filterRecordIDs(records []cfDNSRecord, ids []string) []cfDNSRecord {
+	if len(ids) == 0 {
+		return records
+	}
+	wanted := map[string]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var kept []cfDNSRecord
+	for _, r := range records {
+		if wanted[r.ID] {
+			kept = append(kept, r)
+		}
+	}
+	return kept
 }
 
 func BatchProxyToggle(c *gin.Context) {
@@ -368,16 +492,13 @@ func BatchProxyToggle(c *gin.Context) {
 		return
 	}
 
-	var acc *models.Account
-	for _, a := range models.Accounts {
-		if a.ID == req.AccountID {
-			acc = &a
-			break
-		}
+	subdomains, ok := normalizeRecordTargets(c, &req.Domains)
+	if !ok {
+		return
 	}
 
-	if acc == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	route := routeBatch(c, req.AccountID, req.Domains)
+	if route == nil {
 		return
 	}
 
@@ -386,91 +507,72 @@ func BatchProxyToggle(c *gin.Context) {
 		return
 	}
 
-	results := make([]ProxyToggleResult, len(req.Domains))
-	var wg sync.WaitGroup
-
-	for i, domain := range req.Domains {
-		wg.Add(1)
-		go func(idx int, dom string) {
-			defer wg.Done()
-			success, msg, count := toggleProxyStatus(acc, dom, req.RecordType, req.HostRecord, req.ProxyStatus)
-			results[idx] = ProxyToggleResult{
-				Domain:  dom,
-				Success: success,
-				Message: msg,
-				Count:   count,
+	var verify func(idx int, acc *models.Account, result *ProxyToggleResult, wait time.Duration)
+	if req.Verify && !req.DryRun {
+		verify = func(idx int, acc *models.Account, result *ProxyToggleResult, wait time.Duration) {
+			if result.Success {
+				host := underSubdomain(req.HostRecord, subdomains[idx], req.Domains[idx])
+				result.Verification = verifyProxyToggle(acc, req.Domains[idx], req.RecordType, host, wait)
 			}
-		}(i, domain)
+		}
 	}
 
-	wg.Wait()
-	c.JSON(http.StatusOK, results)
+	runVerifiedBatch(c, "dns.proxy-toggle", route, &req, len(req.Domains), func(idx int, acc *models.Account) ProxyToggleResult {
+		dom := req.Domains[idx]
+		host := underSubdomain(req.HostRecord, subdomains[idx], dom)
+		var (
+			success bool
+			msg     string
+			count   int
+			plan    []string
+		)
+		if req.DryRun {
+			success, msg, count, plan = planProxyToggle(acc, dom, req.RecordType, host, req.ProxyStatus)
+		} else {
+			success, msg, count = toggleProxyStatus(acc, dom, req.RecordType, host, req.ProxyStatus)
+		}
+		return ProxyToggleResult{
+			Domain:  recordFQDN(subdomains[idx], dom),
+			Success: success,
+			Message: msg,
+			Count:   count,
+			Plan:    plan,
+			Retries: retriesFor(acc),
+		}
+	}, verifyWait(), verify)
 }
 
 func toggleProxyStatus(acc *models.Account, domain string, recordType string, hostRecord string, proxyStatus bool) (bool, string, int) {
-	zoneID, err := getZoneID(acc, domain)
+	zoneID, records, err := matchDNSRecords(acc, domain, recordType, hostRecord, false)
 	if err != nil {
 		return false, err.Error(), 0
 	}
 
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records", zoneID)
-	params := []string{}
-	if recordType != "" {
-		params = append(params, "type="+recordType)
-	}
-	if hostRecord != "" {
-		params = append(params, "name="+hostRecord)
-	}
-	if len(params) > 0 {
-		url += "?" + strings.Join(params, "&")
+	if len(records) == 0 {
+		return false, "No records found", 0
 	}
 
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, "Request failed", 0
+	var proxiable []cfDNSRecord
+	for _, record := range records {
+		if record.proxiable() {
+			proxiable = append(proxiable, record)
+		}
 	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Result []struct {
-			ID      string `json:"id"`
-			Type    string `json:"type"`
-			Proxied bool   `json:"proxied"`
-		} `json:"result"`
+	if len(proxiable) == 0 {
+		return false, "No proxiable records found", 0
 	}
-
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
-
-	if len(result.Result) == 0 {
-		return false, "No records found", 0
+	if err := snapshotRecords(acc, domain, zoneID, "dns.proxy-toggle", proxiable); err != nil {
+		return false, err.Error(), 0
 	}
 
+	client := newCFClient(acc)
 	count := 0
-	for _, record := range result.Result {
-		if record.Type == "A" || record.Type == "AAAA" || record.Type == "CNAME" {
-			payload := map[string]interface{}{
-				"proxied": proxyStatus,
-			}
-			patchBody, _ := json.Marshal(payload)
-
-			patchReq, _ := http.NewRequest("PATCH", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records/%s", zoneID, record.ID), bytes.NewBuffer(patchBody))
-			patchReq.Header.Add("X-Auth-Email", acc.Email)
-			patchReq.Header.Add("X-Auth-Key", acc.Key)
-			patchReq.Header.Add("Content-Type", "application/json")
-
-			patchResp, err := client.Do(patchReq)
-			if err == nil && patchResp.StatusCode == http.StatusOK {
-				count++
-			}
-			if patchResp != nil {
-				patchResp.Body.Close()
-			}
+	for _, record := range proxiable {
+		payload := map[string]interface{}{
+			"proxied": proxyStatus,
+		}
+		if _, err := client.Patch(fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, record.ID), payload, nil); err == nil {
+			count++
 		}
 	}
 
@@ -481,5 +583,33 @@ func toggleProxyStatus(acc *models.Account, domain string, recordType string, ho
 		}
 		return true, fmt.Sprintf("%s代理 %d 条记录", status, count), count
 	}
-	return false, "No proxiable records found", 0
+	return false, "Failed to update records", 0
+}
+
+func planProxyToggle(acc *models.Account, domain string, recordType string, hostRecord string, proxyStatus bool) (bool, string, int, []string) {
+	_, records, err := matchDNSRecords(acc, domain, recordType, hostRecord, false)
+	if err != nil {
+		return false, err.Error(), 0, nil
+	}
+
+	if len(records) == 0 {
+		return false, "No records found", 0, nil
+	}
+
+	var plan []string
+	for _, record := range records {
+		if !record.proxiable() {
+			continue
+		}
+		if record.Proxied == proxyStatus {
+			plan = append(plan, fmt.Sprintf("%s %s: proxied %t (unchanged)", record.Type, record.Name, record.Proxied))
+		} else {
+			plan = append(plan, fmt.Sprintf("%s %s: proxied %t -> %t", record.Type, record.Name, record.Proxied, proxyStatus))
+		}
+	}
+
+	if len(plan) == 0 {
+		return false, "No proxiable records found", 0, nil
+	}
+	return true, fmt.Sprintf("Dry run: would update %d records", len(plan)), len(plan), plan
 }
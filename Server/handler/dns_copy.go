@@ -0,0 +1,336 @@
+package handler
+
+import (
+	"cloudflare-tools/server/models"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BatchCopyDNSRequest struct {
+	// SourceAccountID holds the source zone and defaults to AccountID, the
+	// account of the target zones
+	SourceAccountID string   `json:"sourceAccountId"`
+	AccountID       string   `json:"accountId"`
+	SourceDomain    string   `json:"sourceDomain"`
+	TargetDomains   []string `json:"targetDomains"`
+	// Types limits the copy to these record types
+	Types []string `json:"types"`
+	// Mode decides what happens to target records with the same name and
+	// type: skip (default) leaves them alone, overwrite replaces them with
+	// the source records and merge adds the source values next to them
+	Mode         string `json:"mode"`
+	KeepProxied  bool   `json:"keepProxied"`
+	KeepComments bool   `json:"keepComments"`
+	// RewriteTargets also moves CNAME/MX/NS/SRV targets under the source
+	// apex to the target apex
+	RewriteTargets bool `json:"rewriteTargets"`
+	DryRun         bool `json:"dryRun"`
+}
+
+type CopyDNSResult struct {
+	Domain    string   `json:"domain"`
+	Success   bool     `json:"success"`
+	Message   string   `json:"message"`
+	Created   int      `json:"created"`
+	Updated   int      `json:"updated"`
+	Deleted   int      `json:"deleted"`
+	Skipped   int      `json:"skipped"`
+	Unchanged int      `json:"unchanged"`
+	Retries   int      `json:"retries,omitempty"`
+	Plan      []string `json:"plan,omitempty"`
+}
+
+// BatchCopyDNS copies the records of a zone to other zones, possibly in
+// another account, renaming them from the source apex to each target apex.
+// Each target zone is written in one transaction.
+func BatchCopyDNS(c *gin.Context) {
+	var req BatchCopyDNSRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !normalizeZones(c, &req.TargetDomains) {
+		return
+	}
+	source := []string{req.SourceDomain}
+	if !normalizeZones(c, &source) {
+		return
+	}
+	if len(source) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source domain is required"})
+		return
+	}
+	sourceDomain := source[0]
+
+	acc := findAccount(req.AccountID)
+	if acc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+	srcAcc := acc
+	if req.SourceAccountID != "" {
+		if srcAcc = findAccount(req.SourceAccountID); srcAcc == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Source account not found"})
+			return
+		}
+	}
+
+	switch req.Mode {
+	case "":
+		req.Mode = "skip"
+	case "skip", "overwrite", "merge":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mode must be skip, overwrite or merge"})
+		return
+	}
+
+	sourceZoneID, err := getZoneID(srcAcc, sourceDomain)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source domain not found"})
+		return
+	}
+	records, err := listDNSRecords(srcAcc, sourceZoneID, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	runBatch(c, "dns.copy", acc, &req, len(req.TargetDomains), func(idx int, acc *models.Account) CopyDNSResult {
+		dom := strings.ToLower(strings.TrimSpace(req.TargetDomains[idx]))
+		var result CopyDNSResult
+		if dom == sourceDomain && acc.ID == srcAcc.ID {
+			result = CopyDNSResult{Domain: dom, Message: "Target is the source zone"}
+		} else {
+			result = copyDNSToZone(acc, dom, copyDNSRecords(records, sourceDomain, dom, &req), req.Mode, req.DryRun)
+		}
+		result.Retries = retriesFor(acc)
+		return result
+	})
+}
+
+// copyDNSRecords turns the source records into the records wanted in the
+// target zone. The apex NS records are managed by Cloudflare and left out.
+func copyDNSRecords(source []cfDNSRecord, sourceDomain string, targetDomain string, req *BatchCopyDNSRequest) []wantedRecord {
+	types := map[string]bool{}
+	for _, t := range req.Types {
+		types[strings.ToUpper(strings.TrimSpace(t))] = true
+	}
+
+	var wanted []wantedRecord
+	for _, r := range source {
+		if len(types) > 0 && !types[r.Type] {
+			continue
+		}
+		if r.Type == "NS" && strings.EqualFold(r.Name, sourceDomain) {
+			continue
+		}
+		rec := cfDNSRecord{
+			Type:     r.Type,
+			Name:     rewriteApex(r.Name, sourceDomain, targetDomain),
+			Content:  r.Content,
+			TTL:      r.TTL,
+			Priority: r.Priority,
+			Data:     r.Data,
+		}
+		if req.KeepProxied {
+			rec.Proxied = r.Proxied
+		}
+		if req.KeepComments {
+			rec.Comment = r.Comment
+		}
+		if req.RewriteTargets {
+			switch r.Type {
+			case "CNAME", "MX", "NS":
+				rec.Content = rewriteApex(r.Content, sourceDomain, targetDomain)
+			case "SRV":
+				if target, ok := r.Data["target"].(string); ok {
+					data := map[string]interface{}{}
+					for k, v := range r.Data {
+						data[k] = v
+					}
+					data["target"] = rewriteApex(target, sourceDomain, targetDomain)
+					rec.Data = data
+				}
+			}
+		}
+		if rec.TTL == 0 || rec.Proxied {
+			rec.TTL = 1
+		}
+		wanted = append(wanted, wantedRecord{cfDNSRecord: rec})
+	}
+	return wanted
+}
+
+// rewriteApex moves name from the from zone to the to zone; names outside
+// the zone are returned as they are.
+func rewriteApex(name string, from string, to string) string {
+	lower := strings.ToLower(strings.TrimSuffix(name, "."))
+	if lower == from {
+		return to
+	}
+	if strings.HasSuffix(lower, "."+from) {
+		return lower[:len(lower)-len(from)] + to
+	}
+	return name
+}
+
+func copyDNSToZone(acc *models.Account, domain string, wanted []wantedRecord, mode string, dryRun bool) CopyDNSResult {
+	result := CopyDNSResult{Domain: domain}
+
+	zoneID, err := getZoneID(acc, domain)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	current, err := listDNSRecords(acc, zoneID, nil)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	plan, skipped := planDNSCopy(wanted, current, mode)
+	result.Unchanged = plan.unchanged
+	result.Skipped = len(skipped)
+	if err := plan.checkBatchSize(); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	if dryRun {
+		result.Plan = append(plan.describe(), skipped...)
+		result.Success = true
+		result.Created = len(plan.create)
+		result.Updated = len(plan.update)
+		result.Deleted = len(plan.delete)
+		result.Message = dryRunMessage(len(result.Plan))
+		return result
+	}
+
+	if len(plan.create) == 0 && len(plan.update) == 0 && len(plan.delete) == 0 {
+		result.Success = true
+		result.Message = fmt.Sprintf("Nothing to copy, skipped %d", result.Skipped)
+		return result
+	}
+
+	touched := append(append([]cfDNSRecord{}, plan.current...), plan.delete...)
+	if len(touched) > 0 {
+		if err := snapshotRecords(acc, domain, zoneID, "dns.copy", touched); err != nil {
+			result.Message = err.Error()
+			return result
+		}
+	}
+
+	if err := applyDNSBatch(acc, zoneID, plan); err != nil {
+		result.Message = fmt.Sprintf("Batch failed, no records were changed: %v", err)
+		return result
+	}
+
+	result.Success = true
+	result.Created = len(plan.create)
+	result.Updated = len(plan.update)
+	result.Deleted = len(plan.delete)
+	result.Message = fmt.Sprintf("Created %d, updated %d, deleted %d, skipped %d", result.Created, result.Updated, result.Deleted, result.Skipped)
+	return result
+}
+
+// planDNSCopy decides per name and type what to do with the wanted records.
+// Target records of the same name and type conflict, and so do records of
+// any other type at a name that has a CNAME on either side, since a CNAME
+// can't share its name. It returns the plan and a line per skipped record.
+func planDNSCopy(wanted []wantedRecord, current []cfDNSRecord, mode string) (*syncPlan, []string) {
+	live := map[string][]cfDNSRecord{}
+	byName := map[string][]cfDNSRecord{}
+	for _, r := range current {
+		name := strings.ToLower(r.Name)
+		live[name+" "+r.Type] = append(live[name+" "+r.Type], r)
+		byName[name] = append(byName[name], r)
+	}
+
+	groups := map[string][]wantedRecord{}
+	var order []string
+	for _, w := range wanted {
+		key := strings.ToLower(w.Name) + " " + w.Type
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], w)
+	}
+
+	plan := &syncPlan{}
+	deleted := map[string]bool{}
+	var skipped []string
+	skip := func(group []wantedRecord, reason string) {
+		for _, w := range group {
+			skipped = append(skipped, fmt.Sprintf("skip %s (%s)", w.describe(), reason))
+		}
+	}
+
+	for _, key := range order {
+		group := groups[key]
+		name, rtype := strings.ToLower(group[0].Name), group[0].Type
+		existing := live[key]
+
+		// records of other types that can't coexist with this group
+		var blocking []cfDNSRecord
+		for _, r := range byName[name] {
+			if r.Type != rtype && (rtype == "CNAME" || r.Type == "CNAME") {
+				blocking = append(blocking, r)
+			}
+		}
+
+		sub := diffDesiredState(group, existing)
+		switch {
+		case len(existing) == 0 && len(blocking) == 0:
+			plan.create = append(plan.create, sub.create...)
+		case mode == "overwrite":
+			plan.create = append(plan.create, sub.create...)
+			plan.update = append(plan.update, sub.update...)
+			plan.current = append(plan.current, sub.current...)
+			plan.unchanged += sub.unchanged
+			for _, r := range append(sub.unmanaged, blocking...) {
+				if !deleted[r.ID] {
+					deleted[r.ID] = true
+					plan.delete = append(plan.delete, r)
+				}
+			}
+		case len(blocking) > 0:
+			skip(group, fmt.Sprintf("conflicts with %s at the same name", blocking[0].Type))
+		case mode == "merge":
+			merged := mergeDNSCopy(group, existing, plan)
+			if len(merged) > 0 {
+				skip(merged, "only one CNAME is allowed per name")
+			}
+		case len(sub.create) == 0 && len(sub.update) == 0 && len(sub.unmanaged) == 0:
+			plan.unchanged += sub.unchanged
+		default:
+			skip(group, fmt.Sprintf("%d existing records", len(existing)))
+		}
+	}
+	return plan, skipped
+}
+
+// mergeDNSCopy adds the wanted values the target doesn't have yet and keeps
+// the existing records as they are. It returns the records that can't be
+// added next to the existing ones.
+func mergeDNSCopy(group []wantedRecord, existing []cfDNSRecord, plan *syncPlan) []wantedRecord {
+	have := map[string]bool{}
+	for _, r := range existing {
+		have[syncValueKey(r)] = true
+	}
+	var rejected []wantedRecord
+	for _, w := range group {
+		switch {
+		case have[syncValueKey(w.cfDNSRecord)]:
+			plan.unchanged++
+		case w.Type == "CNAME":
+			rejected = append(rejected, w)
+		default:
+			plan.create = append(plan.create, w.cfDNSRecord)
+		}
+	}
+	return rejected
+}
@@ -0,0 +1,362 @@
+package handler
+
+import (
+	"cloudflare-tools/server/models"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dnsRecordFilter selects records across zones. Name is a host ("www", "@",
+// "*") or a full name and is always taken literally, so "*" selects the
+// wildcard record. NamePattern is a glob over full names such as
+// "*.example.com" or "api-*".
+type dnsRecordFilter struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	NamePattern string `json:"namePattern"`
+	Content     string `json:"content"`
+	Proxied     *bool  `json:"proxied"`
+
+	// within limits a pattern to a subdomain and the names below it
+	within string
+}
+
+type ListDNSRecordsRequest struct {
+	AccountID string   `json:"accountId"`
+	Domains   []string `json:"domains"`
+	dnsRecordFilter
+}
+
+type DNSRecordListResult struct {
+	Domain  string        `json:"domain"`
+	Success bool          `json:"success"`
+	Message string        `json:"message"`
+	Count   int           `json:"count"`
+	Records []cfDNSRecord `json:"records"`
+}
+
+// dnsRecordChanges lists the fields PATCH may set; nil fields are left as is.
+type dnsRecordChanges struct {
+	Content *string `json:"content"`
+	TTL     *int    `json:"ttl"`
+	Proxied *bool   `json:"proxied"`
+	Comment *string `json:"comment"`
+}
+
+type UpdateDNSRecordsRequest struct {
+	AccountID string   `json:"accountId"`
+	Domains   []string `json:"domains"`
+	RecordID  string   `json:"recordId"`
+	dnsRecordFilter
+	Set    dnsRecordChanges `json:"set"`
+	DryRun bool             `json:"dryRun"`
+}
+
+type UpdateDNSRecordsResult struct {
+	Domain  string   `json:"domain"`
+	Success bool     `json:"success"`
+	Message string   `json:"message"`
+	Count   int      `json:"count"`
+	Retries int      `json:"retries,omitempty"`
+	Plan    []string `json:"plan,omitempty"`
+}
+
+// ListDNSRecords lists the matching records of every requested zone, or of
+// every zone in the account when no domains are given.
+func ListDNSRecords(c *gin.Context) {
+	var req ListDNSRecordsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	subdomains, ok := normalizeRecordTargets(c, &req.Domains)
+	if !ok {
+		return
+	}
+
+	acc := findAccount(req.AccountID)
+	if acc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	domains, err := domainsOrAllZones(acc, req.Domains)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]DNSRecordListResult, len(domains))
+	forEachBounded(len(domains), func(idx int) {
+		dom := domains[idx]
+		filter := req.dnsRecordFilter.under(subdomainAt(subdomains, idx), dom)
+		result := DNSRecordListResult{Domain: recordFQDN(subdomainAt(subdomains, idx), dom), Records: []cfDNSRecord{}}
+		_, records, err := findDNSRecords(acc, dom, filter)
+		if err != nil {
+			result.Message = err.Error()
+		} else {
+			result.Success = true
+			result.Message = "Success"
+			result.Count = len(records)
+			if records != nil {
+				result.Records = records
+			}
+		}
+		results[idx] = result
+	})
+	c.JSON(http.StatusOK, results)
+}
+
+// UpdateDNSRecords patches content, TTL, proxied and comment on one record
+// (recordId, single domain) or on every record the filter matches.
+func UpdateDNSRecords(c *gin.Context) {
+	var req UpdateDNSRecordsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	subdomains, ok := normalizeRecordTargets(c, &req.Domains)
+	if !ok {
+		return
+	}
+
+	if req.Set.Content == nil && req.Set.TTL == nil && req.Set.Proxied == nil && req.Set.Comment == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No changes provided"})
+		return
+	}
+	// an empty filter would rewrite every record of every zone
+	f := req.dnsRecordFilter
+	if req.RecordID == "" && f.Type == "" && f.Name == "" && f.NamePattern == "" && f.Content == "" && f.Proxied == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "recordId or a filter (type, name, namePattern, content, proxied) is required"})
+		return
+	}
+	if req.Set.Content != nil && req.RecordID == "" && f.Type == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Changing content requires a type filter"})
+		return
+	}
+	if req.RecordID != "" && len(req.Domains) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "recordId requires exactly one domain"})
+		return
+	}
+
+	route := routeBatch(c, req.AccountID, req.Domains)
+	if route == nil {
+		return
+	}
+	domains := req.Domains
+	if len(domains) == 0 {
+		all, err := domainsOrAllZones(route.acc, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		domains = all
+	}
+
+	runRoutedBatch(c, "dns.update", route, &req, len(domains), func(idx int, acc *models.Account) UpdateDNSRecordsResult {
+		dom := domains[idx]
+		success, msg, count, plan := updateDNSRecords(acc, dom, subdomainAt(subdomains, idx), &req)
+		return UpdateDNSRecordsResult{
+			Domain:  recordFQDN(subdomainAt(subdomains, idx), dom),
+			Success: success,
+			Message: msg,
+			Count:   count,
+			Retries: retriesFor(acc),
+			Plan:    plan,
+		}
+	})
+}
+
+// updateDNSRecords applies req to the records of domain, or of its subdomain
+// sub when set.
+func updateDNSRecords(acc *models.Account, domain string, sub string, req *UpdateDNSRecordsRequest) (bool, string, int, []string) {
+	var (
+		zoneID  string
+		records []cfDNSRecord
+		err     error
+	)
+	if req.RecordID != "" {
+		zoneID, records, err = getDNSRecord(acc, domain, req.RecordID)
+	} else {
+		zoneID, records, err = findDNSRecords(acc, domain, req.dnsRecordFilter.under(sub, domain))
+	}
+	if err != nil {
+		return false, err.Error(), 0, nil
+	}
+
+	var (
+		targets  []cfDNSRecord
+		payloads []map[string]interface{}
+		plan     []string
+	)
+	for _, r := range records {
+		payload, changes := req.Set.diff(r)
+		if len(payload) == 0 {
+			continue
+		}
+		targets = append(targets, r)
+		payloads = append(payloads, payload)
+		plan = append(plan, fmt.Sprintf("%s %s: %s", r.Type, r.Name, strings.Join(changes, ", ")))
+	}
+
+	if len(targets) == 0 {
+		return false, "No records to update", 0, nil
+	}
+	if req.DryRun {
+		return true, fmt.Sprintf("Dry run: would update %d records", len(targets)), len(targets), plan
+	}
+
+	if err := snapshotRecords(acc, domain, zoneID, "dns.update", targets); err != nil {
+		return false, err.Error(), 0, nil
+	}
+
+	client := newCFClient(acc)
+	count := 0
+	var failed []string
+	for i, r := range targets {
+		if _, err := client.Patch(fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, r.ID), payloads[i], nil); err != nil {
+			failed = append(failed, fmt.Sprintf("%s %s: %s", r.Type, r.Name, err.Error()))
+			continue
+		}
+		count++
+	}
+
+	if len(failed) > 0 {
+		return false, fmt.Sprintf("Updated %d records, failed %d: %s", count, len(failed), strings.Join(failed, "; ")), count, nil
+	}
+	return true, fmt.Sprintf("Updated %d records", count), count, nil
+}
+
+// diff returns the PATCH body that applies the changes to r together with a
+// description of each change. Fields that already match are left out, and
+// proxied is only set on record types that can be proxied.
+func (s *dnsRecordChanges) diff(r cfDNSRecord) (map[string]interface{}, []string) {
+	payload := map[string]interface{}{}
+	var changes []string
+	if s.Content != nil && *s.Content != r.Content {
+		payload["content"] = *s.Content
+		changes = append(changes, fmt.Sprintf("content %s -> %s", r.Content, *s.Content))
+	}
+	if s.TTL != nil && *s.TTL != r.TTL {
+		payload["ttl"] = *s.TTL
+		changes = append(changes, fmt.Sprintf("ttl %d -> %d", r.TTL, *s.TTL))
+	}
+	if s.Proxied != nil && *s.Proxied != r.Proxied && r.proxiable() {
+		payload["proxied"] = *s.Proxied
+		changes = append(changes, fmt.Sprintf("proxied %t -> %t", r.Proxied, *s.Proxied))
+	}
+	if s.Comment != nil && *s.Comment != r.Comment {
+		payload["comment"] = *s.Comment
+		changes = append(changes, fmt.Sprintf("comment %q -> %q", r.Comment, *s.Comment))
+	}
+	return payload, changes
+}
+
+func getDNSRecord(acc *models.Account, domain string, recordID string) (string, []cfDNSRecord, error) {
+	zoneID, err := getZoneID(acc, domain)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var record cfDNSRecord
+	if _, err := newCFClient(acc).Get(fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, recordID), nil, &record); err != nil {
+		return "", nil, err
+	}
+	return zoneID, []cfDNSRecord{record}, nil
+}
+
+// findDNSRecords resolves the zone for domain and lists the records matching
+// filter. Exact filters go to the API; name patterns are matched here.
+func findDNSRecords(acc *models.Account, domain string, filter dnsRecordFilter) (string, []cfDNSRecord, error) {
+	zoneID, err := getZoneID(acc, domain)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := url.Values{}
+	if filter.Type != "" {
+		query.Set("type", strings.ToUpper(filter.Type))
+	}
+	if filter.Content != "" {
+		query.Set("content", filter.Content)
+	}
+	if filter.Proxied != nil {
+		query.Set("proxied", strconv.FormatBool(*filter.Proxied))
+	}
+	if filter.Name != "" {
+		query.Set("name", recordFQDN(filter.Name, domain))
+	}
+
+	records, err := listDNSRecords(acc, zoneID, query)
+	if err != nil {
+		return "", nil, err
+	}
+	if filter.NamePattern == "" {
+		return zoneID, records, nil
+	}
+
+	pattern := strings.ToLower(filter.NamePattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "", nil, fmt.Errorf("Invalid name pattern: %v", err)
+	}
+	var matched []cfDNSRecord
+	for _, r := range records {
+		name := strings.ToLower(r.Name)
+		if filter.within != "" && name != filter.within && !strings.HasSuffix(name, "."+filter.within) {
+			continue
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			matched = append(matched, r)
+		}
+	}
+	return zoneID, matched, nil
+}
+
+// under narrows the filter to sub, a subdomain of zone: the name is put
+// under sub, and a pattern without a name only matches sub and the names
+// below it.
+func (f dnsRecordFilter) under(sub string, zone string) dnsRecordFilter {
+	if sub == "" {
+		return f
+	}
+	if f.Name == "" && f.NamePattern != "" {
+		f.within = recordFQDN(sub, zone)
+		return f
+	}
+	f.Name = underSubdomain(f.Name, sub, zone)
+	return f
+}
+
+// subdomainAt returns the subdomain of the idx-th domain, which is empty
+// when the domains were expanded to every zone of the account.
+func subdomainAt(subdomains []string, idx int) string {
+	if idx < len(subdomains) {
+		return subdomains[idx]
+	}
+	return ""
+}
+
+// domainsOrAllZones returns domains, or the name of every zone in the
+// account when the list is empty.
+func domainsOrAllZones(acc *models.Account, domains []string) ([]string, error) {
+	if len(domains) > 0 {
+		return domains, nil
+	}
+	zones, err := listZones(acc)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		all = append(all, zone.Name)
+	}
+	return all, nil
+}
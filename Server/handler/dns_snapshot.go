@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"cloudflare-tools/server/models"
+	"cloudflare-tools/server/snapshots"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RollbackDNSRequest struct {
+	AccountID  string `json:"accountId"`
+	SnapshotID string `json:"snapshotId"`
+	DryRun     bool   `json:"dryRun"`
+}
+
+type RollbackResult struct {
+	Domain     string   `json:"domain"`
+	SnapshotID string   `json:"snapshotId"`
+	Success    bool     `json:"success"`
+	Message    string   `json:"message"`
+	Restored   int      `json:"restored"`
+	Reverted   int      `json:"reverted"`
+	Unchanged  int      `json:"unchanged"`
+	Failed     []string `json:"failed,omitempty"`
+	Plan       []string `json:"plan,omitempty"`
+}
+
+// snapshotRecords saves the records an operation is about to change. Callers
+// must not write anything when it fails.
+func snapshotRecords(acc *models.Account, domain string, zoneID string, operation string, records []cfDNSRecord) error {
+	if _, err := snapshots.Save(domain, zoneID, acc.ID, operation, records, len(records)); err != nil {
+		return fmt.Errorf("Snapshot failed: %v", err)
+	}
+	return nil
+}
+
+func ListDNSSnapshots(c *gin.Context) {
+	list, err := snapshots.List(c.Query("domain"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func GetDNSSnapshot(c *gin.Context) {
+	snap, err := snapshots.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, snap)
+}
+
+// RollbackDNS restores the records of a snapshot: deleted records are
+// recreated and records changed since are put back to their saved values.
+// Records created after the snapshot are left alone.
+func RollbackDNS(c *gin.Context) {
+	var req RollbackDNSRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	snap, err := snapshots.Get(req.SnapshotID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	accountID := req.AccountID
+	if accountID == "" {
+		accountID = snap.AccountID
+	}
+	acc := findAccount(accountID)
+	if acc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	entry := newAuditEntry(c, "dns.rollback", acc, &req)
+	result := rollbackSnapshot(acc, snap, req.DryRun)
+	entry.Results = []interface{}{result}
+	recordAudit(entry)
+	c.JSON(http.StatusOK, result)
+}
+
+func rollbackSnapshot(acc *models.Account, snap *snapshots.Snapshot, dryRun bool) RollbackResult {
+	result := RollbackResult{Domain: snap.Domain, SnapshotID: snap.ID}
+
+	var saved []cfDNSRecord
+	if err := json.Unmarshal(snap.Records, &saved); err != nil {
+		result.Message = "Invalid snapshot"
+		return result
+	}
+
+	// the zone may have been deleted and re-added since, in which case none
+	// of the saved record IDs exist any more and everything is recreated
+	zoneID, err := getZoneID(acc, snap.Domain)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	current, err := listDNSRecords(acc, zoneID, nil)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	byID := make(map[string]cfDNSRecord, len(current))
+	present := make(map[string]bool, len(current))
+	for _, r := range current {
+		byID[r.ID] = r
+		present[r.describe()] = true
+	}
+
+	var create, revert, overwritten []cfDNSRecord
+	for _, r := range saved {
+		cur, ok := byID[r.ID]
+		switch {
+		case !ok && present[r.describe()]:
+			// already recreated, e.g. by an earlier rollback
+			result.Unchanged++
+		case !ok:
+			create = append(create, r)
+		case reflect.DeepEqual(normalizedPayload(cur), normalizedPayload(r)):
+			result.Unchanged++
+		default:
+			revert = append(revert, r)
+			overwritten = append(overwritten, cur)
+		}
+	}
+
+	if dryRun {
+		for _, r := range create {
+			result.Plan = append(result.Plan, "create "+r.describe())
+		}
+		for i, r := range revert {
+			result.Plan = append(result.Plan, fmt.Sprintf("revert %s (now %s, proxied %t -> %t)", r.describe(), overwritten[i].Content, overwritten[i].Proxied, r.Proxied))
+		}
+		result.Success = true
+		result.Restored = len(create)
+		result.Reverted = len(revert)
+		result.Message = dryRunMessage(len(result.Plan))
+		return result
+	}
+
+	if len(create) == 0 && len(revert) == 0 {
+		result.Success = true
+		result.Message = "Nothing to restore"
+		return result
+	}
+
+	// the rollback itself can be undone too
+	if len(overwritten) > 0 {
+		if err := snapshotRecords(acc, snap.Domain, zoneID, "dns.rollback", overwritten); err != nil {
+			result.Message = err.Error()
+			return result
+		}
+	}
+
+	client := newCFClient(acc)
+	for _, r := range create {
+		if _, err := client.Post(fmt.Sprintf("/zones/%s/dns_records", zoneID), r.payload(), nil); err != nil {
+			result.Failed = append(result.Failed, fmt.Sprintf("%s: %s", r.describe(), err.Error()))
+			continue
+		}
+		result.Restored++
+	}
+	for _, r := range revert {
+		if _, err := client.Put(fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, r.ID), r.payload(), nil); err != nil {
+			result.Failed = append(result.Failed, fmt.Sprintf("%s: %s", r.describe(), err.Error()))
+			continue
+		}
+		result.Reverted++
+	}
+
+	result.Success = len(result.Failed) == 0
+	result.Message = fmt.Sprintf("Restored %d, reverted %d, failed %d", result.Restored, result.Reverted, len(result.Failed))
+	return result
+}
+
+// normalizedPayload round-trips a record's payload through JSON so records
+// decoded at different times compare equal.
+func normalizedPayload(r cfDNSRecord) interface{} {
+	data, _ := json.Marshal(r.payload())
+	var v interface{}
+	json.Unmarshal(data, &v)
+	return v
+}
@@ -0,0 +1,523 @@
+package handler
+
+import (
+	"cloudflare-tools/server/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+type SyncDNSRequest struct {
+	AccountID string `json:"accountId"`
+	// Domain names the zone of a single-zone file that has no zone key
+	Domain string `json:"domain"`
+	// Content is the desired state as YAML or JSON; several zones can be
+	// given as separate YAML documents
+	Content string `json:"content"`
+	// Prune deletes live records the file doesn't list
+	Prune  bool `json:"prune"`
+	DryRun bool `json:"dryRun"`
+}
+
+// desiredZone is one zone of a desired-state file. TTL and Proxied are the
+// defaults for records that don't set their own.
+type desiredZone struct {
+	Zone    string          `json:"zone" yaml:"zone"`
+	TTL     int             `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	Proxied bool            `json:"proxied,omitempty" yaml:"proxied,omitempty"`
+	Records []desiredRecord `json:"records" yaml:"records"`
+}
+
+// desiredRecord is a record of a desired-state file. Name is relative to the
+// zone ("@", "www") or a full name. A record without comment keeps whatever
+// comment the live record has.
+type desiredRecord struct {
+	Name     string                 `json:"name" yaml:"name"`
+	Type     string                 `json:"type" yaml:"type"`
+	Content  string                 `json:"content,omitempty" yaml:"content,omitempty"`
+	Priority *int                   `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty" yaml:"data,omitempty"`
+	TTL      int                    `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	Proxied  *bool                  `json:"proxied,omitempty" yaml:"proxied,omitempty"`
+	Comment  *string                `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+type SyncDNSResult struct {
+	Domain    string `json:"domain"`
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	Created   int    `json:"created"`
+	Updated   int    `json:"updated"`
+	Deleted   int    `json:"deleted"`
+	Unchanged int    `json:"unchanged"`
+	// Unmanaged counts live records missing from the file that were kept
+	// because prune is off
+	Unmanaged int      `json:"unmanaged"`
+	Retries   int      `json:"retries,omitempty"`
+	Plan      []string `json:"plan,omitempty"`
+}
+
+// wantedRecord is a validated desired record; keepComment is set when the
+// file leaves the comment to the live record.
+type wantedRecord struct {
+	cfDNSRecord
+	keepComment bool
+}
+
+// syncPlan holds the changes that reconcile a zone with its desired state.
+// update[i] overwrites current[i], keeping its ID.
+type syncPlan struct {
+	create    []cfDNSRecord
+	update    []cfDNSRecord
+	current   []cfDNSRecord
+	delete    []cfDNSRecord
+	unchanged int
+	unmanaged []cfDNSRecord
+}
+
+// SyncDNS reconciles each zone of a desired-state file with Cloudflare:
+// records that differ are updated in place, missing ones are created and,
+// with prune, records the file doesn't list are deleted.
+func SyncDNS(c *gin.Context) {
+	var req SyncDNSRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	zones, err := parseDesiredState(req.Content, req.Domain)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	wanted := make([][]wantedRecord, len(zones))
+	var problems []string
+	for i, zone := range zones {
+		records, errs := zone.records()
+		wanted[i] = records
+		problems = append(problems, errs...)
+	}
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Desired state has errors", "errors": problems})
+		return
+	}
+
+	domains := make([]string, len(zones))
+	for i, zone := range zones {
+		domains[i] = zone.Zone
+	}
+	route := routeBatch(c, req.AccountID, domains)
+	if route == nil {
+		return
+	}
+
+	runRoutedBatch(c, "dns.sync", route, &req, len(zones), func(idx int, acc *models.Account) SyncDNSResult {
+		result := syncZone(acc, zones[idx].Zone, wanted[idx], req.Prune, req.DryRun)
+		result.Retries = retriesFor(acc)
+		return result
+	})
+}
+
+// ExportDNSState downloads the live records of a zone as a desired-state
+// file, as a starting point for SyncDNS.
+func ExportDNSState(c *gin.Context) {
+	acc := findAccount(c.Query("accountId"))
+	if acc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(c.Query("domain")))
+	zoneID, err := getZoneID(acc, domain)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	records, err := listDNSRecords(acc, zoneID, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	state := desiredZone{Zone: domain, Records: []desiredRecord{}}
+	for _, r := range records {
+		state.Records = append(state.Records, toDesiredRecord(r, domain))
+	}
+
+	if c.Query("format") == "json" {
+		c.Header("Content-Disposition", "attachment; filename="+domain+".json")
+		c.IndentedJSON(http.StatusOK, state)
+		return
+	}
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename="+domain+".yaml")
+	c.Data(http.StatusOK, "application/yaml; charset=utf-8", data)
+}
+
+// parseDesiredState decodes the zones of a desired-state file. JSON is read
+// by the YAML decoder too.
+func parseDesiredState(content string, domain string) ([]desiredZone, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("Desired state is required")
+	}
+
+	var zones []desiredZone
+	dec := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var zone desiredZone
+		err := dec.Decode(&zone)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid desired state: %v", err)
+		}
+		zones = append(zones, zone)
+	}
+	if len(zones) == 0 {
+		return nil, fmt.Errorf("Desired state is required")
+	}
+
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	seen := make(map[string]bool, len(zones))
+	for i := range zones {
+		zone := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(zones[i].Zone), "."))
+		if zone == "" {
+			if len(zones) > 1 || domain == "" {
+				return nil, fmt.Errorf("Document %d has no zone", i+1)
+			}
+			zone = domain
+		}
+		if seen[zone] {
+			return nil, fmt.Errorf("Zone %s is listed twice", zone)
+		}
+		seen[zone] = true
+		zones[i].Zone = zone
+	}
+	return zones, nil
+}
+
+// records validates the zone's records the same way addDNSRecord does and
+// returns them with full names.
+func (z desiredZone) records() ([]wantedRecord, []string) {
+	var (
+		records []wantedRecord
+		errs    []string
+	)
+	seen := map[string]bool{}
+	for i, r := range z.Records {
+		rec, err := DNSRecord{
+			Domain:   z.Zone,
+			Host:     r.Name,
+			Type:     r.Type,
+			Value:    r.Content,
+			Priority: r.Priority,
+			Data:     r.Data,
+			TTL:      r.TTL,
+			Proxied:  r.Proxied,
+		}.prepare(z.TTL, z.Proxied)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s record %d (%s %s): %v", z.Zone, i+1, r.Type, r.Name, err))
+			continue
+		}
+
+		rec.Name = strings.ToLower(recordFQDN(r.Name, z.Zone))
+		rec.Content = normalizeRecordContent(rec.Type, rec.Content)
+		if rec.Proxied {
+			// Cloudflare keeps proxied records on automatic TTL
+			rec.TTL = 1
+		}
+		if r.Comment != nil {
+			rec.Comment = *r.Comment
+		}
+
+		key := syncValueKey(rec)
+		if seen[key] {
+			errs = append(errs, fmt.Sprintf("%s record %d (%s %s): duplicate record", z.Zone, i+1, r.Type, r.Name))
+			continue
+		}
+		seen[key] = true
+		records = append(records, wantedRecord{cfDNSRecord: rec, keepComment: r.Comment == nil})
+	}
+	return records, errs
+}
+
+func syncZone(acc *models.Account, domain string, wanted []wantedRecord, prune bool, dryRun bool) SyncDNSResult {
+	result := SyncDNSResult{Domain: domain}
+
+	zoneID, err := getZoneID(acc, domain)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	current, err := listDNSRecords(acc, zoneID, nil)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	plan := diffDesiredState(wanted, current)
+	result.Unchanged = plan.unchanged
+	if prune {
+		plan.delete = plan.unmanaged
+	} else {
+		result.Unmanaged = len(plan.unmanaged)
+	}
+	if err := plan.checkBatchSize(); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	if dryRun {
+		result.Plan = plan.describe()
+		result.Success = true
+		result.Created = len(plan.create)
+		result.Updated = len(plan.update)
+		result.Deleted = len(plan.delete)
+		result.Message = dryRunMessage(len(result.Plan))
+		return result
+	}
+
+	if len(plan.create) == 0 && len(plan.update) == 0 && len(plan.delete) == 0 {
+		result.Success = true
+		result.Message = "Already in sync"
+		return result
+	}
+
+	touched := append(append([]cfDNSRecord{}, plan.current...), plan.delete...)
+	if len(touched) > 0 {
+		if err := snapshotRecords(acc, domain, zoneID, "dns.sync", touched); err != nil {
+			result.Message = err.Error()
+			return result
+		}
+	}
+
+	// one transaction per zone: a failure leaves the zone as it was
+	if err := applyDNSBatch(acc, zoneID, plan); err != nil {
+		result.Message = fmt.Sprintf("Batch failed, no records were changed: %v", err)
+		return result
+	}
+
+	result.Success = true
+	result.Created = len(plan.create)
+	result.Updated = len(plan.update)
+	result.Deleted = len(plan.delete)
+	result.Message = fmt.Sprintf("Created %d, updated %d, deleted %d", result.Created, result.Updated, result.Deleted)
+	return result
+}
+
+// diffDesiredState matches desired records to live ones by name and type.
+// Records with the same value are paired first; the rest of a name/type are
+// paired in order and updated in place, so record IDs survive content
+// changes. Live records left over end up in unmanaged.
+func diffDesiredState(wanted []wantedRecord, current []cfDNSRecord) *syncPlan {
+	plan := &syncPlan{}
+
+	live := map[string][]cfDNSRecord{}
+	var order []string
+	for _, r := range current {
+		key := strings.ToLower(r.Name) + " " + r.Type
+		if _, ok := live[key]; !ok {
+			order = append(order, key)
+		}
+		live[key] = append(live[key], r)
+	}
+
+	groups := map[string][]wantedRecord{}
+	for _, w := range wanted {
+		key := w.Name + " " + w.Type
+		groups[key] = append(groups[key], w)
+	}
+
+	pair := func(w wantedRecord, cur cfDNSRecord) {
+		want := w.cfDNSRecord
+		want.ID = cur.ID
+		want.Tags = cur.Tags
+		if w.keepComment {
+			want.Comment = cur.Comment
+		}
+		if len(syncFieldChanges(cur, want)) == 0 {
+			plan.unchanged++
+			return
+		}
+		plan.update = append(plan.update, want)
+		plan.current = append(plan.current, cur)
+	}
+
+	for _, w := range wanted {
+		key := w.Name + " " + w.Type
+		if groups[key] == nil {
+			continue
+		}
+		pending := groups[key]
+		delete(groups, key)
+		candidates := live[key]
+
+		used := make([]bool, len(candidates))
+		var rest []wantedRecord
+		for _, want := range pending {
+			matched := false
+			for i, cur := range candidates {
+				if !used[i] && syncValueKey(cur) == syncValueKey(want.cfDNSRecord) {
+					used[i] = true
+					matched = true
+					pair(want, cur)
+					break
+				}
+			}
+			if !matched {
+				rest = append(rest, want)
+			}
+		}
+		for i, cur := range candidates {
+			if used[i] {
+				continue
+			}
+			if len(rest) > 0 {
+				pair(rest[0], cur)
+				rest = rest[1:]
+				used[i] = true
+			}
+		}
+		for _, want := range rest {
+			plan.create = append(plan.create, want.cfDNSRecord)
+		}
+		var left []cfDNSRecord
+		for i, cur := range candidates {
+			if !used[i] {
+				left = append(left, cur)
+			}
+		}
+		live[key] = left
+	}
+
+	for _, key := range order {
+		plan.unmanaged = append(plan.unmanaged, live[key]...)
+	}
+	return plan
+}
+
+func (p *syncPlan) describe() []string {
+	var lines []string
+	for _, r := range p.delete {
+		lines = append(lines, "delete "+r.describe())
+	}
+	for i, r := range p.update {
+		lines = append(lines, fmt.Sprintf("update %s: %s", p.current[i].describe(), strings.Join(syncFieldChanges(p.current[i], r), ", ")))
+	}
+	for _, r := range p.create {
+		lines = append(lines, "create "+r.describe())
+	}
+	return lines
+}
+
+func syncFieldChanges(cur cfDNSRecord, want cfDNSRecord) []string {
+	var changes []string
+	if syncValueKey(cur) != syncValueKey(want) {
+		changes = append(changes, fmt.Sprintf("value %s -> %s", displayValue(cur), displayValue(want)))
+	}
+	if cur.TTL != want.TTL {
+		changes = append(changes, fmt.Sprintf("ttl %d -> %d", cur.TTL, want.TTL))
+	}
+	if cur.Proxied != want.Proxied {
+		changes = append(changes, fmt.Sprintf("proxied %t -> %t", cur.Proxied, want.Proxied))
+	}
+	if cur.Comment != want.Comment {
+		changes = append(changes, fmt.Sprintf("comment %q -> %q", cur.Comment, want.Comment))
+	}
+	return changes
+}
+
+// syncValueKey identifies a record by name, type and value, ignoring TTL,
+// proxy status and comment.
+func syncValueKey(r cfDNSRecord) string {
+	return strings.ToLower(r.Name) + " " + r.Type + " " + recordValue(r)
+}
+
+func recordValue(r cfDNSRecord) string {
+	value := map[string]interface{}{}
+	if r.Data != nil {
+		// round-trip so ints from YAML and floats from the API compare
+		// equal; the API repeats SRV priority outside data, so it's left out
+		data, _ := json.Marshal(r.Data)
+		var v interface{}
+		json.Unmarshal(data, &v)
+		value["data"] = v
+	} else {
+		value["content"] = normalizeRecordContent(r.Type, r.Content)
+		if r.Priority != nil {
+			value["priority"] = *r.Priority
+		}
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func displayValue(r cfDNSRecord) string {
+	if r.Data != nil {
+		data, _ := json.Marshal(r.Data)
+		return string(data)
+	}
+	if r.Priority != nil {
+		return fmt.Sprintf("%d %s", *r.Priority, r.Content)
+	}
+	return r.Content
+}
+
+// normalizeRecordContent puts content in the form Cloudflare returns it, so a
+// file that says "mail.example.com." or a long-form IPv6 address doesn't show
+// up as a change on every sync.
+func normalizeRecordContent(rtype string, content string) string {
+	switch rtype {
+	case "AAAA":
+		if ip := net.ParseIP(content); ip != nil {
+			return ip.String()
+		}
+	case "CNAME", "NS", "PTR", "MX":
+		return strings.ToLower(strings.TrimSuffix(content, "."))
+	}
+	return content
+}
+
+func toDesiredRecord(r cfDNSRecord, domain string) desiredRecord {
+	name := strings.ToLower(r.Name)
+	switch {
+	case name == domain:
+		name = "@"
+	case strings.HasSuffix(name, "."+domain):
+		name = strings.TrimSuffix(name, "."+domain)
+	}
+
+	rec := desiredRecord{
+		Name:     name,
+		Type:     r.Type,
+		Priority: r.Priority,
+		Data:     r.Data,
+		TTL:      r.TTL,
+	}
+	if r.Data != nil {
+		rec.Priority = nil
+	} else {
+		rec.Content = r.Content
+	}
+	if r.proxiable() {
+		proxied := r.Proxied
+		rec.Proxied = &proxied
+	}
+	if r.Comment != "" {
+		comment := r.Comment
+		rec.Comment = &comment
+	}
+	return rec
+}
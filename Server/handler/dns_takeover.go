@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"bytes"
+	"cloudflare-tools/server/dnscheck"
+	"cloudflare-tools/server/models"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// only the start of a page is searched for provider fingerprints
+	takeoverProbeLimit   = 64 << 10
+	takeoverProbeTimeout = 10 * time.Second
+)
+
+type TakeoverScanRequest struct {
+	AccountID string   `json:"accountId"`
+	Domains   []string `json:"domains"`
+	// Resolver resolves the record targets, instead of the first
+	// dns_check resolver
+	Resolver string `json:"resolver"`
+	// ProbeHTTP fetches names that point at a known provider and looks for
+	// the provider's page for unclaimed names
+	ProbeHTTP bool `json:"probeHttp"`
+}
+
+// TakeoverFinding is a record that may be dangling. RecordID and Domain can
+// be passed to /api/dns/batch-delete as recordIds and domains.
+type TakeoverFinding struct {
+	Domain   string `json:"domain"`
+	RecordID string `json:"recordId"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Content  string `json:"content"`
+	Proxied  bool   `json:"proxied"`
+	// Kind is nxdomain, unresolvable, provider or reserved-ip
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Provider string `json:"provider,omitempty"`
+	Detail   string `json:"detail"`
+}
+
+type TakeoverScanResult struct {
+	Domain   string            `json:"domain"`
+	Success  bool              `json:"success"`
+	Message  string            `json:"message"`
+	Scanned  int               `json:"scanned"`
+	Findings []TakeoverFinding `json:"findings"`
+}
+
+var severityOrder = map[string]int{"high": 0, "medium": 1, "low": 2}
+
+// ScanTakeover checks every record of the requested zones, or of every zone
+// in the account, for dangling targets. With ?format=csv the findings are
+// downloaded as a CSV file.
+func ScanTakeover(c *gin.Context) {
+	var req TakeoverScanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !normalizeZones(c, &req.Domains) {
+		return
+	}
+
+	acc := findAccount(req.AccountID)
+	if acc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	domains, err := domainsOrAllZones(acc, req.Domains)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resolver := req.Resolver
+	if resolver == "" {
+		resolver = publicResolvers()[0]
+	}
+
+	results := make([]TakeoverScanResult, len(domains))
+	forEachBounded(len(domains), func(idx int) {
+		dom := domains[idx]
+		result := TakeoverScanResult{Domain: dom, Findings: []TakeoverFinding{}}
+		scanned, findings, err := scanZoneTakeover(acc, dom, resolver, req.ProbeHTTP)
+		if err != nil {
+			result.Message = err.Error()
+		} else {
+			result.Success = true
+			result.Message = fmt.Sprintf("%d findings", len(findings))
+			result.Scanned = scanned
+			if findings != nil {
+				result.Findings = findings
+			}
+		}
+		results[idx] = result
+	})
+
+	if c.Query("format") == "csv" {
+		data, err := takeoverCSV(results)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename=takeover-scan.csv")
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// scanZoneTakeover returns the number of records checked and the findings,
+// most severe first.
+func scanZoneTakeover(acc *models.Account, domain string, resolver string, probe bool) (int, []TakeoverFinding, error) {
+	zoneID, err := getZoneID(acc, domain)
+	if err != nil {
+		return 0, nil, err
+	}
+	records, err := listDNSRecords(acc, zoneID, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	answers := dnsAnswerCache{client: newDNSClient(), answers: map[string]*dnscheck.Answer{}, errs: map[string]error{}}
+	var findings []TakeoverFinding
+	for _, r := range records {
+		finding := TakeoverFinding{
+			Domain:   domain,
+			RecordID: r.ID,
+			Name:     r.Name,
+			Type:     r.Type,
+			Content:  r.Content,
+			Proxied:  r.Proxied,
+		}
+		var found bool
+		switch r.Type {
+		case "A", "AAAA":
+			found = checkReservedIP(&finding)
+		case "CNAME", "NS", "MX":
+			found = checkDanglingTarget(&answers, resolver, probe, &finding)
+		}
+		if found {
+			findings = append(findings, finding)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return severityOrder[findings[i].Severity] < severityOrder[findings[j].Severity]
+	})
+	return len(records), findings, nil
+}
+
+func checkReservedIP(f *TakeoverFinding) bool {
+	name := dnscheck.ReservedRange(f.Content)
+	if name == "" {
+		return false
+	}
+	f.Kind = "reserved-ip"
+	f.Severity = "medium"
+	f.Detail = fmt.Sprintf("%s is a %s address", f.Content, name)
+	return true
+}
+
+// checkDanglingTarget resolves the target of a CNAME, NS or MX record. A
+// target that doesn't exist can often be registered or claimed by anyone;
+// targets at a takeover-prone provider are reported for review, and as
+// high severity when the provider's page for unclaimed names shows up.
+func checkDanglingTarget(answers *dnsAnswerCache, resolver string, probe bool, f *TakeoverFinding) bool {
+	target := f.Content
+	fp := dnscheck.MatchFingerprint(target)
+	if fp != nil {
+		f.Provider = fp.Provider
+	}
+
+	answer, err := answers.query(resolver, target, "A")
+	switch {
+	case err != nil:
+		f.Kind = "unresolvable"
+		f.Severity = "low"
+		f.Detail = err.Error()
+		return true
+	case answer.NXDomain():
+		f.Kind = "nxdomain"
+		f.Severity = "high"
+		if f.Type == "MX" {
+			f.Severity = "medium"
+		}
+		f.Detail = fmt.Sprintf("Target %s does not exist (NXDOMAIN)", target)
+		return true
+	case answer.RCode != "NOERROR":
+		f.Kind = "unresolvable"
+		f.Severity = "medium"
+		f.Detail = fmt.Sprintf("Target %s answered %s", target, answer.RCode)
+		return true
+	}
+
+	// the target may itself be an alias of a provider name
+	for _, alias := range answer.Values("CNAME") {
+		if fp != nil {
+			break
+		}
+		if fp = dnscheck.MatchFingerprint(alias); fp != nil {
+			f.Provider = fp.Provider
+		}
+	}
+	if fp == nil {
+		return false
+	}
+
+	f.Kind = "provider"
+	f.Severity = "low"
+	f.Detail = fmt.Sprintf("Target is hosted on %s; make sure the resource still exists", fp.Provider)
+	if probe && f.Type == "CNAME" && len(fp.Body) > 0 {
+		if body, err := probeTakeover(f.Name); err == nil && fp.MatchesBody(body) {
+			f.Severity = "high"
+			f.Detail = fmt.Sprintf("http://%s shows the %s page for unclaimed names", f.Name, fp.Provider)
+		}
+	}
+	return true
+}
+
+func probeTakeover(name string) (string, error) {
+	client := &http.Client{Timeout: takeoverProbeTimeout}
+	resp, err := client.Get("http://" + name + "/")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, takeoverProbeLimit))
+	return string(body), err
+}
+
+func takeoverCSV(results []TakeoverScanResult) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"domain", "name", "type", "content", "proxied", "kind", "severity", "provider", "detail", "record_id"})
+	for _, result := range results {
+		for _, f := range result.Findings {
+			w.Write([]string{f.Domain, f.Name, f.Type, f.Content, strconv.FormatBool(f.Proxied), f.Kind, f.Severity, f.Provider, f.Detail, f.RecordID})
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,376 @@
+package handler
+
+import (
+	"cloudflare-tools/server/domains"
+	"cloudflare-tools/server/models"
+	"cloudflare-tools/server/templates"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SaveTemplateRequest struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Records     []templates.Record `json:"records"`
+	// Lines are "host|type|value" records, appended to Records
+	Lines    []string          `json:"lines"`
+	Defaults map[string]string `json:"defaults"`
+}
+
+type ApplyTemplateRequest struct {
+	AccountID string   `json:"accountId"`
+	Template  string   `json:"template"`
+	Domains   []string `json:"domains"`
+	// CSV has a header row with a "domain" column; the other columns are
+	// variables of that domain
+	CSV       string            `json:"csv"`
+	Variables map[string]string `json:"variables"`
+	TTL       int               `json:"ttl"`
+	Proxied   bool              `json:"proxied"`
+	DeleteOld bool              `json:"deleteOld"`
+	// Upsert updates existing records in place instead of deleting them,
+	// applying each zone's changes in one transaction
+	Upsert bool `json:"upsert"`
+	DryRun bool `json:"dryRun"`
+}
+
+type TemplateInfo struct {
+	templates.Template
+	Variables []string `json:"variables"`
+}
+
+// TemplateRecord is a template record expanded for one domain.
+type TemplateRecord struct {
+	DNSRecord
+	Error string `json:"error,omitempty"`
+}
+
+func ListTemplates(c *gin.Context) {
+	list, err := templates.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	infos := make([]TemplateInfo, len(list))
+	for i, t := range list {
+		infos[i] = TemplateInfo{Template: t, Variables: t.Variables()}
+	}
+	c.JSON(http.StatusOK, infos)
+}
+
+func GetTemplate(c *gin.Context) {
+	t, err := templates.Get(c.Param("name"))
+	if err != nil {
+		c.JSON(templateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, TemplateInfo{Template: *t, Variables: t.Variables()})
+}
+
+// SaveTemplate creates a template or replaces the one with the same name.
+func SaveTemplate(c *gin.Context) {
+	var req SaveTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	records := req.Records
+	for _, rec := range parseRecords(templateLines(req.Lines)) {
+		records = append(records, templates.Record{Host: rec.Host, Type: rec.Type, Value: rec.Value, Priority: rec.Priority})
+	}
+	for i, rec := range records {
+		rec.Type = strings.ToUpper(strings.TrimSpace(rec.Type))
+		if rec.Type == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Record %d: record type is required", i+1)})
+			return
+		}
+		if strings.TrimSpace(rec.Host) == "" || strings.TrimSpace(rec.Value) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Record %d: host and value are required", i+1)})
+			return
+		}
+		records[i] = rec
+	}
+
+	defaults := map[string]string{}
+	for k, v := range req.Defaults {
+		defaults[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+	t, err := templates.Save(templates.Template{
+		Name:        req.Name,
+		Description: req.Description,
+		Records:     records,
+		Defaults:    defaults,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, TemplateInfo{Template: *t, Variables: t.Variables()})
+}
+
+func DeleteTemplate(c *gin.Context) {
+	if err := templates.Delete(c.Param("name")); err != nil {
+		c.JSON(templateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Success"})
+}
+
+// PreviewTemplate expands a template for the requested domains without
+// touching Cloudflare, reporting records that are missing variables or end up
+// invalid.
+func PreviewTemplate(c *gin.Context) {
+	var req ApplyTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	t, records, err := expandTemplateRequest(&req)
+	if err != nil {
+		c.JSON(templateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	failed := 0
+	for _, rec := range records {
+		if rec.Error != "" {
+			failed++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"template":  t.Name,
+		"variables": t.Variables(),
+		"records":   records,
+		"errors":    failed,
+	})
+}
+
+// ApplyTemplate adds the expanded records like the batch parse endpoint does.
+// Records that failed to expand are reported without being sent.
+func ApplyTemplate(c *gin.Context) {
+	var req ApplyTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	_, records, err := expandTemplateRequest(&req)
+	if err != nil {
+		c.JSON(templateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// records that failed to expand are reported without an account and
+	// left out of the upserts
+	valid := make([]DNSRecord, len(records))
+	domains := make([]string, len(records))
+	for i, rec := range records {
+		if rec.Error == "" {
+			valid[i] = rec.DNSRecord
+			domains[i] = rec.Domain
+		}
+	}
+	route := routeBatch(c, req.AccountID, domains)
+	if route == nil {
+		return
+	}
+
+	var upserts map[string]*zoneUpsert
+	if req.Upsert {
+		upserts = groupUpserts(valid)
+	}
+
+	runRoutedBatch(c, "dns.template-apply", route, &req, len(records), func(idx int, acc *models.Account) DNSResult {
+		rec := records[idx]
+		result := DNSResult{
+			Domain: rec.Domain,
+			Host:   rec.Host,
+			Type:   rec.Type,
+			Value:  rec.Value,
+		}
+		if rec.Error != "" {
+			result.Message = rec.Error
+			return result
+		}
+		switch {
+		case req.Upsert:
+			result.Success, result.Message, result.Plan = upsertFor(upserts, rec.DNSRecord).result(acc, valid, idx, req.TTL, req.Proxied, req.DryRun)
+		case req.DryRun:
+			result.Success, result.Message, result.Plan = planDNSRecord(acc, rec.DNSRecord, req.TTL, req.Proxied, req.DeleteOld)
+		default:
+			result.Success, result.Message = addDNSRecord(acc, rec.DNSRecord, req.TTL, req.Proxied, req.DeleteOld)
+		}
+		result.Retries = retriesFor(acc)
+		return result
+	})
+}
+
+func expandTemplateRequest(req *ApplyTemplateRequest) (*templates.Template, []TemplateRecord, error) {
+	t, err := templates.Get(req.Template)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := parseTemplateCSV(req.CSV)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, d := range req.Domains {
+		if d = strings.TrimSpace(d); d != "" {
+			rows = append(rows, map[string]string{"domain": d})
+		}
+	}
+	if len(rows) == 0 {
+		return nil, nil, errors.New("No domains")
+	}
+
+	var records []TemplateRecord
+	for _, row := range rows {
+		vars := map[string]string{}
+		for k, v := range t.Defaults {
+			vars[k] = v
+		}
+		for k, v := range req.Variables {
+			vars[strings.ToLower(strings.TrimSpace(k))] = v
+		}
+		for k, v := range row {
+			if v != "" {
+				vars[k] = v
+			}
+		}
+		// a subdomain row adds its records under the subdomain, in the zone
+		// the name belongs to; {domain} stays the name itself
+		d, err := domains.Parse(row["domain"])
+		if err != nil {
+			vars["domain"] = strings.TrimSpace(row["domain"])
+			records = append(records, rejectTemplate(t, vars["domain"], err)...)
+			continue
+		}
+		vars["domain"] = d.Name
+		expanded := expandTemplate(t, vars, req.TTL, req.Proxied)
+		for i := range expanded {
+			expanded[i].Domain = d.Zone
+			expanded[i].Host = subdomainHost(expanded[i].Host, d)
+		}
+		records = append(records, expanded...)
+	}
+	return t, records, nil
+}
+
+// rejectTemplate reports every record of t as failed for a domain that
+// can't be parsed.
+func rejectTemplate(t *templates.Template, domain string, err error) []TemplateRecord {
+	records := make([]TemplateRecord, len(t.Records))
+	for i, tr := range t.Records {
+		records[i] = TemplateRecord{
+			DNSRecord: DNSRecord{Domain: domain, Host: tr.Host, Type: tr.Type, Value: tr.Value},
+			Error:     err.Error(),
+		}
+	}
+	return records
+}
+
+// expandTemplate fills in the records of t for one domain and validates them
+// the same way addDNSRecord would.
+func expandTemplate(t *templates.Template, vars map[string]string, ttl int, proxied bool) []TemplateRecord {
+	records := make([]TemplateRecord, len(t.Records))
+	for i, tr := range t.Records {
+		rec := TemplateRecord{DNSRecord: DNSRecord{
+			Domain:   vars["domain"],
+			Host:     tr.Host,
+			Type:     tr.Type,
+			Value:    tr.Value,
+			Priority: tr.Priority,
+			TTL:      tr.TTL,
+			Proxied:  tr.Proxied,
+		}}
+		host, err := templates.Expand(tr.Host, vars)
+		if err == nil {
+			rec.Host = host
+			rec.Value, err = templates.Expand(tr.Value, vars)
+		}
+		if err == nil {
+			_, err = rec.DNSRecord.prepare(ttl, proxied)
+		}
+		if err != nil {
+			rec.Error = err.Error()
+		}
+		records[i] = rec
+	}
+	return records
+}
+
+// parseTemplateCSV reads per-domain variables. Column names are matched
+// case-insensitively and a "domain" column is required.
+func parseTemplateCSV(content string) ([]map[string]string, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, nil
+	}
+	r := csv.NewReader(strings.NewReader(content))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSV: %v", err)
+	}
+	domainCol := -1
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(name))
+		if header[i] == "domain" {
+			domainCol = i
+		}
+	}
+	if domainCol < 0 {
+		return nil, errors.New("CSV needs a domain column")
+	}
+
+	var rows []map[string]string
+	for {
+		fields, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CSV: %v", err)
+		}
+		line, _ := r.FieldPos(0)
+		if domainCol >= len(fields) || strings.TrimSpace(fields[domainCol]) == "" {
+			return nil, fmt.Errorf("CSV line %d: domain is empty", line)
+		}
+		row := map[string]string{}
+		for i, v := range fields {
+			if i < len(header) && header[i] != "" {
+				row[header[i]] = strings.TrimSpace(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// templateLines prefixes "host|type|value" lines with the domain placeholder
+// so parseRecords can read them.
+func templateLines(lines []string) []string {
+	var out []string
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			out = append(out, "{{domain}}|"+line)
+		}
+	}
+	return out
+}
+
+func templateErrorStatus(err error) int {
+	if errors.Is(err, templates.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"cloudflare-tools/server/zonefile"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// build validates record and turns it into the record to create. Values of
+// the structured types may be given in zone file presentation form, e.g.
+// "10 60 5060 sip.example.com" for SRV, or through Priority and Data. Types
+// without a check here (DS, TLSA, NAPTR, ...) are sent as given and left to
+// Cloudflare to validate.
+func (r DNSRecord) build() (cfDNSRecord, error) {
+	rtype := strings.ToUpper(strings.TrimSpace(r.Type))
+	rec := cfDNSRecord{
+		Type:     rtype,
+		Name:     r.Host,
+		Content:  strings.TrimSpace(r.Value),
+		Priority: r.Priority,
+		Data:     r.Data,
+	}
+	if rtype == "" {
+		return rec, fmt.Errorf("Record type is required")
+	}
+	if strings.TrimSpace(r.Host) == "" {
+		return rec, fmt.Errorf("Host is required")
+	}
+
+	switch rtype {
+	case "A":
+		if ip := net.ParseIP(rec.Content); ip == nil || ip.To4() == nil {
+			return rec, fmt.Errorf("Invalid IPv4 address %q", rec.Content)
+		}
+	case "AAAA":
+		if ip := net.ParseIP(rec.Content); ip == nil || ip.To4() != nil {
+			return rec, fmt.Errorf("Invalid IPv6 address %q", rec.Content)
+		}
+	case "CNAME", "NS", "PTR":
+		if !validHostname(rec.Content) {
+			return rec, fmt.Errorf("Invalid target %q", rec.Content)
+		}
+	case "TXT":
+		if rec.Content == "" {
+			return rec, fmt.Errorf("TXT content is required")
+		}
+		if len(rec.Content) > 2048 {
+			return rec, fmt.Errorf("TXT content exceeds 2048 characters")
+		}
+	case "MX":
+		if rec.Priority == nil && strings.ContainsAny(rec.Content, " \t") {
+			parsed, err := zonefile.ParseRData(rtype, rec.Content, "")
+			if err != nil {
+				return rec, fmt.Errorf("Invalid MX value: %v", err)
+			}
+			rec.Priority = parsed.Priority
+			rec.Content = parsed.Content
+		}
+		if rec.Priority == nil || *rec.Priority < 0 || *rec.Priority > 65535 {
+			return rec, fmt.Errorf("MX priority (0-65535) is required")
+		}
+		if !validHostname(rec.Content) {
+			return rec, fmt.Errorf("Invalid mail server %q", rec.Content)
+		}
+	case "SRV", "CAA", "HTTPS", "SVCB":
+		if rec.Data == nil {
+			parsed, err := zonefile.ParseRData(rtype, rec.Content, "")
+			if err != nil {
+				return rec, fmt.Errorf("Invalid %s value: %v", rtype, err)
+			}
+			rec.Data = parsed.Data
+		}
+		rec.Content = ""
+		if err := validateRecordData(rtype, r.Host, rec.Data); err != nil {
+			return rec, err
+		}
+	}
+	return rec, nil
+}
+
+// prepare builds the record and applies the TTL and proxy settings, letting
+// the record's own values override the request-wide ones. proxied is only
+// kept for record types Cloudflare can proxy.
+func (r DNSRecord) prepare(ttl int, proxied bool) (cfDNSRecord, error) {
+	rec, err := r.build()
+	if err != nil {
+		return rec, err
+	}
+	if r.TTL != 0 {
+		ttl = r.TTL
+	}
+	if ttl == 0 {
+		ttl = 1
+	}
+	if r.Proxied != nil {
+		proxied = *r.Proxied
+	}
+	rec.TTL = ttl
+	rec.Proxied = proxied && rec.proxiable()
+	return rec, nil
+}
+
+func validateRecordData(rtype string, host string, data map[string]interface{}) error {
+	switch rtype {
+	case "SRV":
+		for _, field := range []string{"priority", "weight", "port"} {
+			if _, err := dataUint(data, field, 65535); err != nil {
+				return fmt.Errorf("SRV %s: %v", field, err)
+			}
+		}
+		if target, _ := data["target"].(string); !validHostname(target) && target != "." {
+			return fmt.Errorf("Invalid SRV target %q", target)
+		}
+		if !strings.HasPrefix(host, "_") {
+			return fmt.Errorf("SRV host must look like _service._proto")
+		}
+	case "CAA":
+		if _, err := dataUint(data, "flags", 255); err != nil {
+			return fmt.Errorf("CAA flags: %v", err)
+		}
+		switch tag, _ := data["tag"].(string); tag {
+		case "issue", "issuewild", "iodef":
+		default:
+			return fmt.Errorf("CAA tag must be issue, issuewild or iodef")
+		}
+		if value, _ := data["value"].(string); value == "" {
+			return fmt.Errorf("CAA value is required")
+		}
+	case "HTTPS", "SVCB":
+		if _, err := dataUint(data, "priority", 65535); err != nil {
+			return fmt.Errorf("%s priority: %v", rtype, err)
+		}
+		if target, _ := data["target"].(string); target != "." && !validHostname(target) {
+			return fmt.Errorf("Invalid %s target %q", rtype, target)
+		}
+	}
+	return nil
+}
+
+// dataUint reads a numeric field that may have been decoded from JSON
+// (float64) or built by the zone file parser (int).
+func dataUint(data map[string]interface{}, field string, max int) (int, error) {
+	var n int
+	switch v := data[field].(type) {
+	case int:
+		n = v
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("must be an integer")
+		}
+		n = int(v)
+	case string:
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("must be an integer")
+		}
+		n = i
+		data[field] = i
+	default:
+		return 0, fmt.Errorf("is required")
+	}
+	if n < 0 || n > max {
+		return 0, fmt.Errorf("must be between 0 and %d", max)
+	}
+	return n, nil
+}
+
+func validHostname(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '*':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
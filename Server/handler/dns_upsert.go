@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"cloudflare-tools/server/models"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// dnsBatchSize is the most changes one batch request may carry. Cloudflare
+// allows 200 on free zones and more on paid plans, so the lower limit is
+// used for every zone.
+const dnsBatchSize = 200
+
+// dnsBatch is the body of Cloudflare's batch DNS endpoint. Cloudflare applies
+// it as one transaction, deletes first and posts last, so either every change
+// lands or none does.
+type dnsBatch struct {
+	Deletes []map[string]interface{} `json:"deletes,omitempty"`
+	Puts    []map[string]interface{} `json:"puts,omitempty"`
+	Posts   []map[string]interface{} `json:"posts,omitempty"`
+}
+
+// checkBatchSize refuses a plan that doesn't fit in one batch request.
+// Splitting it would give up the transaction: a failure in a later request
+// would leave the earlier ones, deletes first, applied.
+func (p *syncPlan) checkBatchSize() error {
+	if n := len(p.delete) + len(p.update) + len(p.create); n > dnsBatchSize {
+		return fmt.Errorf("Too many changes for one transaction: %d, at most %d per zone", n, dnsBatchSize)
+	}
+	return nil
+}
+
+// applyDNSBatch writes plan to the zone in a single batch request.
+func applyDNSBatch(acc *models.Account, zoneID string, plan *syncPlan) error {
+	if err := plan.checkBatchSize(); err != nil {
+		return err
+	}
+	var batch dnsBatch
+	for _, r := range plan.delete {
+		batch.Deletes = append(batch.Deletes, map[string]interface{}{"id": r.ID})
+	}
+	for _, r := range plan.update {
+		payload := r.payload()
+		payload["id"] = r.ID
+		batch.Puts = append(batch.Puts, payload)
+	}
+	for _, r := range plan.create {
+		batch.Posts = append(batch.Posts, r.payload())
+	}
+	_, err := newCFClient(acc).Post(fmt.Sprintf("/zones/%s/dns_records/batch", zoneID), batch, nil)
+	return err
+}
+
+// zoneUpsert applies the upserts of one zone in a batch-parse request. The
+// first record of the zone to be picked up does the work for all of them;
+// the others wait for it and report their own outcome.
+type zoneUpsert struct {
+	once     sync.Once
+	domain   string
+	records  []int
+	outcomes map[int]upsertOutcome
+}
+
+type upsertOutcome struct {
+	success bool
+	msg     string
+	plan    []string
+}
+
+// groupUpserts groups the indexes of records by zone. Records without a
+// domain are left out.
+func groupUpserts(records []DNSRecord) map[string]*zoneUpsert {
+	zones := map[string]*zoneUpsert{}
+	for idx, r := range records {
+		domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(r.Domain), "."))
+		if domain == "" {
+			continue
+		}
+		u, ok := zones[domain]
+		if !ok {
+			u = &zoneUpsert{domain: domain}
+			zones[domain] = u
+		}
+		u.records = append(u.records, idx)
+	}
+	return zones
+}
+
+func upsertFor(zones map[string]*zoneUpsert, record DNSRecord) *zoneUpsert {
+	return zones[strings.ToLower(strings.TrimSuffix(strings.TrimSpace(record.Domain), "."))]
+}
+
+// result runs the zone's upsert if that hasn't happened yet and returns the
+// outcome of the record at idx.
+func (u *zoneUpsert) result(acc *models.Account, records []DNSRecord, idx int, ttl int, proxied bool, dryRun bool) (bool, string, []string) {
+	u.once.Do(func() {
+		u.run(acc, records, ttl, proxied, dryRun)
+	})
+	o := u.outcomes[idx]
+	return o.success, o.msg, o.plan
+}
+
+// run replaces the records of every name and type the request lists with
+// the requested ones. Records that already have a requested value are kept
+// (and have TTL and proxy status fixed up), the others are updated in place
+// while there are requested values left and deleted after that. New records
+// are only created when no old record is left to update.
+func (u *zoneUpsert) run(acc *models.Account, records []DNSRecord, ttl int, proxied bool, dryRun bool) {
+	u.outcomes = make(map[int]upsertOutcome, len(u.records))
+
+	var (
+		valid  []int
+		keys   = map[int]string{}
+		wanted []wantedRecord
+	)
+	groups := map[string]bool{}
+	seen := map[string]bool{}
+	for _, idx := range u.records {
+		rec, err := records[idx].prepare(ttl, proxied)
+		if err != nil {
+			u.outcomes[idx] = upsertOutcome{msg: err.Error()}
+			continue
+		}
+		rec.Name = strings.ToLower(recordFQDN(records[idx].Host, u.domain))
+		rec.Content = normalizeRecordContent(rec.Type, rec.Content)
+		if rec.Proxied {
+			rec.TTL = 1
+		}
+
+		key := syncValueKey(rec)
+		valid = append(valid, idx)
+		keys[idx] = key
+		groups[rec.Name+" "+rec.Type] = true
+		if !seen[key] {
+			seen[key] = true
+			wanted = append(wanted, wantedRecord{cfDNSRecord: rec, keepComment: true})
+		}
+	}
+	if len(valid) == 0 {
+		return
+	}
+	fail := func(msg string) {
+		for _, idx := range valid {
+			u.outcomes[idx] = upsertOutcome{msg: msg}
+		}
+	}
+
+	zoneID, err := getZoneID(acc, u.domain)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	all, err := listDNSRecords(acc, zoneID, nil)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	var current []cfDNSRecord
+	for _, r := range all {
+		if groups[strings.ToLower(r.Name)+" "+r.Type] {
+			current = append(current, r)
+		}
+	}
+
+	plan := diffDesiredState(wanted, current)
+	plan.delete = plan.unmanaged
+	if err := plan.checkBatchSize(); err != nil {
+		fail(err.Error())
+		return
+	}
+
+	actions := map[string]string{}
+	lines := map[string][]string{}
+	for _, r := range plan.create {
+		actions[syncValueKey(r)] = "Created"
+		lines[syncValueKey(r)] = []string{fmt.Sprintf("create %s (ttl %d, proxied %t)", r.describe(), r.TTL, r.Proxied)}
+	}
+	for i, r := range plan.update {
+		actions[syncValueKey(r)] = "Updated in place"
+		lines[syncValueKey(r)] = []string{fmt.Sprintf("update %s: %s", plan.current[i].describe(), strings.Join(syncFieldChanges(plan.current[i], r), ", "))}
+	}
+	// the old records a name and type loses are reported on its first record
+	removed := map[string][]string{}
+	for _, r := range plan.delete {
+		group := strings.ToLower(r.Name) + " " + r.Type
+		removed[group] = append(removed[group], "delete "+r.describe())
+	}
+
+	outcome := func(idx int) upsertOutcome {
+		key := keys[idx]
+		action, ok := actions[key]
+		if !ok {
+			action = "Unchanged"
+		}
+		steps := lines[key]
+		delete(lines, key)
+
+		name := strings.ToLower(recordFQDN(records[idx].Host, u.domain))
+		group := name + " " + strings.ToUpper(strings.TrimSpace(records[idx].Type))
+		if old := removed[group]; len(old) > 0 {
+			action += fmt.Sprintf(", removed %d old records", len(old))
+			steps = append(old, steps...)
+			delete(removed, group)
+		}
+		return upsertOutcome{success: true, msg: action, plan: steps}
+	}
+
+	if dryRun {
+		for _, idx := range valid {
+			o := outcome(idx)
+			o.msg = dryRunMessage(len(o.plan))
+			u.outcomes[idx] = o
+		}
+		return
+	}
+
+	if len(plan.create) > 0 || len(plan.update) > 0 || len(plan.delete) > 0 {
+		touched := append(append([]cfDNSRecord{}, plan.current...), plan.delete...)
+		if len(touched) > 0 {
+			if err := snapshotRecords(acc, u.domain, zoneID, "dns.upsert", touched); err != nil {
+				fail(err.Error())
+				return
+			}
+		}
+		if err := applyDNSBatch(acc, zoneID, plan); err != nil {
+			fail(fmt.Sprintf("Batch failed, no records were changed: %v", err))
+			return
+		}
+	}
+
+	for _, idx := range valid {
+		o := outcome(idx)
+		o.plan = nil
+		u.outcomes[idx] = o
+	}
+}
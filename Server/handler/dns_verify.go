@@ -0,0 +1,432 @@
+package handler
+
+import (
+	"cloudflare-tools/server/config"
+	"cloudflare-tools/server/dnscheck"
+	"cloudflare-tools/server/models"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var defaultResolvers = []string{"1.1.1.1", "8.8.8.8", "9.9.9.9"}
+
+const (
+	defaultVerifyWait = 10 * time.Second
+	maxVerifyWait     = 60 * time.Second
+	verifyInterval    = 2 * time.Second
+)
+
+// VerifyDNSRequest lists the records to check, either as expected values in
+// the batch-parse format (records/items) or as domains whose live Cloudflare
+// records are checked, optionally narrowed by recordType and hostRecord.
+type VerifyDNSRequest struct {
+	AccountID  string      `json:"accountId"`
+	Records    []string    `json:"records"`
+	Items      []DNSRecord `json:"items"`
+	Proxied    bool        `json:"proxied"`
+	Domains    []string    `json:"domains"`
+	RecordType string      `json:"recordType"`
+	HostRecord string      `json:"hostRecord"`
+	// Resolvers also asks the configured public resolvers
+	Resolvers bool `json:"resolvers"`
+	// Wait keeps asking the nameservers for up to this many seconds until
+	// every record matches
+	Wait int `json:"wait"`
+}
+
+type VerifyDNSResult struct {
+	Domain      string           `json:"domain"`
+	Success     bool             `json:"success"`
+	Message     string           `json:"message"`
+	NameServers []string         `json:"nameServers,omitempty"`
+	Checks      []DNSCheckResult `json:"checks"`
+}
+
+// DNSCheckResult tells whether a record is served as expected. Match covers
+// the zone's nameservers; Propagated is only set when public resolvers were
+// asked too.
+type DNSCheckResult struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Expected   string            `json:"expected"`
+	Proxied    bool              `json:"proxied"`
+	Match      bool              `json:"match"`
+	Propagated *bool             `json:"propagated,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Servers    []DNSServerAnswer `json:"servers,omitempty"`
+}
+
+type DNSServerAnswer struct {
+	Server  string   `json:"server"`
+	Role    string   `json:"role"`
+	Match   bool     `json:"match"`
+	RCode   string   `json:"rcode,omitempty"`
+	Answers []string `json:"answers,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// VerifyDNS asks the zone's Cloudflare nameservers, and optionally public
+// resolvers, whether records are live. Proxied records match when every
+// answer is a Cloudflare address.
+func VerifyDNS(c *gin.Context) {
+	var req VerifyDNSRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	subdomains, ok := normalizeRecordTargets(c, &req.Domains)
+	if !ok {
+		return
+	}
+
+	acc := findAccount(req.AccountID)
+	if acc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	wait := time.Duration(req.Wait) * time.Second
+	if wait > maxVerifyWait {
+		wait = maxVerifyWait
+	}
+
+	records := append(parseRecords(req.Records), req.Items...)
+	if !normalizeRecordDomains(c, records) {
+		return
+	}
+	var domains, hosts []string
+	expected := map[string][]DNSRecord{}
+	if len(records) > 0 {
+		for _, r := range records {
+			dom := strings.ToLower(strings.TrimSpace(r.Domain))
+			if _, ok := expected[dom]; !ok {
+				domains = append(domains, dom)
+			}
+			expected[dom] = append(expected[dom], r)
+		}
+	} else {
+		domains = req.Domains
+		hosts = make([]string, len(domains))
+		for i, dom := range domains {
+			hosts[i] = underSubdomain(req.HostRecord, subdomains[i], dom)
+		}
+	}
+	if len(domains) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No records or domains provided"})
+		return
+	}
+
+	results := make([]VerifyDNSResult, len(domains))
+	forEachBounded(len(domains), func(idx int) {
+		dom := domains[idx]
+		result := VerifyDNSResult{Domain: dom, Checks: []DNSCheckResult{}}
+		if hosts != nil {
+			result.Domain = recordFQDN(subdomains[idx], dom)
+		}
+
+		var (
+			zoneID  string
+			targets []cfDNSRecord
+			err     error
+		)
+		if len(records) > 0 {
+			zoneID, err = getZoneID(acc, dom)
+			for _, r := range expected[dom] {
+				rec, perr := r.prepare(0, req.Proxied)
+				if perr != nil {
+					result.Checks = append(result.Checks, DNSCheckResult{Name: recordFQDN(r.Host, dom), Type: strings.ToUpper(r.Type), Error: perr.Error()})
+					continue
+				}
+				rec.Name = recordFQDN(r.Host, dom)
+				targets = append(targets, rec)
+			}
+		} else {
+			zoneID, targets, err = matchDNSRecords(acc, dom, strings.ToUpper(req.RecordType), hosts[idx], false)
+		}
+		if err != nil {
+			result.Message = err.Error()
+			results[idx] = result
+			return
+		}
+
+		nameServers, checks, err := verifyRecords(acc, zoneID, targets, req.Resolvers, wait)
+		if err != nil {
+			result.Message = err.Error()
+			results[idx] = result
+			return
+		}
+		result.NameServers = nameServers
+		result.Checks = append(result.Checks, checks...)
+		result.Success, result.Message = summarizeChecks(result.Checks, req.Resolvers)
+		results[idx] = result
+	})
+	c.JSON(http.StatusOK, results)
+}
+
+// verifyAddedRecord checks a record batch-parse just wrote, waiting up to
+// wait for the nameservers to serve it.
+func verifyAddedRecord(acc *models.Account, record DNSRecord, ttl int, proxied bool, wait time.Duration) *DNSCheckResult {
+	rec, err := record.prepare(ttl, proxied)
+	if err != nil {
+		return &DNSCheckResult{Name: record.Host, Type: record.Type, Error: err.Error()}
+	}
+	rec.Name = recordFQDN(record.Host, record.Domain)
+
+	zoneID, err := getZoneID(acc, record.Domain)
+	if err == nil {
+		var checks []DNSCheckResult
+		if _, checks, err = verifyRecords(acc, zoneID, []cfDNSRecord{rec}, false, wait); err == nil {
+			return &checks[0]
+		}
+	}
+	return &DNSCheckResult{Name: strings.ToLower(rec.Name), Type: rec.Type, Error: err.Error()}
+}
+
+// verifyProxyToggle checks the proxiable records a proxy toggle changed.
+func verifyProxyToggle(acc *models.Account, domain string, recordType string, hostRecord string, wait time.Duration) []DNSCheckResult {
+	zoneID, records, err := matchDNSRecords(acc, domain, recordType, hostRecord, false)
+	if err != nil {
+		return []DNSCheckResult{{Name: domain, Error: err.Error()}}
+	}
+	var proxiable []cfDNSRecord
+	for _, r := range records {
+		if r.proxiable() {
+			proxiable = append(proxiable, r)
+		}
+	}
+	_, checks, err := verifyRecords(acc, zoneID, proxiable, false, wait)
+	if err != nil {
+		return []DNSCheckResult{{Name: domain, Error: err.Error()}}
+	}
+	return checks
+}
+
+// verifyRecords checks records against the zone's nameservers, asking again
+// every couple of seconds until all of them match or wait runs out, and then
+// asks the public resolvers once if resolvers is set.
+func verifyRecords(acc *models.Account, zoneID string, records []cfDNSRecord, resolvers bool, wait time.Duration) ([]string, []DNSCheckResult, error) {
+	nameServers, err := zoneNameServers(acc, zoneID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(nameServers) == 0 {
+		return nil, nil, fmt.Errorf("Zone has no nameservers")
+	}
+
+	client := newDNSClient()
+	checks := make([]DNSCheckResult, len(records))
+	deadline := time.Now().Add(wait)
+	for {
+		answers := dnsAnswerCache{client: client, answers: map[string]*dnscheck.Answer{}, errs: map[string]error{}}
+		pending := 0
+		for i, r := range records {
+			if checks[i].Match {
+				continue
+			}
+			checks[i] = checkRecord(&answers, r, nameServers, "nameserver")
+			if !checks[i].Match {
+				pending++
+			}
+		}
+		if pending == 0 || time.Now().Add(verifyInterval).After(deadline) {
+			break
+		}
+		time.Sleep(verifyInterval)
+	}
+
+	if resolvers {
+		answers := dnsAnswerCache{client: client, answers: map[string]*dnscheck.Answer{}, errs: map[string]error{}}
+		servers := publicResolvers()
+		for i, r := range records {
+			check := checkRecord(&answers, r, servers, "resolver")
+			propagated := check.Match
+			checks[i].Propagated = &propagated
+			checks[i].Servers = append(checks[i].Servers, check.Servers...)
+		}
+	}
+	return nameServers, checks, nil
+}
+
+// dnsAnswerCache shares one answer between the records that need the same
+// query, e.g. several A records of one name.
+type dnsAnswerCache struct {
+	client  *dnscheck.Client
+	answers map[string]*dnscheck.Answer
+	errs    map[string]error
+}
+
+func (c *dnsAnswerCache) query(server string, name string, rtype string) (*dnscheck.Answer, error) {
+	key := server + " " + name + " " + rtype
+	if answer, ok := c.answers[key]; ok {
+		return answer, c.errs[key]
+	}
+	answer, err := c.client.Query(server, name, rtype)
+	c.answers[key] = answer
+	c.errs[key] = err
+	return answer, err
+}
+
+func checkRecord(answers *dnsAnswerCache, r cfDNSRecord, servers []string, role string) DNSCheckResult {
+	check := DNSCheckResult{
+		Name:     strings.ToLower(r.Name),
+		Type:     r.Type,
+		Expected: expectedValue(r),
+		Proxied:  r.Proxied,
+		Match:    true,
+	}
+
+	// proxied names resolve to Cloudflare's own addresses, CNAMEs included
+	qtype := r.Type
+	if r.Proxied {
+		check.Expected = "Cloudflare proxy"
+		if qtype != "AAAA" {
+			qtype = "A"
+		}
+	}
+
+	for _, server := range servers {
+		sa := DNSServerAnswer{Server: server, Role: role}
+		answer, err := answers.query(server, check.Name, qtype)
+		if err != nil {
+			sa.Error = err.Error()
+		} else {
+			sa.RCode = answer.RCode
+			sa.Answers = answer.Values(qtype)
+			sa.Match = answerMatches(r, check.Expected, sa.Answers)
+		}
+		if !sa.Match {
+			check.Match = false
+		}
+		check.Servers = append(check.Servers, sa)
+	}
+	return check
+}
+
+func answerMatches(r cfDNSRecord, expected string, answers []string) bool {
+	if r.Proxied {
+		for _, ip := range answers {
+			if !dnscheck.IsCloudflareIP(ip) {
+				return false
+			}
+		}
+		return len(answers) > 0
+	}
+	for _, a := range answers {
+		if a == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedValue formats r the way dnscheck presents answers.
+func expectedValue(r cfDNSRecord) string {
+	switch r.Type {
+	case "AAAA":
+		if ip := net.ParseIP(r.Content); ip != nil {
+			return ip.String()
+		}
+	case "CNAME", "NS", "PTR":
+		return strings.ToLower(strings.TrimSuffix(r.Content, "."))
+	case "MX":
+		priority := 0
+		if r.Priority != nil {
+			priority = *r.Priority
+		}
+		return fmt.Sprintf("%d %s", priority, strings.ToLower(strings.TrimSuffix(r.Content, ".")))
+	case "TXT":
+		// Cloudflare may hand TXT content back as quoted strings
+		content := r.Content
+		if len(content) >= 2 && strings.HasPrefix(content, `"`) && strings.HasSuffix(content, `"`) {
+			content = strings.Join(strings.Split(content[1:len(content)-1], `" "`), "")
+		}
+		return content
+	case "SRV":
+		if r.Data != nil {
+			priority, _ := dataUint(r.Data, "priority", 65535)
+			weight, _ := dataUint(r.Data, "weight", 65535)
+			port, _ := dataUint(r.Data, "port", 65535)
+			return fmt.Sprintf("%d %d %d %s", priority, weight, port, dataTarget(r.Data))
+		}
+	case "CAA":
+		if r.Data != nil {
+			flags, _ := dataUint(r.Data, "flags", 255)
+			tag, _ := r.Data["tag"].(string)
+			value, _ := r.Data["value"].(string)
+			return fmt.Sprintf("%d %s %s", flags, tag, strconv.Quote(value))
+		}
+	case "HTTPS", "SVCB":
+		if r.Data != nil {
+			priority, _ := dataUint(r.Data, "priority", 65535)
+			return fmt.Sprintf("%d %s", priority, dataTarget(r.Data))
+		}
+	}
+	return r.Content
+}
+
+func dataTarget(data map[string]interface{}) string {
+	target, _ := data["target"].(string)
+	if target == "." {
+		return target
+	}
+	return strings.ToLower(strings.TrimSuffix(target, "."))
+}
+
+func summarizeChecks(checks []DNSCheckResult, resolvers bool) (bool, string) {
+	live, propagated := 0, 0
+	for _, check := range checks {
+		if check.Match {
+			live++
+		}
+		if check.Propagated != nil && *check.Propagated {
+			propagated++
+		}
+	}
+	msg := fmt.Sprintf("%d/%d records live on nameservers", live, len(checks))
+	if resolvers {
+		msg += fmt.Sprintf(", %d/%d propagated to resolvers", propagated, len(checks))
+	}
+	return live == len(checks), msg
+}
+
+// zoneNameServers returns the nameservers to check: the configured ones when
+// set, otherwise those Cloudflare assigned to the zone.
+func zoneNameServers(acc *models.Account, zoneID string) ([]string, error) {
+	if servers := config.GlobalConfig.DNSCheck.NameServers; len(servers) > 0 {
+		return servers, nil
+	}
+	var zone cfZone
+	if _, err := newCFClient(acc).Get(fmt.Sprintf("/zones/%s", zoneID), nil, &zone); err != nil {
+		return nil, err
+	}
+	return zone.NameServers, nil
+}
+
+func newDNSClient() *dnscheck.Client {
+	client := dnscheck.NewClient()
+	if timeout := config.GlobalConfig.DNSCheck.Timeout; timeout > 0 {
+		client.Timeout = time.Duration(timeout) * time.Second
+	}
+	return client
+}
+
+func publicResolvers() []string {
+	if servers := config.GlobalConfig.DNSCheck.Resolvers; len(servers) > 0 {
+		return servers
+	}
+	return defaultResolvers
+}
+
+func verifyWait() time.Duration {
+	if wait := config.GlobalConfig.DNSCheck.Wait; wait > 0 {
+		return time.Duration(wait) * time.Second
+	}
+	return defaultVerifyWait
+}
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"cloudflare-tools/server/models"
+	"cloudflare-tools/server/zonefile"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ZoneFileRequest struct {
+	AccountID string `json:"accountId"`
+	Domain    string `json:"domain"`
+	Content   string `json:"content"`
+	// Proxied is applied to proxiable records that carry no cf-proxied tag
+	Proxied bool `json:"proxied"`
+	DryRun  bool `json:"dryRun"`
+}
+
+type ZoneFilePreviewRecord struct {
+	zonefile.Record
+	Action string `json:"action"`
+}
+
+type ZoneFilePreview struct {
+	Domain   string                  `json:"domain"`
+	Create   int                     `json:"create"`
+	Existing int                     `json:"existing"`
+	Records  []ZoneFilePreviewRecord `json:"records"`
+	Skipped  []zonefile.Skipped      `json:"skipped,omitempty"`
+	Errors   []zonefile.ParseError   `json:"errors,omitempty"`
+}
+
+type ZoneFileImportResult struct {
+	Domain  string   `json:"domain"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Value   string   `json:"value"`
+	Success bool     `json:"success"`
+	Message string   `json:"message"`
+	Retries int      `json:"retries,omitempty"`
+	Plan    []string `json:"plan,omitempty"`
+}
+
+// PreviewZoneFile parses a BIND zone file and shows which records would be
+// created in the target zone and which already exist there.
+func PreviewZoneFile(c *gin.Context) {
+	var req ZoneFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	acc := routeDomain(c, req.AccountID, req.Domain)
+	if acc == nil {
+		return
+	}
+
+	preview, _, err := previewZoneFile(acc, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, preview)
+}
+
+// ImportZoneFile creates the records of a zone file that the target zone
+// doesn't have yet. Files with parse errors are rejected as a whole; use the
+// preview to find the offending lines.
+func ImportZoneFile(c *gin.Context) {
+	var req ZoneFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	acc := routeDomain(c, req.AccountID, req.Domain)
+	if acc == nil {
+		return
+	}
+
+	preview, zoneID, err := previewZoneFile(acc, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(preview.Errors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Zone file has errors", "errors": preview.Errors})
+		return
+	}
+
+	var records []zonefile.Record
+	for _, r := range preview.Records {
+		if r.Action == "create" {
+			records = append(records, r.Record)
+		}
+	}
+	if len(records) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No new records to import"})
+		return
+	}
+
+	runBatch(c, "dns.zonefile-import", acc, &req, len(records), func(idx int, acc *models.Account) ZoneFileImportResult {
+		rec := fromZoneRecord(records[idx])
+		rdata, _ := records[idx].RData()
+		result := ZoneFileImportResult{
+			Domain: preview.Domain,
+			Name:   rec.Name,
+			Type:   rec.Type,
+			Value:  rdata,
+		}
+		if req.DryRun {
+			result.Success = true
+			result.Message = dryRunMessage(1)
+			result.Plan = []string{"create " + rec.describe()}
+		} else if _, err := newCFClient(acc).Post(fmt.Sprintf("/zones/%s/dns_records", zoneID), rec.payload(), nil); err != nil {
+			result.Message = err.Error()
+		} else {
+			result.Success = true
+			result.Message = "Success"
+		}
+		result.Retries = retriesFor(acc)
+		return result
+	})
+}
+
+// ExportZoneFile downloads all records of a zone as a BIND zone file.
+func ExportZoneFile(c *gin.Context) {
+	acc := findAccount(c.Query("accountId"))
+	if acc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(c.Query("domain")))
+	zoneID, err := getZoneID(acc, domain)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	records, err := listDNSRecords(acc, zoneID, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	zoneRecords := make([]zonefile.Record, 0, len(records))
+	for _, r := range records {
+		zoneRecords = append(zoneRecords, toZoneRecord(r))
+	}
+
+	c.Header("Content-Disposition", "attachment; filename="+domain+".zone")
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(zonefile.Generate(domain, 0, zoneRecords)))
+}
+
+func previewZoneFile(acc *models.Account, req *ZoneFileRequest) (*ZoneFilePreview, string, error) {
+	domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(req.Domain), "."))
+	if domain == "" || strings.TrimSpace(req.Content) == "" {
+		return nil, "", fmt.Errorf("Domain and zone file are required")
+	}
+
+	zoneID, err := getZoneID(acc, domain)
+	if err != nil {
+		return nil, "", err
+	}
+	current, err := listDNSRecords(acc, zoneID, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	existing := make(map[string]bool, len(current))
+	for _, r := range current {
+		existing[zoneRecordKey(toZoneRecord(r))] = true
+	}
+
+	parsed := zonefile.Parse(req.Content, domain)
+	preview := &ZoneFilePreview{
+		Domain:  domain,
+		Records: []ZoneFilePreviewRecord{},
+		Skipped: parsed.Skipped,
+		Errors:  parsed.Errors,
+	}
+	for _, r := range parsed.Records {
+		if r.Name != domain && !strings.HasSuffix(r.Name, "."+domain) {
+			preview.Skipped = append(preview.Skipped, zonefile.Skipped{Line: r.Line, Type: r.Type, Name: r.Name, Reason: "outside of zone " + domain})
+			continue
+		}
+		if !r.Proxied && req.Proxied {
+			r.Proxied = fromZoneRecord(r).proxiable()
+		}
+		action := "create"
+		if existing[zoneRecordKey(r)] {
+			action = "exists"
+			preview.Existing++
+		} else {
+			preview.Create++
+		}
+		preview.Records = append(preview.Records, ZoneFilePreviewRecord{Record: r, Action: action})
+	}
+	return preview, zoneID, nil
+}
+
+// zoneRecordKey identifies a record by name, type and data regardless of TTL
+// and proxy status. The data is parsed again so that names in it are
+// lowercased and qualified the same way for records from the file and
+// records read from Cloudflare.
+func zoneRecordKey(r zonefile.Record) string {
+	rdata, _ := r.RData()
+	if parsed, err := zonefile.ParseRData(r.Type, rdata, ""); err == nil {
+		rdata, _ = parsed.RData()
+	}
+	return strings.ToLower(strings.TrimSuffix(r.Name, ".")) + " " + strings.ToUpper(r.Type) + " " + rdata
+}
+
+func toZoneRecord(r cfDNSRecord) zonefile.Record {
+	ttl := r.TTL
+	if ttl <= 1 {
+		// 1 means "automatic", which Cloudflare serves as 300
+		ttl = 300
+	}
+	return zonefile.Record{
+		Name:     r.Name,
+		TTL:      ttl,
+		Type:     r.Type,
+		Content:  r.Content,
+		Priority: r.Priority,
+		Data:     r.Data,
+		Proxied:  r.Proxied,
+	}
+}
+
+func fromZoneRecord(r zonefile.Record) cfDNSRecord {
+	rec := cfDNSRecord{
+		Type:     r.Type,
+		Name:     r.Name,
+		Content:  r.Content,
+		TTL:      r.TTL,
+		Priority: r.Priority,
+		Data:     r.Data,
+	}
+	if rec.proxiable() && r.Proxied {
+		rec.Proxied = true
+		rec.TTL = 1
+	}
+	return rec
+}
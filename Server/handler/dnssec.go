@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"bytes"
+	"cloudflare-tools/server/models"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BatchDNSSECRequest struct {
+	AccountID string   `json:"accountId"`
+	Domains   []string `json:"domains"`
+	// Action is enable or disable
+	Action string `json:"action"`
+	DryRun bool   `json:"dryRun"`
+}
+
+type DNSSECStatusRequest struct {
+	AccountID string   `json:"accountId"`
+	Domains   []string `json:"domains"`
+	// Verify looks up the DS records the parent zone publishes
+	Verify bool `json:"verify"`
+	// Resolver is used for Verify instead of the first dns_check resolver
+	Resolver string `json:"resolver"`
+}
+
+// DSRecord is the record to add at the registrar.
+type DSRecord struct {
+	KeyTag     int    `json:"keyTag"`
+	Algorithm  int    `json:"algorithm"`
+	DigestType int    `json:"digestType"`
+	Digest     string `json:"digest"`
+	// Record is the DS record in zone file form
+	Record string `json:"record"`
+}
+
+type DNSSECResult struct {
+	Domain  string    `json:"domain"`
+	Success bool      `json:"success"`
+	Message string    `json:"message"`
+	Status  string    `json:"status,omitempty"`
+	DS      *DSRecord `json:"ds,omitempty"`
+	// ParentStatus is match, missing, mismatch or stale (a DS is published
+	// although DNSSEC is disabled, which breaks resolution)
+	ParentStatus string   `json:"parentStatus,omitempty"`
+	ParentDS     []string `json:"parentDs,omitempty"`
+	Retries      int      `json:"retries,omitempty"`
+	Plan         []string `json:"plan,omitempty"`
+}
+
+// cfDNSSEC is the DNSSEC state of a zone as returned by the Cloudflare API.
+type cfDNSSEC struct {
+	Status     string `json:"status"`
+	DS         string `json:"ds"`
+	KeyTag     int    `json:"key_tag"`
+	Algorithm  string `json:"algorithm"`
+	DigestType string `json:"digest_type"`
+	Digest     string `json:"digest"`
+}
+
+func (d cfDNSSEC) dsRecord() *DSRecord {
+	if d.Digest == "" {
+		return nil
+	}
+	alg, _ := strconv.Atoi(d.Algorithm)
+	digestType, _ := strconv.Atoi(d.DigestType)
+	return &DSRecord{
+		KeyTag:     d.KeyTag,
+		Algorithm:  alg,
+		DigestType: digestType,
+		Digest:     strings.ToUpper(d.Digest),
+		Record:     d.DS,
+	}
+}
+
+// BatchDNSSEC enables or disables DNSSEC on every domain and returns the DS
+// record to publish at the registrar.
+func BatchDNSSEC(c *gin.Context) {
+	var req BatchDNSSECRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !normalizeZones(c, &req.Domains) {
+		return
+	}
+
+	var status string
+	switch req.Action {
+	case "enable":
+		status = "active"
+	case "disable":
+		status = "disabled"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Action must be enable or disable"})
+		return
+	}
+
+	route := routeBatch(c, req.AccountID, req.Domains)
+	if route == nil {
+		return
+	}
+
+	runRoutedBatch(c, "dnssec."+req.Action, route, &req, len(req.Domains), func(idx int, acc *models.Account) DNSSECResult {
+		dom := req.Domains[idx]
+		var result DNSSECResult
+		if req.DryRun {
+			result = planDNSSEC(acc, dom, status)
+		} else {
+			result = setDNSSEC(acc, dom, status)
+		}
+		result.Retries = retriesFor(acc)
+		return result
+	})
+}
+
+// DNSSECStatus lists the DNSSEC state and DS record of the requested zones,
+// or of every zone in the account. With ?format=csv the table is downloaded
+// as a CSV file.
+func DNSSECStatus(c *gin.Context) {
+	var req DNSSECStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !normalizeZones(c, &req.Domains) {
+		return
+	}
+
+	acc := findAccount(req.AccountID)
+	if acc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	domains, err := domainsOrAllZones(acc, req.Domains)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resolver := req.Resolver
+	if resolver == "" {
+		resolver = publicResolvers()[0]
+	}
+
+	results := make([]DNSSECResult, len(domains))
+	forEachBounded(len(domains), func(idx int) {
+		dom := domains[idx]
+		result := DNSSECResult{Domain: dom}
+		zoneID, err := getZoneID(acc, dom)
+		if err == nil {
+			var state *cfDNSSEC
+			if state, err = getDNSSEC(acc, zoneID); err == nil {
+				result.Success = true
+				result.Message = "Success"
+				result.Status = state.Status
+				result.DS = state.dsRecord()
+				if req.Verify {
+					verifyParentDS(&result, resolver)
+				}
+			}
+		}
+		if err != nil {
+			result.Message = err.Error()
+		}
+		results[idx] = result
+	})
+
+	if c.Query("format") == "csv" {
+		data, err := dnssecCSV(results)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename=dnssec.csv")
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+func getDNSSEC(acc *models.Account, zoneID string) (*cfDNSSEC, error) {
+	var state cfDNSSEC
+	if _, err := newCFClient(acc).Get(fmt.Sprintf("/zones/%s/dnssec", zoneID), nil, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func setDNSSEC(acc *models.Account, domain string, status string) DNSSECResult {
+	result := DNSSECResult{Domain: domain}
+	zoneID, err := getZoneID(acc, domain)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	var state cfDNSSEC
+	if _, err := newCFClient(acc).Patch(fmt.Sprintf("/zones/%s/dnssec", zoneID), map[string]interface{}{"status": status}, &state); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.Success = true
+	result.Message = "Success"
+	result.Status = state.Status
+	if status == "active" {
+		result.DS = state.dsRecord()
+		if result.DS == nil {
+			// the PATCH response doesn't always carry the key yet
+			if current, err := getDNSSEC(acc, zoneID); err == nil {
+				result.DS = current.dsRecord()
+			}
+		}
+	}
+	return result
+}
+
+func planDNSSEC(acc *models.Account, domain string, status string) DNSSECResult {
+	result := DNSSECResult{Domain: domain}
+	zoneID, err := getZoneID(acc, domain)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	state, err := getDNSSEC(acc, zoneID)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Status = state.Status
+	if state.Status == status || (status == "active" && state.Status == "pending") {
+		result.Plan = []string{fmt.Sprintf("dnssec: %s (unchanged)", state.Status)}
+	} else {
+		result.Plan = []string{fmt.Sprintf("dnssec: %s -> %s", state.Status, status)}
+	}
+	result.Message = dryRunMessage(len(result.Plan))
+	return result
+}
+
+// verifyParentDS compares the DS records the parent publishes for the zone
+// with the one Cloudflare signs with.
+func verifyParentDS(result *DNSSECResult, resolver string) {
+	answer, err := newDNSClient().Query(resolver, result.Domain, "DS")
+	if err != nil {
+		result.Message = "Parent lookup failed: " + err.Error()
+		return
+	}
+	result.ParentDS = answer.Values("DS")
+
+	enabled := result.Status == "active" || result.Status == "pending"
+	switch {
+	case !enabled && len(result.ParentDS) > 0:
+		result.ParentStatus = "stale"
+		result.Message = "Parent publishes a DS record but DNSSEC is disabled"
+	case !enabled:
+		return
+	case len(result.ParentDS) == 0:
+		result.ParentStatus = "missing"
+		result.Message = "DS record not published at the parent"
+	case result.DS != nil && containsDS(result.ParentDS, result.DS):
+		result.ParentStatus = "match"
+		result.Message = "DS record published"
+	default:
+		result.ParentStatus = "mismatch"
+		result.Message = "Parent publishes a different DS record"
+	}
+}
+
+func containsDS(published []string, ds *DSRecord) bool {
+	want := fmt.Sprintf("%d %d %d %s", ds.KeyTag, ds.Algorithm, ds.DigestType, ds.Digest)
+	for _, value := range published {
+		if strings.EqualFold(value, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func dnssecCSV(results []DNSSECResult) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"domain", "status", "key_tag", "algorithm", "digest_type", "digest", "ds_record", "parent_status"})
+	for _, r := range results {
+		row := []string{r.Domain, r.Status, "", "", "", "", "", r.ParentStatus}
+		if r.DS != nil {
+			row[2] = strconv.Itoa(r.DS.KeyTag)
+			row[3] = strconv.Itoa(r.DS.Algorithm)
+			row[4] = strconv.Itoa(r.DS.DigestType)
+			row[5] = r.DS.Digest
+			row[6] = r.DS.Record
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
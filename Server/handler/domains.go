@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"cloudflare-tools/server/domains"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NormalizeDomainsRequest struct {
+	// Domains are the lines of the input, blank ones included so the
+	// rejections carry the line numbers the user sees
+	Domains []string `json:"domains"`
+}
+
+type NormalizeDomainsResponse struct {
+	Domains  []domains.Domain    `json:"domains"`
+	Zones    []string            `json:"zones"`
+	Rejected []domains.Rejection `json:"rejected"`
+}
+
+// NormalizeDomains shows how a domain list will be read by the batch
+// endpoints, so a form can point at the rejected lines before submitting.
+func NormalizeDomains(c *gin.Context) {
+	var req NormalizeDomainsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	list, rejected := domains.ParseLines(req.Domains)
+	if list == nil {
+		list = []domains.Domain{}
+	}
+	if rejected == nil {
+		rejected = []domains.Rejection{}
+	}
+	c.JSON(http.StatusOK, NormalizeDomainsResponse{Domains: list, Zones: domains.Zones(list), Rejected: rejected})
+}
+
+// normalizeZones cleans up the domains of a zone-level request (settings,
+// DNSSEC, adding or deleting zones) and drops duplicates. An input inside a
+// zone, such as shop.example.com, is rejected rather than quietly applied to
+// example.com. When any input is rejected it answers 400 listing every
+// rejected line and returns false.
+func normalizeZones(c *gin.Context, list *[]string) bool {
+	parsed, rejected := domains.ParseLines(*list)
+	for _, d := range parsed {
+		if d.Host != "" {
+			rejected = append(rejected, domains.Rejection{
+				Line:  d.Line,
+				Input: d.Input,
+				Error: fmt.Sprintf("%s is not a zone, use %s", d.Name, d.Zone),
+			})
+		}
+	}
+	if len(rejected) > 0 {
+		sort.SliceStable(rejected, func(i, j int) bool { return rejected[i].Line < rejected[j].Line })
+		rejectDomains(c, rejected)
+		return false
+	}
+	*list = domains.Zones(parsed)
+	return true
+}
+
+// normalizeRecordTargets cleans up the domains of a request that selects
+// records. Each input is replaced by its zone and the subdomain part is
+// returned at the same index, empty for the zone itself, so the host filter
+// can be narrowed with underSubdomain. The same zone may appear more than
+// once, for different subdomains.
+func normalizeRecordTargets(c *gin.Context, list *[]string) ([]string, bool) {
+	parsed, rejected := domains.ParseLines(*list)
+	if len(rejected) > 0 {
+		rejectDomains(c, rejected)
+		return nil, false
+	}
+	zones := make([]string, len(parsed))
+	hosts := make([]string, len(parsed))
+	for i, d := range parsed {
+		zones[i] = d.Zone
+		hosts[i] = d.Host
+	}
+	*list = zones
+	return hosts, true
+}
+
+// normalizeNames is normalizeZones for inputs that name hosts, not zones.
+func normalizeNames(c *gin.Context, list *[]string) bool {
+	parsed, rejected := domains.ParseLines(*list)
+	if len(rejected) > 0 {
+		rejectDomains(c, rejected)
+		return false
+	}
+	*list = domains.Names(parsed)
+	return true
+}
+
+// normalizeRecordDomains moves the subdomain part of each record's domain
+// into its host, so shop.example.co.uk|www becomes example.co.uk|www.shop.
+// Line is the position of the record.
+func normalizeRecordDomains(c *gin.Context, records []DNSRecord) bool {
+	var rejected []domains.Rejection
+	for i := range records {
+		d, err := domains.Parse(records[i].Domain)
+		if err != nil {
+			rejected = append(rejected, domains.Rejection{Line: i + 1, Input: records[i].Domain, Error: err.Error()})
+			continue
+		}
+		records[i].Domain = d.Zone
+		if d.Host != "" {
+			records[i].Host = subdomainHost(records[i].Host, d)
+		}
+	}
+	if len(rejected) > 0 {
+		rejectDomains(c, rejected)
+		return false
+	}
+	return true
+}
+
+// subdomainHost puts a host record ("www", "@", "*") under the subdomain
+// of d.
+func subdomainHost(host string, d domains.Domain) string {
+	return underSubdomain(host, d.Host, d.Zone)
+}
+
+// underSubdomain puts a host record ("www", "@", "*") under sub, a subdomain
+// of zone. Hosts that are already full names in zone are kept, and an empty
+// sub leaves host as it is.
+func underSubdomain(host string, sub string, zone string) string {
+	if sub == "" {
+		return host
+	}
+	host = strings.TrimSpace(host)
+	if host == "" || host == "@" {
+		return sub
+	}
+	lower := strings.ToLower(strings.TrimSuffix(host, "."))
+	if lower == zone || strings.HasSuffix(lower, "."+zone) {
+		return host
+	}
+	return host + "." + sub
+}
+
+func rejectDomains(c *gin.Context, rejected []domains.Rejection) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domains", "rejected": rejected})
+}
@@ -1,13 +1,10 @@
 package handler
 
 import (
-	"bytes"
 	"cloudflare-tools/server/models"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"sync"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,12 +13,15 @@ type BatchEmailRoutingRequest struct {
 	AccountID string   `json:"accountId"`
 	Domains   []string `json:"domains"`
 	Worker    string   `json:"worker"`
+	DryRun    bool     `json:"dryRun"`
 }
 
 type EmailRoutingResult struct {
-	Domain  string `json:"domain"`
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+	Domain  string   `json:"domain"`
+	Success bool     `json:"success"`
+	Message string   `json:"message"`
+	Retries int      `json:"retries,omitempty"`
+	Plan    []string `json:"plan,omitempty"`
 }
 
 func BatchEmailRouting(c *gin.Context) {
@@ -31,37 +31,35 @@ func BatchEmailRouting(c *gin.Context) {
 		return
 	}
 
-	var acc *models.Account
-	for _, a := range models.Accounts {
-		if a.ID == req.AccountID {
-			acc = &a
-			break
-		}
-	}
-
-	if acc == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	if !normalizeZones(c, &req.Domains) {
 		return
 	}
 
-	results := make([]EmailRoutingResult, len(req.Domains))
-	var wg sync.WaitGroup
-
-	for i, domain := range req.Domains {
-		wg.Add(1)
-		go func(idx int, dom string) {
-			defer wg.Done()
-			success, msg := processEmailRouting(acc, dom, req.Worker)
-			results[idx] = EmailRoutingResult{
-				Domain:  dom,
-				Success: success,
-				Message: msg,
-			}
-		}(i, domain)
+	route := routeBatch(c, req.AccountID, req.Domains)
+	if route == nil {
+		return
 	}
 
-	wg.Wait()
-	c.JSON(http.StatusOK, results)
+	runRoutedBatch(c, "email.batch-routing", route, &req, len(req.Domains), func(idx int, acc *models.Account) EmailRoutingResult {
+		dom := req.Domains[idx]
+		var (
+			success bool
+			msg     string
+			plan    []string
+		)
+		if req.DryRun {
+			success, msg, plan = planEmailRouting(acc, dom, req.Worker)
+		} else {
+			success, msg = processEmailRouting(acc, dom, req.Worker)
+		}
+		return EmailRoutingResult{
+			Domain:  dom,
+			Success: success,
+			Message: msg,
+			Retries: retriesFor(acc),
+			Plan:    plan,
+		}
+	})
 }
 
 func processEmailRouting(acc *models.Account, domain string, workerName string) (bool, string) {
@@ -81,26 +79,42 @@ func processEmailRouting(acc *models.Account, domain string, workerName string)
 	return true, "Success"
 }
 
-func enableEmailRouting(acc *models.Account, zoneID string) (bool, string) {
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/email/routing/dns", zoneID)
-	req, _ := http.NewRequest("POST", url, nil)
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-	req.Header.Add("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func planEmailRouting(acc *models.Account, domain string, workerName string) (bool, string, []string) {
+	zoneID, err := getZoneID(acc, domain)
 	if err != nil {
-		return false, "Request failed"
+		return false, err.Error(), nil
+	}
+
+	var rule struct {
+		Actions []struct {
+			Type  string   `json:"type"`
+			Value []string `json:"value"`
+		} `json:"actions"`
+		Enabled bool `json:"enabled"`
+	}
+	current := "?"
+	if _, err := newCFClient(acc).Get(fmt.Sprintf("/zones/%s/email/routing/rules/catch_all", zoneID), nil, &rule); err == nil {
+		current = "disabled"
+		if rule.Enabled && len(rule.Actions) > 0 {
+			current = rule.Actions[0].Type
+			if len(rule.Actions[0].Value) > 0 {
+				current += ":" + strings.Join(rule.Actions[0].Value, ",")
+			}
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
-		return true, "Success"
+	plan := []string{
+		"enable email routing DNS records",
+		fmt.Sprintf("catch_all: %s -> worker:%s", current, workerName),
 	}
+	return true, dryRunMessage(len(plan)), plan
+}
 
-	respBody, _ := ioutil.ReadAll(resp.Body)
-	return false, fmt.Sprintf("HTTP %d: %s", resp.StatusCode, string(respBody))
+func enableEmailRouting(acc *models.Account, zoneID string) (bool, string) {
+	if _, err := newCFClient(acc).Post(fmt.Sprintf("/zones/%s/email/routing/dns", zoneID), nil, nil); err != nil {
+		return false, err.Error()
+	}
+	return true, "Success"
 }
 
 func setCatchAllRule(acc *models.Account, zoneID string, workerName string) (bool, string) {
@@ -116,25 +130,9 @@ func setCatchAllRule(acc *models.Account, zoneID string, workerName string) (boo
 		},
 		"enabled": true,
 	}
-	body, _ := json.Marshal(payload)
-
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/email/routing/rules/catch_all", zoneID)
-	req, _ := http.NewRequest("PUT", url, bytes.NewBuffer(body))
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-	req.Header.Add("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, "Request failed"
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusOK {
-		return true, "Success"
+	if _, err := newCFClient(acc).Put(fmt.Sprintf("/zones/%s/email/routing/rules/catch_all", zoneID), payload, nil); err != nil {
+		return false, err.Error()
 	}
-
-	respBody, _ := ioutil.ReadAll(resp.Body)
-	return false, fmt.Sprintf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	return true, "Success"
 }
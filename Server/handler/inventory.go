@@ -0,0 +1,381 @@
+package handler
+
+import (
+	"cloudflare-tools/server/config"
+	"cloudflare-tools/server/inventory"
+	"cloudflare-tools/server/models"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultInventoryInterval = 30 * time.Minute
+
+type InventoryZone struct {
+	inventory.Zone
+	Account string `json:"account"`
+}
+
+type InventoryAccount struct {
+	inventory.Account
+	Name string `json:"name"`
+}
+
+type InventoryResponse struct {
+	Accounts []InventoryAccount `json:"accounts"`
+	// Total counts the matching zones before limit
+	Total int             `json:"total"`
+	Zones []InventoryZone `json:"zones"`
+}
+
+type RefreshInventoryRequest struct {
+	// AccountID refreshes a single account; empty refreshes all of them
+	AccountID string `json:"accountId"`
+}
+
+// inventoryRefreshMu keeps the background and manual refreshes from
+// listing the same accounts at the same time.
+var inventoryRefreshMu sync.Mutex
+
+// StartInventoryRefresher lists the zones of every stored account right away
+// and then every inventory.interval seconds. A negative interval disables
+// the background refresh; zones added or deleted here are still recorded.
+func StartInventoryRefresher() {
+	interval := defaultInventoryInterval
+	if n := config.GlobalConfig.Inventory.Interval; n < 0 {
+		return
+	} else if n > 0 {
+		interval = time.Duration(n) * time.Second
+	}
+
+	go func() {
+		for {
+			refreshInventory(append([]models.Account(nil), models.Accounts...), true)
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// SearchInventory answers GET /api/inventory. Supported filters: q (a
+// substring, or a glob such as *.example.com), accountId, status and limit
+// (default 500, 0 for all).
+func SearchInventory(c *gin.Context) {
+	q := inventory.Query{
+		Pattern:   c.Query("q"),
+		AccountID: c.Query("accountId"),
+		Status:    c.Query("status"),
+		Limit:     500,
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		q.Limit = n
+	}
+
+	zones, total, err := inventory.Search(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	accounts, err := inventoryAccounts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := InventoryResponse{Accounts: accounts, Total: total, Zones: make([]InventoryZone, len(zones))}
+	for i, z := range zones {
+		resp.Zones[i] = InventoryZone{Zone: z, Account: accountName(z.AccountID)}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RefreshInventory lists the zones of one or all accounts now and answers
+// with the refresh state of every account.
+func RefreshInventory(c *gin.Context) {
+	var req RefreshInventoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	accounts := append([]models.Account(nil), models.Accounts...)
+	if req.AccountID != "" {
+		acc := findAccount(req.AccountID)
+		if acc == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+			return
+		}
+		accounts = []models.Account{*acc}
+	}
+	refreshInventory(accounts, req.AccountID == "")
+
+	list, err := inventoryAccounts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// refreshInventory replaces the zones of each account with a fresh listing.
+// With prune, accounts that are no longer stored are dropped.
+func refreshInventory(accounts []models.Account, prune bool) {
+	inventoryRefreshMu.Lock()
+	defer inventoryRefreshMu.Unlock()
+
+	forEachBounded(len(accounts), func(idx int) {
+		acc := &accounts[idx]
+		zones, err := fetchAllZones(acc)
+		if err != nil {
+			log.Printf("Warning: Failed to list zones of account %s: %v", acc.Name, err)
+			if err := inventory.Failed(acc.ID, err.Error()); err != nil {
+				log.Printf("Warning: Failed to save inventory: %v", err)
+			}
+			return
+		}
+		list := make([]inventory.Zone, len(zones))
+		for i, z := range zones {
+			list[i] = inventory.Zone{
+				Domain:      z.Domain,
+				ZoneID:      z.ZoneID,
+				Status:      z.Status,
+				Type:        z.Type,
+				Plan:        z.Plan,
+				NameServers: z.NameServers,
+				CreatedOn:   z.CreatedOn,
+			}
+		}
+		if err := inventory.Replace(acc.ID, list); err != nil {
+			log.Printf("Warning: Failed to save inventory: %v", err)
+		}
+	})
+
+	if prune {
+		ids := make([]string, len(accounts))
+		for i, acc := range accounts {
+			ids[i] = acc.ID
+		}
+		if err := inventory.Prune(ids); err != nil {
+			log.Printf("Warning: Failed to save inventory: %v", err)
+		}
+	}
+}
+
+// rememberInventoryZone records a zone created through this tool without
+// waiting for the next refresh.
+func rememberInventoryZone(acc *models.Account, zone cfZone) {
+	err := inventory.Put(inventory.Zone{
+		Domain:      zone.Name,
+		ZoneID:      zone.ID,
+		AccountID:   acc.ID,
+		Status:      zone.Status,
+		Type:        zone.Type,
+		Plan:        zone.Plan.Name,
+		NameServers: zone.NameServers,
+		CreatedOn:   zone.CreatedOn,
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to save inventory: %v", err)
+	}
+}
+
+func inventoryAccounts() ([]InventoryAccount, error) {
+	states, err := inventory.Accounts()
+	if err != nil {
+		return nil, err
+	}
+	byID := map[string]inventory.Account{}
+	for _, s := range states {
+		byID[s.AccountID] = s
+	}
+
+	list := make([]InventoryAccount, 0, len(models.Accounts))
+	for _, acc := range models.Accounts {
+		s, ok := byID[acc.ID]
+		if !ok {
+			s = inventory.Account{AccountID: acc.ID}
+		}
+		list = append(list, InventoryAccount{Account: s, Name: acc.Name})
+	}
+	return list, nil
+}
+
+func accountName(id string) string {
+	if acc := findAccount(id); acc != nil {
+		return acc.Name
+	}
+	return ""
+}
+
+// batchRoute holds the account each item of a batch runs against: acc for
+// every item, or owners[idx] when the batch is routed by domain. An owner
+// is nil for items without a domain.
+type batchRoute struct {
+	acc    *models.Account
+	owners []*models.Account
+}
+
+func (r *batchRoute) account(idx int) *models.Account {
+	if r.acc != nil {
+		return r.acc
+	}
+	return r.owners[idx]
+}
+
+// accountIDs lists the accounts of a routed batch for the audit log.
+func (r *batchRoute) accountIDs() []string {
+	seen := map[string]bool{}
+	var ids []string
+	for _, acc := range r.owners {
+		if acc != nil && !seen[acc.ID] {
+			seen[acc.ID] = true
+			ids = append(ids, acc.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+var errAmbiguousZone = errors.New("Zone is in several accounts")
+
+// routeBatch resolves the account of a batch over domains, one per item.
+// With accountID every domain uses that account; without one each domain
+// goes to the stored account that holds it. Repeated domains are looked up
+// once, and empty ones, items that fail before touching Cloudflare, get no
+// account. When that fails it answers the request and returns nil.
+func routeBatch(c *gin.Context, accountID string, domains []string) *batchRoute {
+	if accountID != "" || len(domains) == 0 {
+		acc := findAccount(accountID)
+		if acc == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+			return nil
+		}
+		return &batchRoute{acc: acc}
+	}
+
+	var distinct []string
+	index := map[string]int{}
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(d), "."))
+		if _, ok := index[d]; !ok && d != "" {
+			index[d] = len(distinct)
+			distinct = append(distinct, d)
+		}
+	}
+	owners := make([]*models.Account, len(distinct))
+	errs := make([]error, len(distinct))
+	forEachBounded(len(distinct), func(idx int) {
+		owners[idx], errs[idx] = zoneOwner(distinct[idx])
+	})
+
+	var unknown, ambiguous []string
+	for i, err := range errs {
+		switch {
+		case err == nil:
+		case errors.Is(err, errAmbiguousZone):
+			ambiguous = append(ambiguous, distinct[i])
+		case errors.Is(err, errZoneNotFound):
+			unknown = append(unknown, distinct[i])
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil
+		}
+	}
+	if len(unknown) > 0 || len(ambiguous) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Some domains can't be matched to an account, pass accountId",
+			"unknown":   unknown,
+			"ambiguous": ambiguous,
+		})
+		return nil
+	}
+
+	route := &batchRoute{owners: make([]*models.Account, len(domains))}
+	for i, d := range domains {
+		if j, ok := index[strings.ToLower(strings.TrimSuffix(strings.TrimSpace(d), "."))]; ok {
+			route.owners[i] = owners[j]
+		}
+	}
+	return route
+}
+
+// routeDomain resolves the account of a single zone, such as the source of a
+// copy, the way routeBatch does. When that fails it answers the request and
+// returns nil.
+func routeDomain(c *gin.Context, accountID string, domain string) *models.Account {
+	if strings.TrimSpace(domain) == "" {
+		if acc := findAccount(accountID); acc != nil {
+			return acc
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return nil
+	}
+	route := routeBatch(c, accountID, []string{domain})
+	if route == nil {
+		return nil
+	}
+	return route.account(0)
+}
+
+// zoneOwner finds the stored account that holds domain. A domain in several
+// accounts goes to the one where it is active. Domains missing from the
+// inventory are looked up in every account, in case they were added since
+// the last refresh.
+func zoneOwner(domain string) (*models.Account, error) {
+	zones, err := inventory.Lookup(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var owners []*models.Account
+	var active []*models.Account
+	for _, z := range zones {
+		if acc := findAccount(z.AccountID); acc != nil {
+			owners = append(owners, acc)
+			if z.Status == "active" {
+				active = append(active, acc)
+			}
+		}
+	}
+	switch {
+	case len(owners) == 1:
+		return owners[0], nil
+	case len(active) == 1:
+		return active[0], nil
+	case len(owners) > 1:
+		return nil, errAmbiguousZone
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	for i := range models.Accounts {
+		acc := models.Accounts[i]
+		zoneID, err := getZoneID(&acc, name)
+		if err != nil {
+			continue
+		}
+		if owners = append(owners, &acc); len(owners) == 1 {
+			if err := inventory.Put(inventory.Zone{Domain: name, ZoneID: zoneID, AccountID: acc.ID}); err != nil {
+				log.Printf("Warning: Failed to save inventory: %v", err)
+			}
+		}
+	}
+	switch len(owners) {
+	case 0:
+		return nil, errZoneNotFound
+	case 1:
+		return owners[0], nil
+	}
+	return nil, errAmbiguousZone
+}
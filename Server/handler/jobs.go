@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"cloudflare-tools/server/jobs"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ListJobs(c *gin.Context) {
+	list := jobs.List()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	c.JSON(http.StatusOK, list)
+}
+
+func GetJob(c *gin.Context) {
+	job := jobs.Get(c.Param("id"))
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job.Snapshot())
+}
+
+// JobEvents streams per-item results over SSE. Results that landed before the
+// client connected are replayed first, then live events follow until "done".
+func JobEvents(c *gin.Context) {
+	job := jobs.Get(c.Param("id"))
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	snap, events, cancel := job.Subscribe()
+	defer cancel()
+
+	done := 0
+	for idx, result := range snap.Results {
+		if result == nil {
+			continue
+		}
+		done++
+		c.SSEvent("result", jobs.Event{Type: "result", Index: idx, Result: result, Done: done, Total: snap.Total})
+	}
+	if snap.Status == jobs.StatusFinished {
+		c.SSEvent("done", jobs.Event{Type: "done", Index: -1, Done: snap.Done, Total: snap.Total})
+		return
+	}
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(ev.Type, ev)
+			return ev.Type != "done"
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,315 @@
+package handler
+
+import (
+	"cloudflare-tools/server/config"
+	"cloudflare-tools/server/models"
+	"cloudflare-tools/server/onboarding"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultOnboardingInterval = 10 * time.Minute
+	// Cloudflare rate limits activation checks, so a zone is only nudged
+	// once an hour
+	activationCheckInterval = time.Hour
+)
+
+type OnboardingZone struct {
+	onboarding.Zone
+	WaitingSeconds int64 `json:"waitingSeconds"`
+}
+
+type OnboardingDashboard struct {
+	Pending   int              `json:"pending"`
+	Delegated int              `json:"delegated"`
+	Active    int              `json:"active"`
+	Zones     []OnboardingZone `json:"zones"`
+}
+
+type OnboardingRequest struct {
+	AccountID string   `json:"accountId"`
+	Domains   []string `json:"domains"`
+}
+
+type OnboardingTrackResult struct {
+	Domain  string `json:"domain"`
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// StartOnboardingChecker checks the delegation of every zone that isn't
+// active yet in the background. A negative onboarding.interval disables it.
+func StartOnboardingChecker() {
+	interval := defaultOnboardingInterval
+	if n := config.GlobalConfig.Onboarding.Interval; n < 0 {
+		return
+	} else if n > 0 {
+		interval = time.Duration(n) * time.Second
+	}
+
+	go func() {
+		for {
+			time.Sleep(interval)
+			zones, err := onboarding.List()
+			if err != nil {
+				log.Printf("Warning: Failed to load onboarding state: %v", err)
+				continue
+			}
+			var waiting []onboarding.Zone
+			for _, z := range zones {
+				if z.Status != onboarding.StatusActive {
+					waiting = append(waiting, z)
+				}
+			}
+			checkOnboardingZones(waiting)
+		}
+	}()
+}
+
+// ListOnboarding shows the tracked zones with their status counts, optionally
+// filtered by status and account.
+func ListOnboarding(c *gin.Context) {
+	zones, err := onboarding.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := c.Query("status")
+	accountID := c.Query("accountId")
+	now := time.Now()
+	dashboard := OnboardingDashboard{Zones: []OnboardingZone{}}
+	for _, z := range zones {
+		if accountID != "" && z.AccountID != accountID {
+			continue
+		}
+		switch z.Status {
+		case onboarding.StatusPending:
+			dashboard.Pending++
+		case onboarding.StatusDelegated:
+			dashboard.Delegated++
+		case onboarding.StatusActive:
+			dashboard.Active++
+		}
+		if status != "" && z.Status != status {
+			continue
+		}
+		dashboard.Zones = append(dashboard.Zones, OnboardingZone{Zone: z, WaitingSeconds: int64(z.Waiting(now).Seconds())})
+	}
+	c.JSON(http.StatusOK, dashboard)
+}
+
+// TrackOnboarding starts tracking zones that were added before, or outside
+// of, this tool.
+func TrackOnboarding(c *gin.Context) {
+	var req OnboardingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !normalizeZones(c, &req.Domains) {
+		return
+	}
+
+	acc := findAccount(req.AccountID)
+	if acc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	out := make([]OnboardingTrackResult, len(req.Domains))
+	forEachBounded(len(req.Domains), func(idx int) {
+		dom := strings.ToLower(strings.TrimSpace(req.Domains[idx]))
+		out[idx] = OnboardingTrackResult{Domain: dom}
+
+		zoneID, err := getZoneID(acc, dom)
+		if err != nil {
+			out[idx].Message = err.Error()
+			return
+		}
+		var zone cfZone
+		if _, err := newCFClient(acc).Get(fmt.Sprintf("/zones/%s", zoneID), nil, &zone); err != nil {
+			out[idx].Message = err.Error()
+			return
+		}
+		if err := trackZone(acc, zone); err != nil {
+			out[idx].Message = err.Error()
+			return
+		}
+		out[idx].Success = true
+		out[idx].Message = "Tracking"
+	})
+	c.JSON(http.StatusOK, out)
+}
+
+// CheckOnboarding runs the delegation check right away, for the given
+// domains of an account or for every zone that isn't active yet.
+func CheckOnboarding(c *gin.Context) {
+	var req OnboardingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !normalizeZones(c, &req.Domains) {
+		return
+	}
+
+	zones, err := onboarding.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	wanted := map[string]bool{}
+	for _, d := range req.Domains {
+		wanted[strings.ToLower(strings.TrimSpace(d))] = true
+	}
+	var selected []onboarding.Zone
+	for _, z := range zones {
+		if req.AccountID != "" && z.AccountID != req.AccountID {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[z.Domain] {
+			continue
+		}
+		if len(wanted) == 0 && z.Status == onboarding.StatusActive {
+			continue
+		}
+		selected = append(selected, z)
+	}
+
+	checked := checkOnboardingZones(selected)
+	now := time.Now()
+	result := make([]OnboardingZone, len(checked))
+	for i, z := range checked {
+		result[i] = OnboardingZone{Zone: z, WaitingSeconds: int64(z.Waiting(now).Seconds())}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func UntrackOnboarding(c *gin.Context) {
+	if err := onboarding.Remove(c.Param("domain"), c.Query("accountId")); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, onboarding.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Success"})
+}
+
+// trackZone records a zone that has just been added to Cloudflare.
+func trackZone(acc *models.Account, zone cfZone) error {
+	z := onboarding.Zone{
+		Domain:              zone.Name,
+		ZoneID:              zone.ID,
+		AccountID:           acc.ID,
+		CloudflareStatus:    zone.Status,
+		AssignedNameServers: zone.NameServers,
+	}
+	if zone.Status == "active" {
+		now := time.Now()
+		z.Status = onboarding.StatusActive
+		z.ActivatedAt = &now
+	}
+	return onboarding.Track(z)
+}
+
+func checkOnboardingZones(zones []onboarding.Zone) []onboarding.Zone {
+	checked := make([]onboarding.Zone, len(zones))
+	forEachBounded(len(zones), func(idx int) {
+		z := checkOnboardingZone(zones[idx])
+		if updated, err := onboarding.Update(z.Domain, z.AccountID, func(stored *onboarding.Zone) { *stored = z }); err == nil {
+			z = *updated
+		}
+		checked[idx] = z
+	})
+	return checked
+}
+
+// checkOnboardingZone compares the delegation found in DNS with the
+// nameservers Cloudflare assigned and asks Cloudflare to re-check zones whose
+// delegation is in place but that are still pending.
+func checkOnboardingZone(z onboarding.Zone) onboarding.Zone {
+	now := time.Now()
+	z.CheckedAt = &now
+	z.LastError = ""
+
+	acc := findAccount(z.AccountID)
+	if acc == nil {
+		z.LastError = "Account not found"
+		return z
+	}
+
+	var zone cfZone
+	if _, err := newCFClient(acc).Get(fmt.Sprintf("/zones/%s", z.ZoneID), nil, &zone); err != nil {
+		z.LastError = err.Error()
+		return z
+	}
+	z.CloudflareStatus = zone.Status
+	if len(zone.NameServers) > 0 {
+		z.AssignedNameServers = zone.NameServers
+	}
+
+	current, err := newDNSClient().Delegation(publicResolvers()[0], z.Domain)
+	if err != nil {
+		z.LastError = err.Error()
+	} else {
+		z.CurrentNameServers = current
+	}
+
+	switch {
+	case zone.Status == "active":
+		z.Status = onboarding.StatusActive
+		if z.ActivatedAt == nil {
+			z.ActivatedAt = &now
+		}
+		return z
+	case err != nil:
+		return z
+	case sameNameServers(current, z.AssignedNameServers):
+		z.Status = onboarding.StatusDelegated
+		if z.DelegatedAt == nil {
+			z.DelegatedAt = &now
+		}
+	default:
+		z.Status = onboarding.StatusPending
+		z.DelegatedAt = nil
+		return z
+	}
+
+	if z.ActivationCheckAt == nil || now.Sub(*z.ActivationCheckAt) >= activationCheckInterval {
+		if _, err := newCFClient(acc).Put(fmt.Sprintf("/zones/%s/activation_check", z.ZoneID), nil, nil); err != nil {
+			z.LastError = "Activation check: " + err.Error()
+		} else {
+			z.ActivationCheckAt = &now
+		}
+	}
+	return z
+}
+
+func sameNameServers(current []string, assigned []string) bool {
+	if len(current) == 0 || len(current) != len(assigned) {
+		return false
+	}
+	want := map[string]bool{}
+	for _, ns := range assigned {
+		want[strings.ToLower(strings.TrimSuffix(ns, "."))] = true
+	}
+	for _, ns := range current {
+		if !want[strings.ToLower(strings.TrimSuffix(ns, "."))] {
+			return false
+		}
+	}
+	return true
+}
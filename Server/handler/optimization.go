@@ -1,13 +1,8 @@
 package handler
 
 import (
-	"bytes"
 	"cloudflare-tools/server/models"
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"net/http"
-	"sync"
 
 	"github.com/gin-gonic/gin"
 )
@@ -27,12 +22,15 @@ type BatchOptimizationRequest struct {
 	RocketLoader    string   `json:"rocketLoader"`
 	Mirage          string   `json:"mirage"`
 	Polish          string   `json:"polish"`
+	DryRun          bool     `json:"dryRun"`
 }
 
 type OptimizationResult struct {
 	Domain  string `json:"domain"`
 	Success bool   `json:"success"`
 	Message string `json:"message"`
+	Retries int    `json:"retries,omitempty"`
+	Plan    []string `json:"plan,omitempty"`
 }
 
 func BatchOptimization(c *gin.Context) {
@@ -42,215 +40,109 @@ func BatchOptimization(c *gin.Context) {
 		return
 	}
 
-	var acc *models.Account
-	for _, a := range models.Accounts {
-		if a.ID == req.AccountID {
-			acc = &a
-			break
-		}
+	if !normalizeZones(c, &req.Domains) {
+		return
 	}
 
-	if acc == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	route := routeBatch(c, req.AccountID, req.Domains)
+	if route == nil {
 		return
 	}
 
-	results := make([]OptimizationResult, len(req.Domains))
-	var wg sync.WaitGroup
-
-	for i, domain := range req.Domains {
-		wg.Add(1)
-		go func(idx int, dom string) {
-			defer wg.Done()
-			success, msg := applyOptimization(acc, dom, &req)
-			results[idx] = OptimizationResult{
-				Domain:  dom,
-				Success: success,
-				Message: msg,
-			}
-		}(i, domain)
-	}
+	runRoutedBatch(c, "optimization.batch-settings", route, &req, len(req.Domains), func(idx int, acc *models.Account) OptimizationResult {
+		dom := req.Domains[idx]
+		var (
+			success bool
+			msg     string
+			plan    []string
+		)
+		if req.DryRun {
+			success, msg, plan = planZoneSettings(acc, dom, req.settingChanges())
+		} else {
+			success, msg = applyOptimization(acc, dom, &req)
+		}
+		return OptimizationResult{
+			Domain:  dom,
+			Success: success,
+			Message: msg,
+			Retries: retriesFor(acc),
+			Plan:    plan,
+		}
+	})
+}
 
-	wg.Wait()
-	c.JSON(http.StatusOK, results)
+func (s *BatchOptimizationRequest) settingChanges() []settingChange {
+	changes := []settingChange{}
+	if s.Minify != "" {
+		// an unknown minify mode stays nil and counts as a failed operation
+		var value interface{}
+		if config := minifyConfig(s.Minify); config != nil {
+			value = config
+		}
+		changes = append(changes, settingChange{Setting: "minify", Value: value})
+	}
+	return append(changes, collectSettings(
+		"brotli", s.Brotli,
+		"early_hints", s.EarlyHints,
+		"http2", s.HTTP2,
+		"http3", s.HTTP3,
+		"0rtt", s.ZeroRTT,
+		"ipv6", s.IPV6,
+		"websockets", s.WebSockets,
+		"pseudo_ipv4", s.PseudoIPV4,
+		"rocket_loader", s.RocketLoader,
+		"mirage", s.Mirage,
+		"polish", s.Polish,
+	)...)
 }
 
 func applyOptimization(acc *models.Account, domain string, settings *BatchOptimizationRequest) (bool, string) {
-	reqGet, _ := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones?name=%s", domain), nil)
-	reqGet.Header.Add("X-Auth-Email", acc.Email)
-	reqGet.Header.Add("X-Auth-Key", acc.Key)
-
-	client := &http.Client{}
-	resp, err := client.Do(reqGet)
+	zoneID, err := getZoneID(acc, domain)
 	if err != nil {
-		return false, "Request failed"
-	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Result []struct {
-			ID string `json:"id"`
-		} `json:"result"`
-	}
-
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
-
-	if len(result.Result) == 0 {
-		return false, "Zone not found"
-	}
-
-	zoneID := result.Result[0].ID
-	successCount := 0
-	totalOperations := 0
-
-	if settings.Minify != "" {
-		totalOperations++
-		if updateMinifySetting(acc, zoneID, settings.Minify) {
-			successCount++
-		}
-	}
-
-	if settings.Brotli != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "brotli", settings.Brotli) {
-			successCount++
-		}
-	}
-
-	if settings.EarlyHints != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "early_hints", settings.EarlyHints) {
-			successCount++
-		}
-	}
-
-	if settings.HTTP2 != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "http2", settings.HTTP2) {
-			successCount++
-		}
-	}
-
-	if settings.HTTP3 != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "http3", settings.HTTP3) {
-			successCount++
-		}
-	}
-
-	if settings.ZeroRTT != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "0rtt", settings.ZeroRTT) {
-			successCount++
-		}
-	}
-
-	if settings.IPV6 != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "ipv6", settings.IPV6) {
-			successCount++
-		}
-	}
-
-	if settings.WebSockets != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "websockets", settings.WebSockets) {
-			successCount++
-		}
-	}
-
-	if settings.PseudoIPV4 != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "pseudo_ipv4", settings.PseudoIPV4) {
-			successCount++
-		}
-	}
-
-	if settings.RocketLoader != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "rocket_loader", settings.RocketLoader) {
-			successCount++
-		}
+		return false, err.Error()
 	}
 
-	if settings.Mirage != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "mirage", settings.Mirage) {
-			successCount++
-		}
-	}
-
-	if settings.Polish != "" {
-		totalOperations++
-		if updateZoneSetting(acc, zoneID, "polish", settings.Polish) {
-			successCount++
-		}
-	}
-
-	if successCount == totalOperations && totalOperations > 0 {
-		return true, fmt.Sprintf("Success (%d/%d)", successCount, totalOperations)
-	} else if successCount > 0 {
-		return true, fmt.Sprintf("Partial success (%d/%d)", successCount, totalOperations)
-	}
-
-	return false, "No operations performed"
+	successCount, totalOperations := countSettingUpdates(acc, zoneID, settings.settingChanges())
+	return summarizeOperations(successCount, totalOperations, "No operations performed")
 }
 
-func updateMinifySetting(acc *models.Account, zoneID string, minifyValue string) bool {
-	var minifyConfig map[string]interface{}
+func minifyConfig(minifyValue string) map[string]interface{} {
+	var config map[string]interface{}
 	
 	switch minifyValue {
 	case "all":
-		minifyConfig = map[string]interface{}{
+		config = map[string]interface{}{
 			"css":  "on",
 			"html": "on",
 			"js":   "on",
 		}
 	case "css":
-		minifyConfig = map[string]interface{}{
+		config = map[string]interface{}{
 			"css":  "on",
 			"html": "off",
 			"js":   "off",
 		}
 	case "html":
-		minifyConfig = map[string]interface{}{
+		config = map[string]interface{}{
 			"css":  "off",
 			"html": "on",
 			"js":   "off",
 		}
 	case "js":
-		minifyConfig = map[string]interface{}{
+		config = map[string]interface{}{
 			"css":  "off",
 			"html": "off",
 			"js":   "on",
 		}
 	case "off":
-		minifyConfig = map[string]interface{}{
+		config = map[string]interface{}{
 			"css":  "off",
 			"html": "off",
 			"js":   "off",
 		}
 	default:
-		return false
-	}
-
-	payload := map[string]interface{}{
-		"value": minifyConfig,
-	}
-	body, _ := json.Marshal(payload)
-
-	req, _ := http.NewRequest("PATCH", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/settings/minify", zoneID), bytes.NewBuffer(body))
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-	req.Header.Add("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return false
+		return nil
 	}
-	defer resp.Body.Close()
 
-	return resp.StatusCode == http.StatusOK
+	return config
 }
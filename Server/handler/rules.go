@@ -1,13 +1,9 @@
 package handler
 
 import (
-	"bytes"
 	"cloudflare-tools/server/models"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"sync"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,6 +13,7 @@ type BatchCopyRulesRequest struct {
 	SourceDomain   string   `json:"sourceDomain"`
 	TargetDomains  []string `json:"targetDomains"`
 	RuleTypes      []string `json:"ruleTypes"`
+	DryRun         bool     `json:"dryRun"`
 }
 
 type CopyRulesResult struct {
@@ -24,6 +21,8 @@ type CopyRulesResult struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 	Count   int    `json:"count"`
+	Retries int    `json:"retries,omitempty"`
+	Plan    []string `json:"plan,omitempty"`
 }
 
 func BatchCopyRules(c *gin.Context) {
@@ -33,65 +32,84 @@ func BatchCopyRules(c *gin.Context) {
 		return
 	}
 
-	var acc *models.Account
-	for _, a := range models.Accounts {
-		if a.ID == req.AccountID {
-			acc = &a
-			break
-		}
+	if !normalizeZones(c, &req.TargetDomains) {
+		return
 	}
 
-	if acc == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	srcAcc := routeDomain(c, req.AccountID, req.SourceDomain)
+	if srcAcc == nil {
 		return
 	}
-
-	sourceZoneID, err := getZoneIDByDomain(acc, req.SourceDomain)
+	sourceZoneID, err := getZoneID(srcAcc, req.SourceDomain)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Source domain not found"})
 		return
 	}
 
-	results := make([]CopyRulesResult, len(req.TargetDomains))
-	var wg sync.WaitGroup
-
-	for i, domain := range req.TargetDomains {
-		wg.Add(1)
-		go func(idx int, dom string) {
-			defer wg.Done()
-			success, msg, count := copyRulesToDomain(acc, sourceZoneID, dom, req.RuleTypes)
-			results[idx] = CopyRulesResult{
-				Domain:  dom,
-				Success: success,
-				Message: msg,
-				Count:   count,
-			}
-		}(i, domain)
+	route := routeBatch(c, req.AccountID, req.TargetDomains)
+	if route == nil {
+		return
 	}
 
-	wg.Wait()
-	c.JSON(http.StatusOK, results)
+	// the targets may be in other accounts, so the source rules are read
+	// once with the account that holds the source zone
+	source := readRuleSets(srcAcc, sourceZoneID, req.RuleTypes)
+
+	runRoutedBatch(c, "rules.batch-copy", route, &req, len(req.TargetDomains), func(idx int, acc *models.Account) CopyRulesResult {
+		dom := req.TargetDomains[idx]
+		var (
+			success bool
+			msg     string
+			count   int
+			plan    []string
+		)
+		if req.DryRun {
+			success, msg, count, plan = planCopyRules(acc, source, dom)
+		} else {
+			success, msg, count = copyRulesToDomain(acc, source, dom)
+		}
+		return CopyRulesResult{
+			Domain:  dom,
+			Success: success,
+			Message: msg,
+			Count:   count,
+			Retries: retriesFor(acc),
+			Plan:    plan,
+		}
+	})
+}
+
+// ruleSet holds the rules of one type read from the source zone, or the
+// error reading them failed with.
+type ruleSet struct {
+	ruleType string
+	rules    []map[string]interface{}
+	err      error
 }
 
-func copyRulesToDomain(acc *models.Account, sourceZoneID string, targetDomain string, ruleTypes []string) (bool, string, int) {
-	targetZoneID, err := getZoneIDByDomain(acc, targetDomain)
+// readRuleSets reads the rules of each known type in ruleTypes.
+func readRuleSets(acc *models.Account, zoneID string, ruleTypes []string) []ruleSet {
+	var sets []ruleSet
+	for _, ruleType := range ruleTypes {
+		if _, ok := rulePaths[ruleType]; !ok {
+			continue
+		}
+		rules, err := listZoneRules(acc, zoneID, ruleType)
+		sets = append(sets, ruleSet{ruleType: ruleType, rules: rules, err: err})
+	}
+	return sets
+}
+
+func copyRulesToDomain(acc *models.Account, source []ruleSet, targetDomain string) (bool, string, int) {
+	targetZoneID, err := getZoneID(acc, targetDomain)
 	if err != nil {
 		return false, "Target zone not found", 0
 	}
 
 	totalCopied := 0
-
-	for _, ruleType := range ruleTypes {
-		switch ruleType {
-		case "page_rules":
-			count := copyPageRules(acc, sourceZoneID, targetZoneID, targetDomain)
-			totalCopied += count
-		case "firewall_rules":
-			count := copyFirewallRules(acc, sourceZoneID, targetZoneID)
-			totalCopied += count
-		case "rate_limiting":
-			count := copyRateLimitRules(acc, sourceZoneID, targetZoneID)
-			totalCopied += count
+	for _, set := range source {
+		if set.err == nil {
+			totalCopied += createZoneRules(acc, targetZoneID, set.ruleType, set.rules)
 		}
 	}
 
@@ -102,158 +120,102 @@ func copyRulesToDomain(acc *models.Account, sourceZoneID string, targetDomain st
 	return false, "No rules copied", 0
 }
 
-func getZoneIDByDomain(acc *models.Account, domain string) (string, error) {
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones?name=%s", domain), nil)
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("Request failed")
+func planCopyRules(acc *models.Account, source []ruleSet, targetDomain string) (bool, string, int, []string) {
+	if _, err := getZoneID(acc, targetDomain); err != nil {
+		return false, "Target zone not found", 0, nil
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		Result []struct {
-			ID string `json:"id"`
-		} `json:"result"`
+	var plan []string
+	total := 0
+	for _, set := range source {
+		if set.err != nil {
+			plan = append(plan, fmt.Sprintf("%s: read failed: %s", set.ruleType, set.err.Error()))
+			continue
+		}
+		plan = append(plan, fmt.Sprintf("%s: would copy %d rules", set.ruleType, len(set.rules)))
+		total += len(set.rules)
 	}
-
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
-
-	if len(result.Result) == 0 {
-		return "", fmt.Errorf("Zone not found")
+	if total == 0 {
+		return false, "No rules copied", 0, plan
 	}
-
-	return result.Result[0].ID, nil
+	return true, fmt.Sprintf("Dry run: would copy %d rules", total), total, plan
 }
 
-func copyPageRules(acc *models.Account, sourceZoneID string, targetZoneID string, targetDomain string) int {
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/pagerules", sourceZoneID), nil)
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0
-	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Result []map[string]interface{} `json:"result"`
-	}
+// rulePaths maps the rule types accepted by the batch endpoints to their
+// zone API paths.
+var rulePaths = map[string]string{
+	"page_rules":     "pagerules",
+	"firewall_rules": "firewall/rules",
+	"rate_limiting":  "rate_limits",
+}
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
+// planRuleCounts counts the rules of each type in a zone and describes them as
+// "<type>: would <verb> N rules".
+func planRuleCounts(acc *models.Account, zoneID string, ruleTypes []string, verb string) ([]string, int) {
+	client := newCFClient(acc)
 
-	count := 0
-	for _, rule := range result.Result {
-		delete(rule, "id")
-		delete(rule, "created_on")
-		delete(rule, "modified_on")
-
-		ruleBody, _ := json.Marshal(rule)
-		postReq, _ := http.NewRequest("POST", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/pagerules", targetZoneID), bytes.NewBuffer(ruleBody))
-		postReq.Header.Add("X-Auth-Email", acc.Email)
-		postReq.Header.Add("X-Auth-Key", acc.Key)
-		postReq.Header.Add("Content-Type", "application/json")
-
-		postResp, err := client.Do(postReq)
-		if err == nil && postResp.StatusCode == http.StatusOK {
-			count++
+	var plan []string
+	total := 0
+	for _, ruleType := range ruleTypes {
+		path, ok := rulePaths[ruleType]
+		if !ok {
+			continue
 		}
-		if postResp != nil {
-			postResp.Body.Close()
+		var rules []struct {
+			ID string `json:"id"`
+		}
+		if _, err := client.Get(fmt.Sprintf("/zones/%s/%s", zoneID, path), nil, &rules); err != nil {
+			plan = append(plan, fmt.Sprintf("%s: read failed: %s", ruleType, err.Error()))
+			continue
 		}
+		plan = append(plan, fmt.Sprintf("%s: would %s %d rules", ruleType, verb, len(rules)))
+		total += len(rules)
 	}
-
-	return count
+	return plan, total
 }
 
-func copyFirewallRules(acc *models.Account, sourceZoneID string, targetZoneID string) int {
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/firewall/rules", sourceZoneID), nil)
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0
+// listZoneRules reads the rules of one type as the API returns them.
+func listZoneRules(acc *models.Account, zoneID string, ruleType string) ([]map[string]interface{}, error) {
+	path, ok := rulePaths[ruleType]
+	if !ok {
+		return nil, fmt.Errorf("Unknown rule type %s", ruleType)
 	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Result []map[string]interface{} `json:"result"`
+	var rules []map[string]interface{}
+	if _, err := newCFClient(acc).Get(fmt.Sprintf("/zones/%s/%s", zoneID, path), nil, &rules); err != nil {
+		return nil, err
 	}
+	return rules, nil
+}
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
+// createZoneRules creates rules read by listZoneRules in another zone, which
+// may belong to another account, and returns how many were created.
+func createZoneRules(acc *models.Account, zoneID string, ruleType string, rules []map[string]interface{}) int {
+	client := newCFClient(acc)
+	path := rulePaths[ruleType]
 
 	count := 0
-	for _, rule := range result.Result {
-		delete(rule, "id")
-		delete(rule, "created_on")
-		delete(rule, "modified_on")
-
-		ruleBody, _ := json.Marshal(rule)
-		postReq, _ := http.NewRequest("POST", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/firewall/rules", targetZoneID), bytes.NewBuffer(ruleBody))
-		postReq.Header.Add("X-Auth-Email", acc.Email)
-		postReq.Header.Add("X-Auth-Key", acc.Key)
-		postReq.Header.Add("Content-Type", "application/json")
-
-		postResp, err := client.Do(postReq)
-		if err == nil && postResp.StatusCode == http.StatusOK {
-			count++
+	for _, rule := range rules {
+		payload := map[string]interface{}{}
+		for k, v := range rule {
+			payload[k] = v
 		}
-		if postResp != nil {
-			postResp.Body.Close()
+		delete(payload, "id")
+		delete(payload, "created_on")
+		delete(payload, "modified_on")
+		// the filter ID belongs to the source zone; without it the
+		// expression creates a new filter in the target zone
+		if filter, ok := payload["filter"].(map[string]interface{}); ok {
+			copied := map[string]interface{}{}
+			for k, v := range filter {
+				copied[k] = v
+			}
+			delete(copied, "id")
+			payload["filter"] = copied
 		}
-	}
 
-	return count
-}
-
-func copyRateLimitRules(acc *models.Account, sourceZoneID string, targetZoneID string) int {
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/rate_limits", sourceZoneID), nil)
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0
-	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Result []map[string]interface{} `json:"result"`
-	}
-
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
-
-	count := 0
-	for _, rule := range result.Result {
-		delete(rule, "id")
-		delete(rule, "created_on")
-		delete(rule, "modified_on")
-
-		ruleBody, _ := json.Marshal(rule)
-		postReq, _ := http.NewRequest("POST", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/rate_limits", targetZoneID), bytes.NewBuffer(ruleBody))
-		postReq.Header.Add("X-Auth-Email", acc.Email)
-		postReq.Header.Add("X-Auth-Key", acc.Key)
-		postReq.Header.Add("Content-Type", "application/json")
-
-		postResp, err := client.Do(postReq)
-		if err == nil && postResp.StatusCode == http.StatusOK {
+		if _, err := client.Post(fmt.Sprintf("/zones/%s/%s", zoneID, path), payload, nil); err == nil {
 			count++
 		}
-		if postResp != nil {
-			postResp.Body.Close()
-		}
 	}
 
 	return count
@@ -263,6 +225,7 @@ type BatchDeleteRulesRequest struct {
 	AccountID string   `json:"accountId"`
 	Domains   []string `json:"domains"`
 	RuleTypes []string `json:"ruleTypes"`
+	DryRun    bool     `json:"dryRun"`
 }
 
 type DeleteRulesResult struct {
@@ -270,6 +233,8 @@ type DeleteRulesResult struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 	Count   int    `json:"count"`
+	Retries int    `json:"retries,omitempty"`
+	Plan    []string `json:"plan,omitempty"`
 }
 
 func BatchDeleteRules(c *gin.Context) {
@@ -279,42 +244,41 @@ func BatchDeleteRules(c *gin.Context) {
 		return
 	}
 
-	var acc *models.Account
-	for _, a := range models.Accounts {
-		if a.ID == req.AccountID {
-			acc = &a
-			break
-		}
-	}
-
-	if acc == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	if !normalizeZones(c, &req.Domains) {
 		return
 	}
 
-	results := make([]DeleteRulesResult, len(req.Domains))
-	var wg sync.WaitGroup
-
-	for i, domain := range req.Domains {
-		wg.Add(1)
-		go func(idx int, dom string) {
-			defer wg.Done()
-			success, msg, count := deleteRulesFromDomain(acc, dom, req.RuleTypes)
-			results[idx] = DeleteRulesResult{
-				Domain:  dom,
-				Success: success,
-				Message: msg,
-				Count:   count,
-			}
-		}(i, domain)
+	route := routeBatch(c, req.AccountID, req.Domains)
+	if route == nil {
+		return
 	}
 
-	wg.Wait()
-	c.JSON(http.StatusOK, results)
+	runRoutedBatch(c, "rules.batch-delete", route, &req, len(req.Domains), func(idx int, acc *models.Account) DeleteRulesResult {
+		dom := req.Domains[idx]
+		var (
+			success bool
+			msg     string
+			count   int
+			plan    []string
+		)
+		if req.DryRun {
+			success, msg, count, plan = planDeleteRules(acc, dom, req.RuleTypes)
+		} else {
+			success, msg, count = deleteRulesFromDomain(acc, dom, req.RuleTypes)
+		}
+		return DeleteRulesResult{
+			Domain:  dom,
+			Success: success,
+			Message: msg,
+			Count:   count,
+			Retries: retriesFor(acc),
+			Plan:    plan,
+		}
+	})
 }
 
 func deleteRulesFromDomain(acc *models.Account, domain string, ruleTypes []string) (bool, string, int) {
-	zoneID, err := getZoneIDByDomain(acc, domain)
+	zoneID, err := getZoneID(acc, domain)
 	if err != nil {
 		return false, "Zone not found", 0
 	}
@@ -342,118 +306,74 @@ func deleteRulesFromDomain(acc *models.Account, domain string, ruleTypes []strin
 	return false, "No rules found", 0
 }
 
-func deletePageRules(acc *models.Account, zoneID string) int {
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/pagerules", zoneID), nil)
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func planDeleteRules(acc *models.Account, domain string, ruleTypes []string) (bool, string, int, []string) {
+	zoneID, err := getZoneID(acc, domain)
 	if err != nil {
-		return 0
+		return false, "Zone not found", 0, nil
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		Result []struct {
-			ID string `json:"id"`
-		} `json:"result"`
+	plan, total := planRuleCounts(acc, zoneID, ruleTypes, "delete")
+	if total == 0 {
+		return false, "No rules found", 0, plan
 	}
+	return true, fmt.Sprintf("Dry run: would delete %d rules", total), total, plan
+}
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
+func deletePageRules(acc *models.Account, zoneID string) int {
+	client := newCFClient(acc)
 
-	count := 0
-	for _, rule := range result.Result {
-		delReq, _ := http.NewRequest("DELETE", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/pagerules/%s", zoneID, rule.ID), nil)
-		delReq.Header.Add("X-Auth-Email", acc.Email)
-		delReq.Header.Add("X-Auth-Key", acc.Key)
+	var rules []struct {
+		ID string `json:"id"`
+	}
+	if _, err := client.Get(fmt.Sprintf("/zones/%s/pagerules", zoneID), nil, &rules); err != nil {
+		return 0
+	}
 
-		delResp, err := client.Do(delReq)
-		if err == nil && delResp.StatusCode == http.StatusOK {
+	count := 0
+	for _, rule := range rules {
+		if _, err := client.Delete(fmt.Sprintf("/zones/%s/pagerules/%s", zoneID, rule.ID), nil); err == nil {
 			count++
 		}
-		if delResp != nil {
-			delResp.Body.Close()
-		}
 	}
 
 	return count
 }
 
 func deleteFirewallRules(acc *models.Account, zoneID string) int {
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/firewall/rules", zoneID), nil)
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
+	client := newCFClient(acc)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0
+	var rules []struct {
+		ID string `json:"id"`
 	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Result []struct {
-			ID string `json:"id"`
-		} `json:"result"`
+	if _, err := client.Get(fmt.Sprintf("/zones/%s/firewall/rules", zoneID), nil, &rules); err != nil {
+		return 0
 	}
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
-
 	count := 0
-	for _, rule := range result.Result {
-		delReq, _ := http.NewRequest("DELETE", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/firewall/rules/%s", zoneID, rule.ID), nil)
-		delReq.Header.Add("X-Auth-Email", acc.Email)
-		delReq.Header.Add("X-Auth-Key", acc.Key)
-
-		delResp, err := client.Do(delReq)
-		if err == nil && delResp.StatusCode == http.StatusOK {
+	for _, rule := range rules {
+		if _, err := client.Delete(fmt.Sprintf("/zones/%s/firewall/rules/%s", zoneID, rule.ID), nil); err == nil {
 			count++
 		}
-		if delResp != nil {
-			delResp.Body.Close()
-		}
 	}
 
 	return count
 }
 
 func deleteRateLimitRules(acc *models.Account, zoneID string) int {
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/rate_limits", zoneID), nil)
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
+	client := newCFClient(acc)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0
+	var rules []struct {
+		ID string `json:"id"`
 	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Result []struct {
-			ID string `json:"id"`
-		} `json:"result"`
+	if _, err := client.Get(fmt.Sprintf("/zones/%s/rate_limits", zoneID), nil, &rules); err != nil {
+		return 0
 	}
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
-
 	count := 0
-	for _, rule := range result.Result {
-		delReq, _ := http.NewRequest("DELETE", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/rate_limits/%s", zoneID, rule.ID), nil)
-		delReq.Header.Add("X-Auth-Email", acc.Email)
-		delReq.Header.Add("X-Auth-Key", acc.Key)
-
-		delResp, err := client.Do(delReq)
-		if err == nil && delResp.StatusCode == http.StatusOK {
+	for _, rule := range rules {
+		if _, err := client.Delete(fmt.Sprintf("/zones/%s/rate_limits/%s", zoneID, rule.ID), nil); err == nil {
 			count++
 		}
-		if delResp != nil {
-			delResp.Body.Close()
-		}
 	}
 
 	return count
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"cloudflare-tools/server/models"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+type settingChange struct {
+	Setting string
+	Value   interface{}
+}
+
+// collectSettings turns setting/value pairs into changes, skipping the
+// values the operator left empty.
+func collectSettings(pairs ...string) []settingChange {
+	var changes []settingChange
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] != "" {
+			changes = append(changes, settingChange{Setting: pairs[i], Value: pairs[i+1]})
+		}
+	}
+	return changes
+}
+
+func countSettingUpdates(acc *models.Account, zoneID string, changes []settingChange) (int, int) {
+	successCount := 0
+	for _, change := range changes {
+		if updateZoneSetting(acc, zoneID, change.Setting, change.Value) {
+			successCount++
+		}
+	}
+	return successCount, len(changes)
+}
+
+func summarizeOperations(successCount int, totalOperations int, failMessage string) (bool, string) {
+	if successCount == totalOperations && totalOperations > 0 {
+		return true, fmt.Sprintf("Success (%d/%d)", successCount, totalOperations)
+	} else if successCount > 0 {
+		return true, fmt.Sprintf("Partial success (%d/%d)", successCount, totalOperations)
+	}
+
+	return false, failMessage
+}
+
+func updateZoneSetting(acc *models.Account, zoneID string, setting string, value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	payload := map[string]interface{}{
+		"value": value,
+	}
+
+	_, err := newCFClient(acc).Patch(fmt.Sprintf("/zones/%s/settings/%s", zoneID, setting), payload, nil)
+	return err == nil
+}
+
+func getZoneSetting(acc *models.Account, zoneID string, setting string) (interface{}, error) {
+	var result struct {
+		Value interface{} `json:"value"`
+	}
+	if _, err := newCFClient(acc).Get(fmt.Sprintf("/zones/%s/settings/%s", zoneID, setting), nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Value, nil
+}
+
+// planSettingChanges reads the current value of every setting and describes
+// what applying the changes would do, e.g. "ssl: flexible -> full".
+func planSettingChanges(acc *models.Account, zoneID string, changes []settingChange) []string {
+	var plan []string
+	for _, change := range changes {
+		if change.Value == nil {
+			plan = append(plan, fmt.Sprintf("%s: invalid value", change.Setting))
+			continue
+		}
+		current, err := getZoneSetting(acc, zoneID, change.Setting)
+		switch {
+		case err != nil:
+			plan = append(plan, fmt.Sprintf("%s: ? -> %s (read failed: %s)", change.Setting, formatSettingValue(change.Value), err.Error()))
+		case settingValuesEqual(current, change.Value):
+			plan = append(plan, fmt.Sprintf("%s: %s (unchanged)", change.Setting, formatSettingValue(current)))
+		default:
+			plan = append(plan, fmt.Sprintf("%s: %s -> %s", change.Setting, formatSettingValue(current), formatSettingValue(change.Value)))
+		}
+	}
+	return plan
+}
+
+func formatSettingValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// settingValuesEqual compares through JSON so numbers and maps read back
+// from the API match the values built from the request.
+func settingValuesEqual(a, b interface{}) bool {
+	if formatSettingValue(a) == formatSettingValue(b) {
+		return true
+	}
+	var x, y interface{}
+	json.Unmarshal([]byte(formatSettingValue(a)), &x)
+	json.Unmarshal([]byte(formatSettingValue(b)), &y)
+	return x != nil && reflect.DeepEqual(x, y)
+}
+
+// planZoneSettings is the dry-run counterpart of the apply functions built on
+// countSettingUpdates: it resolves the zone and describes each change without
+// writing anything. extra lists non-setting operations to include in the plan.
+func planZoneSettings(acc *models.Account, domain string, changes []settingChange, extra ...string) (bool, string, []string) {
+	zoneID, err := getZoneID(acc, domain)
+	if err != nil {
+		return false, err.Error(), nil
+	}
+
+	plan := append(planSettingChanges(acc, zoneID, changes), extra...)
+	if len(plan) == 0 {
+		return false, "No operations performed", nil
+	}
+	return true, dryRunMessage(len(plan)), plan
+}
+
+func dryRunMessage(operations int) string {
+	return fmt.Sprintf("Dry run: %d operations planned", operations)
+}
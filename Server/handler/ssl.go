@@ -1,13 +1,8 @@
 package handler
 
 import (
-	"bytes"
 	"cloudflare-tools/server/models"
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"net/http"
-	"sync"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,12 +15,15 @@ type BatchSSLSettingsRequest struct {
 	AlwaysUseHTTPS    string   `json:"alwaysUseHttps"`
 	AutomaticHTTPS    string   `json:"automaticHttps"`
 	OpportunisticEnc  string   `json:"opportunisticEnc"`
+	DryRun            bool     `json:"dryRun"`
 }
 
 type SSLSettingResult struct {
 	Domain  string `json:"domain"`
 	Success bool   `json:"success"`
 	Message string `json:"message"`
+	Retries int    `json:"retries,omitempty"`
+	Plan    []string `json:"plan,omitempty"`
 }
 
 func BatchSSLSettings(c *gin.Context) {
@@ -35,129 +33,54 @@ func BatchSSLSettings(c *gin.Context) {
 		return
 	}
 
-	var acc *models.Account
-	for _, a := range models.Accounts {
-		if a.ID == req.AccountID {
-			acc = &a
-			break
-		}
-	}
-
-	if acc == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	if !normalizeZones(c, &req.Domains) {
 		return
 	}
 
-	results := make([]SSLSettingResult, len(req.Domains))
-	var wg sync.WaitGroup
-
-	for i, domain := range req.Domains {
-		wg.Add(1)
-		go func(idx int, dom string) {
-			defer wg.Done()
-			success, msg := applySSLSettings(acc, dom, &req)
-			results[idx] = SSLSettingResult{
-				Domain:  dom,
-				Success: success,
-				Message: msg,
-			}
-		}(i, domain)
-	}
-
-	wg.Wait()
-	c.JSON(http.StatusOK, results)
-}
-
-func applySSLSettings(acc *models.Account, domain string, settings *BatchSSLSettingsRequest) (bool, string) {
-	reqGet, _ := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones?name=%s", domain), nil)
-	reqGet.Header.Add("X-Auth-Email", acc.Email)
-	reqGet.Header.Add("X-Auth-Key", acc.Key)
-
-	client := &http.Client{}
-	resp, err := client.Do(reqGet)
-	if err != nil {
-		return false, "Request failed"
-	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Result []struct {
-			ID string `json:"id"`
-		} `json:"result"`
-	}
-
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
-
-	if len(result.Result) == 0 {
-		return false, "Zone not found"
-	}
-
-	zoneID := result.Result[0].ID
-	successCount := 0
-	totalSettings := 0
-
-	if settings.SSLMode != "" {
-		totalSettings++
-		if updateZoneSetting(acc, zoneID, "ssl", settings.SSLMode) {
-			successCount++
-		}
-	}
-
-	if settings.MinTLSVersion != "" {
-		totalSettings++
-		if updateZoneSetting(acc, zoneID, "min_tls_version", settings.MinTLSVersion) {
-			successCount++
-		}
-	}
-
-	if settings.AlwaysUseHTTPS != "" {
-		totalSettings++
-		if updateZoneSetting(acc, zoneID, "always_use_https", settings.AlwaysUseHTTPS) {
-			successCount++
-		}
+	route := routeBatch(c, req.AccountID, req.Domains)
+	if route == nil {
+		return
 	}
 
-	if settings.AutomaticHTTPS != "" {
-		totalSettings++
-		if updateZoneSetting(acc, zoneID, "automatic_https_rewrites", settings.AutomaticHTTPS) {
-			successCount++
+	runRoutedBatch(c, "ssl.batch-settings", route, &req, len(req.Domains), func(idx int, acc *models.Account) SSLSettingResult {
+		dom := req.Domains[idx]
+		var (
+			success bool
+			msg     string
+			plan    []string
+		)
+		if req.DryRun {
+			success, msg, plan = planZoneSettings(acc, dom, req.settingChanges())
+		} else {
+			success, msg = applySSLSettings(acc, dom, &req)
 		}
-	}
-
-	if settings.OpportunisticEnc != "" {
-		totalSettings++
-		if updateZoneSetting(acc, zoneID, "opportunistic_encryption", settings.OpportunisticEnc) {
-			successCount++
+		return SSLSettingResult{
+			Domain:  dom,
+			Success: success,
+			Message: msg,
+			Retries: retriesFor(acc),
+			Plan:    plan,
 		}
-	}
-
-	if successCount == totalSettings && totalSettings > 0 {
-		return true, fmt.Sprintf("Success (%d/%d)", successCount, totalSettings)
-	} else if successCount > 0 {
-		return true, fmt.Sprintf("Partial success (%d/%d)", successCount, totalSettings)
-	}
-
-	return false, "Failed to update settings"
+	})
 }
 
-func updateZoneSetting(acc *models.Account, zoneID string, setting string, value string) bool {
-	payload := map[string]interface{}{
-		"value": value,
-	}
-	body, _ := json.Marshal(payload)
-
-	req, _ := http.NewRequest("PATCH", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/settings/%s", zoneID, setting), bytes.NewBuffer(body))
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-	req.Header.Add("Content-Type", "application/json")
+func (s *BatchSSLSettingsRequest) settingChanges() []settingChange {
+	return collectSettings(
+		"ssl", s.SSLMode,
+		"min_tls_version", s.MinTLSVersion,
+		"always_use_https", s.AlwaysUseHTTPS,
+		"automatic_https_rewrites", s.AutomaticHTTPS,
+		"opportunistic_encryption", s.OpportunisticEnc,
+	)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func applySSLSettings(acc *models.Account, domain string, settings *BatchSSLSettingsRequest) (bool, string) {
+	zoneID, err := getZoneID(acc, domain)
 	if err != nil {
-		return false
+		return false, err.Error()
 	}
-	defer resp.Body.Close()
 
-	return resp.StatusCode == http.StatusOK
+	successCount, totalOperations := countSettingUpdates(acc, zoneID, settings.settingChanges())
+	return summarizeOperations(successCount, totalOperations, "Failed to update settings")
 }
+
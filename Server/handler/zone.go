@@ -1,13 +1,14 @@
 package handler
 
 import (
-	"bytes"
+	"cloudflare-tools/server/cfapi"
+	"cloudflare-tools/server/inventory"
 	"cloudflare-tools/server/models"
-	"encoding/json"
+	"cloudflare-tools/server/onboarding"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"log"
 	"net/http"
-	"sync"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,13 +16,35 @@ import (
 type BatchAddZoneRequest struct {
 	AccountID string   `json:"accountId"`
 	Domains   []string `json:"domains"`
+	// CFAccountID is the Cloudflare account the zones are created in; it
+	// defaults to the one stored with the credential
+	CFAccountID string `json:"cfAccountId"`
+	// Type is full (default), partial or secondary
+	Type string `json:"type"`
+	// JumpStart scans and imports the existing records of full zones;
+	// it defaults to true
+	JumpStart *bool `json:"jumpStart"`
+	DryRun    bool  `json:"dryRun"`
 }
 
 type ZoneResult struct {
 	Domain      string   `json:"domain"`
 	Success     bool     `json:"success"`
 	Message     string   `json:"message"`
+	ZoneID      string   `json:"zoneId,omitempty"`
+	Status      string   `json:"status,omitempty"`
 	NameServers []string `json:"nameServers,omitempty"`
+	// VerificationKey is the TXT value partial zones are verified with
+	VerificationKey string   `json:"verificationKey,omitempty"`
+	Retries         int      `json:"retries,omitempty"`
+	Plan            []string `json:"plan,omitempty"`
+}
+
+// zoneOptions are the creation options of a new zone.
+type zoneOptions struct {
+	AccountID string
+	Type      string
+	JumpStart bool
 }
 
 func BatchAddZones(c *gin.Context) {
@@ -31,6 +54,10 @@ func BatchAddZones(c *gin.Context) {
 		return
 	}
 
+	if !normalizeZones(c, &req.Domains) {
+		return
+	}
+
 	var acc *models.Account
 	for _, a := range models.Accounts {
 		if a.ID == req.AccountID {
@@ -44,85 +71,107 @@ func BatchAddZones(c *gin.Context) {
 		return
 	}
 
-	results := make([]ZoneResult, len(req.Domains))
-	var wg sync.WaitGroup
-
-	for i, domain := range req.Domains {
-		wg.Add(1)
-		go func(idx int, dom string) {
-			defer wg.Done()
-			success, msg, ns := addZoneToCloudflare(acc, dom)
-			results[idx] = ZoneResult{
-				Domain:      dom,
-				Success:     success,
-				Message:     msg,
-				NameServers: ns,
-			}
-		}(i, domain)
+	opts := zoneOptions{AccountID: req.CFAccountID, Type: req.Type, JumpStart: true}
+	if opts.AccountID == "" {
+		opts.AccountID = acc.CFAccountID
+	}
+	switch opts.Type {
+	case "":
+		opts.Type = "full"
+	case "full", "partial", "secondary":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Type must be full, partial or secondary"})
+		return
+	}
+	if req.JumpStart != nil {
+		opts.JumpStart = *req.JumpStart
 	}
 
-	wg.Wait()
-	c.JSON(http.StatusOK, results)
+	runBatch(c, "zones.batch-add", acc, &req, len(req.Domains), func(idx int, acc *models.Account) ZoneResult {
+		dom := req.Domains[idx]
+		var (
+			success bool
+			msg     string
+			zone    cfZone
+			plan    []string
+		)
+		if req.DryRun {
+			success, msg, plan = planAddZone(acc, dom, opts)
+		} else {
+			success, msg, zone = addZoneToCloudflare(acc, dom, opts)
+		}
+		return ZoneResult{
+			Domain:          dom,
+			Success:         success,
+			Message:         msg,
+			ZoneID:          zone.ID,
+			Status:          zone.Status,
+			NameServers:     zone.NameServers,
+			VerificationKey: zone.VerificationKey,
+			Retries:         retriesFor(acc),
+			Plan:            plan,
+		}
+	})
 }
 
-func addZoneToCloudflare(acc *models.Account, domain string) (bool, string, []string) {
+func addZoneToCloudflare(acc *models.Account, domain string, opts zoneOptions) (bool, string, cfZone) {
 	payload := map[string]interface{}{
-		"name":       domain,
-		"jump_start": true,
+		"name": domain,
+		"type": opts.Type,
 	}
-	body, _ := json.Marshal(payload)
-
-	req, _ := http.NewRequest("POST", "https://api.cloudflare.com/client/v4/zones", bytes.NewBuffer(body))
-	req.Header.Add("X-Auth-Email", acc.Email)
-	req.Header.Add("X-Auth-Key", acc.Key)
-	req.Header.Add("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, "Request failed", nil
+	// jump_start only applies to full zones
+	if opts.Type == "full" {
+		payload["jump_start"] = opts.JumpStart
+	}
+	if opts.AccountID != "" {
+		payload["account"] = map[string]string{"id": opts.AccountID}
 	}
-	defer resp.Body.Close()
 
-	respBody, _ := ioutil.ReadAll(resp.Body)
-	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
-		var successRes struct {
-			Result struct {
-				NameServers []string `json:"name_servers"`
-			} `json:"result"`
+	var zone cfZone
+	if _, err := newCFClient(acc).Post("/zones", payload, &zone); err != nil {
+		return false, err.Error(), zone
+	}
+	rememberZone(acc, zone.Name, zone.ID)
+	rememberInventoryZone(acc, zone)
+	// only full zones are delegated to Cloudflare's nameservers
+	if opts.Type == "full" {
+		if err := trackZone(acc, zone); err != nil {
+			log.Printf("Warning: Failed to track onboarding of %s: %v", zone.Name, err)
 		}
-		json.Unmarshal(respBody, &successRes)
-		return true, "Success", successRes.Result.NameServers
 	}
+	return true, "Success", zone
+}
 
-	var errorRes struct {
-		Errors []struct {
-			Message string `json:"message"`
-		} `json:"errors"`
+func planAddZone(acc *models.Account, domain string, opts zoneOptions) (bool, string, []string) {
+	_, err := getZoneID(acc, domain)
+	if err == nil {
+		return false, "Zone already exists", nil
 	}
-	json.Unmarshal(respBody, &errorRes)
-
-	msg := "Unknown error"
-	if len(errorRes.Errors) > 0 {
-		msg = errorRes.Errors[0].Message
-	} else if resp.StatusCode == 403 {
-		msg = "Auth failed (403)"
-	} else {
-		msg = fmt.Sprintf("HTTP %d", resp.StatusCode)
+	if !errors.Is(err, errZoneNotFound) {
+		return false, err.Error(), nil
 	}
-
-	return false, msg, nil
+	line := fmt.Sprintf("create %s zone %s", opts.Type, domain)
+	if opts.Type == "full" && opts.JumpStart {
+		line += " (jump_start)"
+	}
+	if opts.AccountID != "" {
+		line += " in account " + opts.AccountID
+	}
+	return true, dryRunMessage(1), []string{line}
 }
 
 type BatchDeleteZoneRequest struct {
 	AccountID string   `json:"accountId"`
 	Domains   []string `json:"domains"`
+	DryRun    bool     `json:"dryRun"`
 }
 
 type DeleteZoneResult struct {
-	Domain  string `json:"domain"`
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+	Domain  string   `json:"domain"`
+	Success bool     `json:"success"`
+	Message string   `json:"message"`
+	Retries int      `json:"retries,omitempty"`
+	Plan    []string `json:"plan,omitempty"`
 }
 
 func BatchDeleteZones(c *gin.Context) {
@@ -132,110 +181,99 @@ func BatchDeleteZones(c *gin.Context) {
 		return
 	}
 
-	var acc *models.Account
-	for _, a := range models.Accounts {
-		if a.ID == req.AccountID {
-			acc = &a
-			break
-		}
-	}
-
-	if acc == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	if !normalizeZones(c, &req.Domains) {
 		return
 	}
 
-	results := make([]DeleteZoneResult, len(req.Domains))
-	var wg sync.WaitGroup
-
-	for i, domain := range req.Domains {
-		wg.Add(1)
-		go func(idx int, dom string) {
-			defer wg.Done()
-			success, msg := deleteZoneFromCloudflare(acc, dom)
-			results[idx] = DeleteZoneResult{
-				Domain:  dom,
-				Success: success,
-				Message: msg,
-			}
-		}(i, domain)
+	route := routeBatch(c, req.AccountID, req.Domains)
+	if route == nil {
+		return
 	}
 
-	wg.Wait()
-	c.JSON(http.StatusOK, results)
+	runRoutedBatch(c, "zones.batch-delete", route, &req, len(req.Domains), func(idx int, acc *models.Account) DeleteZoneResult {
+		dom := req.Domains[idx]
+		var (
+			success bool
+			msg     string
+			plan    []string
+		)
+		if req.DryRun {
+			success, msg, plan = planDeleteZone(acc, dom)
+		} else {
+			success, msg = deleteZoneFromCloudflare(acc, dom)
+		}
+		return DeleteZoneResult{
+			Domain:  dom,
+			Success: success,
+			Message: msg,
+			Retries: retriesFor(acc),
+			Plan:    plan,
+		}
+	})
 }
 
 func deleteZoneFromCloudflare(acc *models.Account, domain string) (bool, string) {
-	reqGet, _ := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones?name=%s", domain), nil)
-	reqGet.Header.Add("X-Auth-Email", acc.Email)
-	reqGet.Header.Add("X-Auth-Key", acc.Key)
-
-	client := &http.Client{}
-	resp, err := client.Do(reqGet)
+	zoneID, err := getZoneID(acc, domain)
 	if err != nil {
-		return false, "Request failed"
+		return false, err.Error()
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		Result []struct {
-			ID string `json:"id"`
-		} `json:"result"`
+	if _, err := newCFClient(acc).Delete(fmt.Sprintf("/zones/%s", zoneID), nil); err != nil {
+		return false, err.Error()
 	}
+	forgetZone(acc, domain)
+	onboarding.Remove(domain, acc.ID)
+	inventory.Remove(domain, acc.ID)
+	return true, "Success"
+}
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
-
-	if len(result.Result) == 0 {
-		return false, "Zone not found"
-	}
-
-	zoneID := result.Result[0].ID
-
-	reqDel, _ := http.NewRequest("DELETE", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s", zoneID), nil)
-	reqDel.Header.Add("X-Auth-Email", acc.Email)
-	reqDel.Header.Add("X-Auth-Key", acc.Key)
-
-	respDel, err := client.Do(reqDel)
+func planDeleteZone(acc *models.Account, domain string) (bool, string, []string) {
+	zoneID, err := getZoneID(acc, domain)
 	if err != nil {
-		return false, "Delete request failed"
-	}
-	defer respDel.Body.Close()
-
-	if respDel.StatusCode == http.StatusOK {
-		return true, "Success"
-	}
-
-	var errorRes struct {
-		Errors []struct {
-			Message string `json:"message"`
-		} `json:"errors"`
+		return false, err.Error(), nil
 	}
 
-	respBody, _ := ioutil.ReadAll(respDel.Body)
-	json.Unmarshal(respBody, &errorRes)
-
-	msg := "Unknown error"
-	if len(errorRes.Errors) > 0 {
-		msg = errorRes.Errors[0].Message
-	} else {
-		msg = fmt.Sprintf("HTTP %d", respDel.StatusCode)
+	records, err := listDNSRecords(acc, zoneID, nil)
+	if err != nil {
+		return false, err.Error(), nil
 	}
-
-	return false, msg
+	return true, dryRunMessage(1), []string{fmt.Sprintf("delete zone %s (%s) with %d DNS records", domain, zoneID, len(records))}
 }
 
 type ExportZonesRequest struct {
 	AccountID string `json:"accountId"`
+	// AllAccounts exports the zones of every stored account, with an
+	// account column
+	AllAccounts bool `json:"allAccounts"`
+	// Columns picks the columns of CSV and XLSX downloads, in order; see
+	// exportColumns for the names
+	Columns []string `json:"columns"`
 }
 
 type ExportZoneResult struct {
-	Domain      string   `json:"domain"`
-	Status      string   `json:"status"`
-	NameServers []string `json:"nameServers"`
-	CreatedOn   string   `json:"createdOn"`
+	Account             string   `json:"account,omitempty"`
+	AccountID           string   `json:"accountId,omitempty"`
+	Domain              string   `json:"domain"`
+	ZoneID              string   `json:"zoneId,omitempty"`
+	Status              string   `json:"status"`
+	Type                string   `json:"type,omitempty"`
+	Plan                string   `json:"plan,omitempty"`
+	Paused              bool     `json:"paused"`
+	NameServers         []string `json:"nameServers"`
+	OriginalRegistrar   string   `json:"originalRegistrar,omitempty"`
+	OriginalNameServers []string `json:"originalNameServers,omitempty"`
+	CreatedOn           string   `json:"createdOn"`
+	// the fields below are only read when a requested column needs them
+	DNSRecords     *int     `json:"dnsRecords,omitempty"`
+	ProxiedRecords *int     `json:"proxiedRecords,omitempty"`
+	ProxiedRatio   *float64 `json:"proxiedRatio,omitempty"`
+	SSLMode        string   `json:"sslMode,omitempty"`
+	Error          string   `json:"error,omitempty"`
 }
 
+// ExportZones lists the zones of an account, or of every stored account.
+// With ?format=csv or ?format=xlsx the selected columns are downloaded as a
+// spreadsheet.
 func ExportZones(c *gin.Context) {
 	var req ExportZonesRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -243,75 +281,89 @@ func ExportZones(c *gin.Context) {
 		return
 	}
 
-	var acc *models.Account
-	for _, a := range models.Accounts {
-		if a.ID == req.AccountID {
-			acc = &a
-			break
+	accounts := models.Accounts
+	if !req.AllAccounts {
+		acc := findAccount(req.AccountID)
+		if acc == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+			return
 		}
+		accounts = []models.Account{*acc}
 	}
 
-	if acc == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	format := c.Query("format")
+	switch format {
+	case "", "csv", "xlsx":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be csv or xlsx"})
+		return
+	}
+
+	columns, err := selectExportColumns(req.Columns, req.AllAccounts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	zones, err := fetchAllZones(acc)
+	zones, err := exportAccountZones(accounts, columns)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, zones)
+	if format == "" {
+		c.JSON(http.StatusOK, zones)
+		return
+	}
+	data, contentType, err := writeZoneExport(format, columns, zones)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=zones."+format)
+	c.Data(http.StatusOK, contentType, data)
 }
 
-func fetchAllZones(acc *models.Account) ([]ExportZoneResult, error) {
-	var allZones []ExportZoneResult
-	page := 1
-	perPage := 50
-
-	for {
-		url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones?page=%d&per_page=%d", page, perPage)
-		req, _ := http.NewRequest("GET", url, nil)
-		req.Header.Add("X-Auth-Email", acc.Email)
-		req.Header.Add("X-Auth-Key", acc.Key)
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("Request failed")
-		}
-		defer resp.Body.Close()
-
-		var result struct {
-			Result []struct {
-				Name        string   `json:"name"`
-				Status      string   `json:"status"`
-				NameServers []string `json:"name_servers"`
-				CreatedOn   string   `json:"created_on"`
-			} `json:"result"`
-			ResultInfo struct {
-				Page       int `json:"page"`
-				TotalPages int `json:"total_pages"`
-			} `json:"result_info"`
-		}
+type cfZone struct {
+	ID                  string   `json:"id"`
+	Name                string   `json:"name"`
+	Status              string   `json:"status"`
+	Type                string   `json:"type"`
+	Paused              bool     `json:"paused"`
+	NameServers         []string `json:"name_servers"`
+	OriginalRegistrar   string   `json:"original_registrar"`
+	OriginalNameServers []string `json:"original_name_servers"`
+	VerificationKey     string   `json:"verification_key"`
+	CreatedOn           string   `json:"created_on"`
+	Plan                struct {
+		Name string `json:"name"`
+	} `json:"plan"`
+}
 
-		body, _ := ioutil.ReadAll(resp.Body)
-		json.Unmarshal(body, &result)
+func listZones(acc *models.Account) ([]cfZone, error) {
+	return cfapi.GetAll[cfZone](newCFClient(acc), "/zones", nil, 50)
+}
 
-		for _, zone := range result.Result {
-			allZones = append(allZones, ExportZoneResult{
-				Domain:      zone.Name,
-				Status:      zone.Status,
-				NameServers: zone.NameServers,
-				CreatedOn:   zone.CreatedOn,
-			})
-		}
+func fetchAllZones(acc *models.Account) ([]ExportZoneResult, error) {
+	zones, err := listZones(acc)
+	if err != nil {
+		return nil, err
+	}
 
-		if page >= result.ResultInfo.TotalPages {
-			break
-		}
-		page++
+	var allZones []ExportZoneResult
+	for _, zone := range zones {
+		allZones = append(allZones, ExportZoneResult{
+			Domain:              zone.Name,
+			ZoneID:              zone.ID,
+			Status:              zone.Status,
+			Type:                zone.Type,
+			Plan:                zone.Plan.Name,
+			Paused:              zone.Paused,
+			NameServers:         zone.NameServers,
+			OriginalRegistrar:   zone.OriginalRegistrar,
+			OriginalNameServers: zone.OriginalNameServers,
+			CreatedOn:           zone.CreatedOn,
+		})
 	}
 
 	return allZones, nil
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"cloudflare-tools/server/config"
+	"cloudflare-tools/server/models"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultZoneCacheTTL = 10 * time.Minute
+	// after a failed listing, lookups go straight to /zones?name= for a while
+	// instead of walking every page again
+	zoneListBackoff = 30 * time.Second
+)
+
+// zoneCache maps zone names to IDs for one account. It is filled by a single
+// paginated listing so a batch costs one walk of /zones instead of one
+// lookup per domain.
+type zoneCache struct {
+	mu       sync.Mutex
+	ids      map[string]string
+	loadedAt time.Time
+	failedAt time.Time
+	// loading is closed when the listing in flight finishes; concurrent
+	// lookups wait for it instead of starting their own
+	loading chan struct{}
+}
+
+var (
+	zoneCaches   = make(map[string]*zoneCache)
+	zoneCachesMu sync.Mutex
+)
+
+func zoneCacheFor(acc *models.Account) *zoneCache {
+	key := credentialKey(acc)
+	zoneCachesMu.Lock()
+	defer zoneCachesMu.Unlock()
+	zc, ok := zoneCaches[key]
+	if !ok {
+		zc = &zoneCache{}
+		zoneCaches[key] = zc
+	}
+	return zc
+}
+
+func zoneCacheTTL() time.Duration {
+	if ttl := config.GlobalConfig.Cloudflare.ZoneCacheTTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return defaultZoneCacheTTL
+}
+
+var errZoneNotFound = errors.New("Zone not found")
+
+// getZoneID resolves a domain to its zone ID through the account's cache.
+// Names missing from the listing fall back to a direct lookup so zones added
+// outside this tool are still found before the cache expires.
+func getZoneID(acc *models.Account, domain string) (string, error) {
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	if id, ok := zoneCacheFor(acc).lookup(acc, name); ok {
+		return id, nil
+	}
+
+	var zones []struct {
+		ID string `json:"id"`
+	}
+	if _, err := newCFClient(acc).Get("/zones", url.Values{"name": {name}}, &zones); err != nil {
+		return "", err
+	}
+	if len(zones) == 0 {
+		return "", errZoneNotFound
+	}
+	rememberZone(acc, name, zones[0].ID)
+	return zones[0].ID, nil
+}
+
+// lookup refreshes the cache when it is stale and returns the cached ID. The
+// listing runs without holding mu so other lookups aren't blocked behind a
+// long walk of /zones.
+func (zc *zoneCache) lookup(acc *models.Account, name string) (string, bool) {
+	zc.mu.Lock()
+	defer zc.mu.Unlock()
+	for zc.ids == nil || time.Since(zc.loadedAt) > zoneCacheTTL() {
+		if zc.loading != nil {
+			loading := zc.loading
+			zc.mu.Unlock()
+			<-loading
+			zc.mu.Lock()
+			continue
+		}
+		// A failed listing is not fatal, the direct lookup still works.
+		if time.Since(zc.failedAt) < zoneListBackoff {
+			break
+		}
+		loading := make(chan struct{})
+		zc.loading = loading
+		zc.mu.Unlock()
+		zones, err := listZones(acc)
+		zc.mu.Lock()
+		zc.loading = nil
+		close(loading)
+		if err != nil {
+			zc.failedAt = time.Now()
+			break
+		}
+		zc.ids = make(map[string]string, len(zones))
+		for _, zone := range zones {
+			zc.ids[zone.Name] = zone.ID
+		}
+		zc.loadedAt = time.Now()
+	}
+	id, ok := zc.ids[name]
+	return id, ok
+}
+
+func rememberZone(acc *models.Account, name string, id string) {
+	zc := zoneCacheFor(acc)
+	zc.mu.Lock()
+	defer zc.mu.Unlock()
+	if zc.ids != nil {
+		zc.ids[strings.ToLower(name)] = id
+	}
+}
+
+func forgetZone(acc *models.Account, name string) {
+	zc := zoneCacheFor(acc)
+	zc.mu.Lock()
+	defer zc.mu.Unlock()
+	if zc.ids != nil {
+		delete(zc.ids, strings.ToLower(name))
+	}
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"bytes"
+	"cloudflare-tools/server/models"
+	"cloudflare-tools/server/xlsx"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// exportColumn is a column of the zone spreadsheet. needs names the extra
+// lookup the column depends on: "records" lists the DNS records of every
+// zone and "ssl" reads the SSL setting.
+type exportColumn struct {
+	name  string
+	needs string
+	value func(z *ExportZoneResult) interface{}
+}
+
+var exportColumns = []exportColumn{
+	{"account", "", func(z *ExportZoneResult) interface{} { return z.Account }},
+	{"domain", "", func(z *ExportZoneResult) interface{} { return z.Domain }},
+	{"zone_id", "", func(z *ExportZoneResult) interface{} { return z.ZoneID }},
+	{"status", "", func(z *ExportZoneResult) interface{} { return z.Status }},
+	{"type", "", func(z *ExportZoneResult) interface{} { return z.Type }},
+	{"plan", "", func(z *ExportZoneResult) interface{} { return z.Plan }},
+	{"paused", "", func(z *ExportZoneResult) interface{} {
+		if z.ZoneID == "" {
+			return nil
+		}
+		return fmt.Sprint(z.Paused)
+	}},
+	{"nameservers", "", func(z *ExportZoneResult) interface{} { return strings.Join(z.NameServers, ", ") }},
+	{"original_registrar", "", func(z *ExportZoneResult) interface{} { return z.OriginalRegistrar }},
+	{"original_nameservers", "", func(z *ExportZoneResult) interface{} { return strings.Join(z.OriginalNameServers, ", ") }},
+	{"created_on", "", func(z *ExportZoneResult) interface{} { return z.CreatedOn }},
+	{"dns_records", "records", func(z *ExportZoneResult) interface{} { return intCell(z.DNSRecords) }},
+	{"proxied_records", "records", func(z *ExportZoneResult) interface{} { return intCell(z.ProxiedRecords) }},
+	{"proxied_ratio", "records", func(z *ExportZoneResult) interface{} {
+		if z.ProxiedRatio == nil {
+			return nil
+		}
+		return *z.ProxiedRatio
+	}},
+	{"ssl_mode", "ssl", func(z *ExportZoneResult) interface{} { return z.SSLMode }},
+	{"error", "", func(z *ExportZoneResult) interface{} { return z.Error }},
+}
+
+func intCell(v *int) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// selectExportColumns resolves the requested column names. Without any the
+// old export layout is used, led by the account when several are exported.
+func selectExportColumns(names []string, allAccounts bool) ([]exportColumn, error) {
+	if len(names) == 0 {
+		names = []string{"domain", "status", "nameservers", "created_on"}
+		if allAccounts {
+			names = append([]string{"account"}, names...)
+		}
+	}
+
+	byName := map[string]exportColumn{}
+	for _, col := range exportColumns {
+		byName[col.name] = col
+	}
+	var columns []exportColumn
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		col, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown column %s", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			columns = append(columns, col)
+		}
+	}
+	return columns, nil
+}
+
+// exportAccountZones lists the zones of the accounts and reads whatever the
+// columns need on top. With several accounts, an account whose zones can't
+// be listed becomes a row with the error instead of failing the export.
+func exportAccountZones(accounts []models.Account, columns []exportColumn) ([]ExportZoneResult, error) {
+	lists := make([][]ExportZoneResult, len(accounts))
+	errs := make([]error, len(accounts))
+	forEachBounded(len(accounts), func(idx int) {
+		lists[idx], errs[idx] = fetchAllZones(&accounts[idx])
+	})
+
+	var zones []ExportZoneResult
+	var owners []*models.Account
+	for i := range accounts {
+		acc := &accounts[i]
+		if errs[i] != nil {
+			if len(accounts) == 1 {
+				return nil, errs[i]
+			}
+			zones = append(zones, ExportZoneResult{Account: acc.Name, AccountID: acc.ID, Error: errs[i].Error()})
+			owners = append(owners, nil)
+			continue
+		}
+		for _, z := range lists[i] {
+			z.Account = acc.Name
+			z.AccountID = acc.ID
+			zones = append(zones, z)
+			owners = append(owners, acc)
+		}
+	}
+
+	needs := map[string]bool{}
+	for _, col := range columns {
+		needs[col.needs] = true
+	}
+	if needs["records"] || needs["ssl"] {
+		forEachBounded(len(zones), func(idx int) {
+			if owners[idx] != nil {
+				enrichExportZone(owners[idx], &zones[idx], needs["records"], needs["ssl"])
+			}
+		})
+	}
+	if zones == nil {
+		zones = []ExportZoneResult{}
+	}
+	return zones, nil
+}
+
+func enrichExportZone(acc *models.Account, z *ExportZoneResult, records bool, ssl bool) {
+	var errs []string
+	if records {
+		list, err := listDNSRecords(acc, z.ZoneID, nil)
+		if err != nil {
+			errs = append(errs, "records: "+err.Error())
+		} else {
+			total, proxied, proxiable := len(list), 0, 0
+			for _, r := range list {
+				switch r.Type {
+				case "A", "AAAA", "CNAME":
+					proxiable++
+					if r.Proxied {
+						proxied++
+					}
+				}
+			}
+			z.DNSRecords = &total
+			z.ProxiedRecords = &proxied
+			// the ratio is over the records that can be proxied at all
+			if proxiable > 0 {
+				ratio := math.Round(float64(proxied)/float64(proxiable)*100) / 100
+				z.ProxiedRatio = &ratio
+			}
+		}
+	}
+	if ssl {
+		if mode, err := getZoneSetting(acc, z.ZoneID, "ssl"); err != nil {
+			errs = append(errs, "ssl: "+err.Error())
+		} else if mode != nil {
+			z.SSLMode = fmt.Sprint(mode)
+		}
+	}
+	z.Error = strings.Join(errs, "; ")
+}
+
+// writeZoneExport renders the zones as csv or xlsx. The error column is
+// added when a row failed and it wasn't selected.
+func writeZoneExport(format string, columns []exportColumn, zones []ExportZoneResult) ([]byte, string, error) {
+	hasError := false
+	for _, col := range columns {
+		hasError = hasError || col.name == "error"
+	}
+	if !hasError {
+		for _, z := range zones {
+			if z.Error != "" {
+				columns = append(columns, exportColumns[len(exportColumns)-1])
+				break
+			}
+		}
+	}
+
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.name
+	}
+	rows := make([][]interface{}, len(zones))
+	for i := range zones {
+		row := make([]interface{}, len(columns))
+		for j, col := range columns {
+			row[j] = col.value(&zones[i])
+		}
+		rows[i] = row
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "csv":
+		w := csv.NewWriter(&buf)
+		w.Write(header)
+		for _, row := range rows {
+			record := make([]string, len(row))
+			for j, cell := range row {
+				if cell != nil {
+					record[j] = fmt.Sprint(cell)
+				}
+			}
+			w.Write(record)
+		}
+		w.Flush()
+		return buf.Bytes(), "text/csv; charset=utf-8", w.Error()
+	case "xlsx":
+		if err := xlsx.Write(&buf, "Zones", header, rows); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", nil
+	}
+	return nil, "", fmt.Errorf("Unknown format %s, use csv or xlsx", format)
+}
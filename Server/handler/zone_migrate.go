@@ -0,0 +1,401 @@
+package handler
+
+import (
+	"cloudflare-tools/server/migrations"
+	"cloudflare-tools/server/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MigrateZoneRequest struct {
+	SourceAccountID string `json:"sourceAccountId"`
+	// AccountID is the account the zones move to
+	AccountID string   `json:"accountId"`
+	Domains   []string `json:"domains"`
+	// RuleTypes limits the rules copied along; empty copies every type
+	RuleTypes []string `json:"ruleTypes"`
+	DryRun    bool     `json:"dryRun"`
+}
+
+type CompleteMigrationRequest struct {
+	// Confirm must repeat the domain name
+	Confirm string `json:"confirm"`
+	// Force deletes the source zone even if the target zone isn't active
+	Force bool `json:"force"`
+}
+
+type MigrateZoneResult struct {
+	Domain      string   `json:"domain"`
+	Success     bool     `json:"success"`
+	Message     string   `json:"message"`
+	MigrationID string   `json:"migrationId,omitempty"`
+	NameServers []string `json:"nameServers,omitempty"`
+	Records     int      `json:"records"`
+	Settings    int      `json:"settings"`
+	Rules       int      `json:"rules"`
+	Steps       []string `json:"steps,omitempty"`
+	Retries     int      `json:"retries,omitempty"`
+	Plan        []string `json:"plan,omitempty"`
+}
+
+// migrationRuleTypes are the rule types restored, in order.
+var migrationRuleTypes = []string{"page_rules", "firewall_rules", "rate_limiting"}
+
+// cfZoneSetting is one entry of GET /zones/{id}/settings.
+type cfZoneSetting struct {
+	ID       string      `json:"id"`
+	Value    interface{} `json:"value"`
+	Editable bool        `json:"editable"`
+}
+
+// MigrateZones moves zones to another account: the source zone's records,
+// settings and rules are saved, the zone is created in the target account
+// and everything is restored there. The source zone stays in place until
+// the operator confirms the migration with CompleteMigration.
+func MigrateZones(c *gin.Context) {
+	var req MigrateZoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !normalizeZones(c, &req.Domains) {
+		return
+	}
+
+	acc := findAccount(req.AccountID)
+	if acc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+	srcAcc := findAccount(req.SourceAccountID)
+	if srcAcc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source account not found"})
+		return
+	}
+	if srcAcc.ID == acc.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source and target account are the same"})
+		return
+	}
+
+	if len(req.RuleTypes) == 0 {
+		req.RuleTypes = migrationRuleTypes
+	}
+	for _, ruleType := range req.RuleTypes {
+		if _, ok := rulePaths[ruleType]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown rule type " + ruleType})
+			return
+		}
+	}
+
+	runBatch(c, "zone.migrate", acc, &req, len(req.Domains), func(idx int, acc *models.Account) MigrateZoneResult {
+		dom := strings.ToLower(strings.TrimSpace(req.Domains[idx]))
+		var result MigrateZoneResult
+		if req.DryRun {
+			result = planMigrateZone(srcAcc, acc, dom, req.RuleTypes)
+		} else {
+			result = migrateZone(srcAcc, acc, dom, req.RuleTypes)
+		}
+		result.Retries = retriesFor(acc)
+		return result
+	})
+}
+
+// ListMigrations answers GET /api/zones/migrations.
+func ListMigrations(c *gin.Context) {
+	list, err := migrations.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// GetMigration returns a migration with the snapshot of its source zone.
+func GetMigration(c *gin.Context) {
+	m, err := migrations.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// CompleteMigration deletes the source zone of a restored migration. The
+// request has to repeat the domain name, and unless forced the target zone
+// must be active so the domain never resolves to a deleted zone.
+func CompleteMigration(c *gin.Context) {
+	var req CompleteMigrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	m, err := migrations.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if m.Status != migrations.StatusRestored {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Migration is %s", m.Status)})
+		return
+	}
+	if !strings.EqualFold(strings.TrimSpace(req.Confirm), m.Domain) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Confirm must repeat the domain name"})
+		return
+	}
+
+	srcAcc := findAccount(m.SourceAccountID)
+	if srcAcc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source account not found"})
+		return
+	}
+	acc := findAccount(m.TargetAccountID)
+	if acc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	if !req.Force {
+		var zone cfZone
+		if _, err := newCFClient(acc).Get(fmt.Sprintf("/zones/%s", m.TargetZoneID), nil, &zone); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		if zone.Status != "active" {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Target zone is %s; switch the nameservers to %s first", zone.Status, strings.Join(m.NameServers, ", "))})
+			return
+		}
+	}
+
+	entry := newAuditEntry(c, "zone.migrate-complete", srcAcc, &req)
+	entry.Domains = []string{m.Domain}
+	success, msg := deleteZoneFromCloudflare(srcAcc, m.Domain)
+	result := DeleteZoneResult{Domain: m.Domain, Success: success, Message: msg}
+	entry.Results = []interface{}{result}
+	recordAudit(entry)
+	if !success {
+		c.JSON(http.StatusBadGateway, gin.H{"error": msg})
+		return
+	}
+
+	updated, err := migrations.Update(m.ID, func(m *migrations.Migration) {
+		now := time.Now()
+		m.Status = migrations.StatusCompleted
+		m.CompletedAt = &now
+		m.Steps = append(m.Steps, "deleted source zone")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	updated.Snapshot = nil
+	c.JSON(http.StatusOK, updated)
+}
+
+func migrateZone(srcAcc *models.Account, acc *models.Account, domain string, ruleTypes []string) MigrateZoneResult {
+	result := MigrateZoneResult{Domain: domain}
+
+	sourceZoneID, err := getZoneID(srcAcc, domain)
+	if err != nil {
+		result.Message = "Source zone: " + err.Error()
+		return result
+	}
+	snap, records, err := snapshotZone(srcAcc, domain, sourceZoneID, ruleTypes)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	m := migrations.Migration{
+		Domain:          domain,
+		SourceAccountID: srcAcc.ID,
+		SourceZoneID:    sourceZoneID,
+		TargetAccountID: acc.ID,
+		Snapshot:        snap,
+	}
+	step := func(format string, args ...interface{}) {
+		m.Steps = append(m.Steps, fmt.Sprintf(format, args...))
+	}
+	step("saved %d records, %d settings and %d rules", len(records), len(snap.Settings), countSnapshotRules(snap))
+
+	err = restoreZone(acc, domain, records, snap, &m, &result, step)
+	if err != nil {
+		m.Status = migrations.StatusFailed
+		m.Error = err.Error()
+	} else {
+		m.Status = migrations.StatusRestored
+	}
+	saved, saveErr := migrations.Save(m)
+	if saveErr == nil {
+		result.MigrationID = saved.ID
+	}
+
+	result.Steps = m.Steps
+	result.NameServers = m.NameServers
+	switch {
+	case err != nil:
+		result.Message = err.Error()
+	case saveErr != nil:
+		result.Message = "Restored, but saving the migration failed: " + saveErr.Error()
+	default:
+		result.Success = true
+		result.Message = fmt.Sprintf("Restored in target account, change the nameservers to %s", strings.Join(m.NameServers, ", "))
+	}
+	return result
+}
+
+// snapshotZone reads what the source zone holds. The records also go into a
+// regular snapshot so they can be rolled back to like any other change.
+func snapshotZone(acc *models.Account, domain string, zoneID string, ruleTypes []string) (*migrations.Snapshot, []cfDNSRecord, error) {
+	records, err := listDNSRecords(acc, zoneID, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := snapshotRecords(acc, domain, zoneID, "zone.migrate", records); err != nil {
+		return nil, nil, err
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var settings []cfZoneSetting
+	if _, err := newCFClient(acc).Get(fmt.Sprintf("/zones/%s/settings", zoneID), nil, &settings); err != nil {
+		return nil, nil, fmt.Errorf("Reading settings failed: %v", err)
+	}
+
+	snap := &migrations.Snapshot{Records: data, Rules: map[string][]map[string]interface{}{}}
+	for _, s := range settings {
+		if s.Editable && s.Value != nil {
+			snap.Settings = append(snap.Settings, migrations.Setting{ID: s.ID, Value: s.Value})
+		}
+	}
+	for _, ruleType := range ruleTypes {
+		rules, err := listZoneRules(acc, zoneID, ruleType)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Reading %s failed: %v", ruleType, err)
+		}
+		if len(rules) > 0 {
+			snap.Rules[ruleType] = rules
+		}
+	}
+	return snap, records, nil
+}
+
+// restoreZone creates the zone in the target account, or reuses it when an
+// earlier attempt created it already, and writes the snapshot into it.
+func restoreZone(acc *models.Account, domain string, records []cfDNSRecord, snap *migrations.Snapshot, m *migrations.Migration, result *MigrateZoneResult, step func(string, ...interface{})) error {
+	zoneID, err := getZoneID(acc, domain)
+	switch {
+	case err == nil:
+		var zone cfZone
+		if _, err := newCFClient(acc).Get(fmt.Sprintf("/zones/%s", zoneID), nil, &zone); err != nil {
+			return err
+		}
+		m.NameServers = zone.NameServers
+		step("zone already exists in target account")
+	case errors.Is(err, errZoneNotFound):
+		success, msg, zone := addZoneToCloudflare(acc, domain, zoneOptions{AccountID: acc.CFAccountID, Type: "full"})
+		if !success {
+			return fmt.Errorf("Creating zone failed: %s", msg)
+		}
+		zoneID = zone.ID
+		m.NameServers = zone.NameServers
+		step("created zone in target account")
+	default:
+		return err
+	}
+	m.TargetZoneID = zoneID
+
+	// the target must end up with exactly the source records, so records
+	// already in a reused zone are pruned
+	wanted := copyDNSRecords(records, domain, domain, &BatchCopyDNSRequest{KeepProxied: true, KeepComments: true})
+	synced := syncZone(acc, domain, wanted, true, false)
+	if !synced.Success {
+		return fmt.Errorf("Restoring records failed: %s", synced.Message)
+	}
+	result.Records = len(wanted)
+	step("records: created %d, updated %d, deleted %d", synced.Created, synced.Updated, synced.Deleted)
+
+	// settings the target plan doesn't support fail on their own and are
+	// reported in the step
+	changes := make([]settingChange, len(snap.Settings))
+	for i, s := range snap.Settings {
+		changes[i] = settingChange{Setting: s.ID, Value: s.Value}
+	}
+	result.Settings, _ = countSettingUpdates(acc, zoneID, changes)
+	step("settings: restored %d/%d", result.Settings, len(changes))
+
+	for _, ruleType := range migrationRuleTypes {
+		rules := snap.Rules[ruleType]
+		if len(rules) == 0 {
+			continue
+		}
+		count := createZoneRules(acc, zoneID, ruleType, rules)
+		result.Rules += count
+		step("%s: restored %d/%d", ruleType, count, len(rules))
+	}
+	return nil
+}
+
+func planMigrateZone(srcAcc *models.Account, acc *models.Account, domain string, ruleTypes []string) MigrateZoneResult {
+	result := MigrateZoneResult{Domain: domain}
+
+	sourceZoneID, err := getZoneID(srcAcc, domain)
+	if err != nil {
+		result.Message = "Source zone: " + err.Error()
+		return result
+	}
+	records, err := listDNSRecords(srcAcc, sourceZoneID, nil)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	var settings []cfZoneSetting
+	if _, err := newCFClient(srcAcc).Get(fmt.Sprintf("/zones/%s/settings", sourceZoneID), nil, &settings); err != nil {
+		result.Message = fmt.Sprintf("Reading settings failed: %v", err)
+		return result
+	}
+	for _, s := range settings {
+		if s.Editable && s.Value != nil {
+			result.Settings++
+		}
+	}
+	result.Records = len(copyDNSRecords(records, domain, domain, &BatchCopyDNSRequest{}))
+
+	switch _, err := getZoneID(acc, domain); {
+	case err == nil:
+		result.Plan = append(result.Plan, fmt.Sprintf("zone %s exists in target account, restore into it", domain))
+	case errors.Is(err, errZoneNotFound):
+		result.Plan = append(result.Plan, fmt.Sprintf("create zone %s in target account", domain))
+	default:
+		result.Message = err.Error()
+		return result
+	}
+	result.Plan = append(result.Plan,
+		fmt.Sprintf("records: would restore %d", result.Records),
+		fmt.Sprintf("settings: would restore %d", result.Settings))
+	rulePlan, total := planRuleCounts(srcAcc, sourceZoneID, ruleTypes, "restore")
+	result.Rules = total
+	result.Plan = append(result.Plan, rulePlan...)
+	result.Plan = append(result.Plan, "source zone is kept until the migration is completed")
+
+	result.Success = true
+	result.Message = dryRunMessage(len(result.Plan))
+	return result
+}
+
+func countSnapshotRules(snap *migrations.Snapshot) int {
+	total := 0
+	for _, rules := range snap.Rules {
+		total += len(rules)
+	}
+	return total
+}
@@ -0,0 +1,329 @@
+// Package inventory keeps a local index of the zones of every stored
+// account, so a domain can be found without asking each account in turn.
+package inventory
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultPath = "state/inventory.json"
+
+// Zone is one zone of one account.
+type Zone struct {
+	Domain      string   `json:"domain"`
+	ZoneID      string   `json:"zoneId"`
+	AccountID   string   `json:"accountId"`
+	Status      string   `json:"status"`
+	Type        string   `json:"type,omitempty"`
+	Plan        string   `json:"plan,omitempty"`
+	NameServers []string `json:"nameServers,omitempty"`
+	CreatedOn   string   `json:"createdOn,omitempty"`
+}
+
+// Account is the refresh state of one account. A failed refresh keeps the
+// zones of the last successful one.
+type Account struct {
+	AccountID   string     `json:"accountId"`
+	Zones       int        `json:"zones"`
+	RefreshedAt *time.Time `json:"refreshedAt,omitempty"`
+	CheckedAt   *time.Time `json:"checkedAt,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Query selects zones in Search. Pattern matches the domain as a glob when
+// it contains * or ?, otherwise as a substring. Zero values match
+// everything.
+type Query struct {
+	Pattern   string
+	AccountID string
+	Status    string
+	Limit     int
+}
+
+type state struct {
+	Zones    []Zone    `json:"zones"`
+	Accounts []Account `json:"accounts"`
+}
+
+var (
+	filePath = DefaultPath
+	mu       sync.Mutex
+	current  state
+	// loaded is set once the file has been read
+	loaded bool
+)
+
+func SetPath(p string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if p == "" {
+		p = DefaultPath
+	}
+	filePath = p
+	loaded = false
+}
+
+// Replace sets the zones of an account after a successful listing.
+func Replace(accountID string, zones []Zone) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return err
+	}
+
+	kept := current.Zones[:0]
+	for _, z := range current.Zones {
+		if z.AccountID != accountID {
+			kept = append(kept, z)
+		}
+	}
+	for _, z := range zones {
+		z.Domain = normalize(z.Domain)
+		z.AccountID = accountID
+		kept = append(kept, z)
+	}
+	current.Zones = kept
+
+	now := time.Now()
+	acc := account(accountID)
+	acc.RefreshedAt = &now
+	acc.CheckedAt = &now
+	acc.Error = ""
+	recount()
+	return save()
+}
+
+// Failed records a failed refresh of an account; its zones stay as they were.
+func Failed(accountID string, reason string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	acc := account(accountID)
+	acc.CheckedAt = &now
+	acc.Error = reason
+	return save()
+}
+
+// Put adds a zone or updates the one with the same domain and account.
+func Put(zone Zone) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return err
+	}
+
+	zone.Domain = normalize(zone.Domain)
+	if i := index(zone.Domain, zone.AccountID); i >= 0 {
+		current.Zones[i] = zone
+	} else {
+		current.Zones = append(current.Zones, zone)
+	}
+	account(zone.AccountID)
+	recount()
+	return save()
+}
+
+func Remove(domain string, accountID string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return err
+	}
+
+	i := index(normalize(domain), accountID)
+	if i < 0 {
+		return nil
+	}
+	current.Zones = append(current.Zones[:i], current.Zones[i+1:]...)
+	recount()
+	return save()
+}
+
+// Prune drops the accounts, and their zones, that aren't in keep any more.
+func Prune(keep []string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return err
+	}
+
+	ids := map[string]bool{}
+	for _, id := range keep {
+		ids[id] = true
+	}
+	zones := current.Zones[:0]
+	for _, z := range current.Zones {
+		if ids[z.AccountID] {
+			zones = append(zones, z)
+		}
+	}
+	current.Zones = zones
+	accounts := current.Accounts[:0]
+	for _, a := range current.Accounts {
+		if ids[a.AccountID] {
+			accounts = append(accounts, a)
+		}
+	}
+	current.Accounts = accounts
+	return save()
+}
+
+// Lookup returns every account's zone for the domain. A domain can be in
+// several accounts while it is moving between them.
+func Lookup(domain string) ([]Zone, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return nil, err
+	}
+
+	domain = normalize(domain)
+	var zones []Zone
+	for _, z := range current.Zones {
+		if z.Domain == domain {
+			zones = append(zones, z)
+		}
+	}
+	return zones, nil
+}
+
+// Search returns the zones matching q sorted by domain, and how many
+// matched before the limit was applied.
+func Search(q Query) ([]Zone, int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return nil, 0, err
+	}
+
+	pattern := normalize(q.Pattern)
+	glob := strings.ContainsAny(pattern, "*?[")
+	zones := []Zone{}
+	for _, z := range current.Zones {
+		if q.AccountID != "" && z.AccountID != q.AccountID {
+			continue
+		}
+		if q.Status != "" && z.Status != q.Status {
+			continue
+		}
+		if pattern != "" {
+			if glob {
+				if ok, _ := path.Match(pattern, z.Domain); !ok {
+					continue
+				}
+			} else if !strings.Contains(z.Domain, pattern) {
+				continue
+			}
+		}
+		zones = append(zones, z)
+	}
+	sort.SliceStable(zones, func(i, j int) bool {
+		if zones[i].Domain != zones[j].Domain {
+			return zones[i].Domain < zones[j].Domain
+		}
+		return zones[i].AccountID < zones[j].AccountID
+	})
+
+	total := len(zones)
+	if q.Limit > 0 && len(zones) > q.Limit {
+		zones = zones[:q.Limit]
+	}
+	return zones, total, nil
+}
+
+// Accounts returns the refresh state of every account.
+func Accounts() ([]Account, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return nil, err
+	}
+
+	list := make([]Account, len(current.Accounts))
+	copy(list, current.Accounts)
+	return list, nil
+}
+
+func normalize(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+}
+
+func index(domain string, accountID string) int {
+	for i, z := range current.Zones {
+		if z.Domain == domain && z.AccountID == accountID {
+			return i
+		}
+	}
+	return -1
+}
+
+// account returns the state of an account, adding it when missing.
+func account(accountID string) *Account {
+	for i := range current.Accounts {
+		if current.Accounts[i].AccountID == accountID {
+			return &current.Accounts[i]
+		}
+	}
+	current.Accounts = append(current.Accounts, Account{AccountID: accountID})
+	return &current.Accounts[len(current.Accounts)-1]
+}
+
+func recount() {
+	counts := map[string]int{}
+	for _, z := range current.Zones {
+		counts[z.AccountID]++
+	}
+	for i := range current.Accounts {
+		current.Accounts[i].Zones = counts[current.Accounts[i].AccountID]
+	}
+}
+
+func load() error {
+	if loaded {
+		return nil
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			current = state{Zones: []Zone{}, Accounts: []Account{}}
+			loaded = true
+			return nil
+		}
+		return err
+	}
+	var stored state
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	current = stored
+	loaded = true
+	return nil
+}
+
+// save writes the index to a temporary file first so a crash can't leave a
+// truncated file behind.
+func save() error {
+	data, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return err
+	}
+	tmp := filePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filePath)
+}
@@ -0,0 +1,168 @@
+package jobs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatusRunning  = "running"
+	StatusFinished = "finished"
+)
+
+// finished jobs are kept around this long so results can be fetched later
+const retention = 2 * time.Hour
+
+// Event is pushed to subscribers whenever a per-item result lands or the job ends.
+type Event struct {
+	Type   string      `json:"type"`
+	Index  int         `json:"index"`
+	Result interface{} `json:"result,omitempty"`
+	Done   int         `json:"done"`
+	Total  int         `json:"total"`
+}
+
+// Info is the JSON view of a job returned by the API.
+type Info struct {
+	ID         string        `json:"id"`
+	Type       string        `json:"type"`
+	Status     string        `json:"status"`
+	Total      int           `json:"total"`
+	Done       int           `json:"done"`
+	Results    []interface{} `json:"results,omitempty"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	FinishedAt *time.Time    `json:"finishedAt,omitempty"`
+}
+
+type Job struct {
+	Info
+
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+var (
+	store   = make(map[string]*Job)
+	storeMu sync.RWMutex
+)
+
+func New(jobType string, total int) *Job {
+	job := &Job{
+		Info: Info{
+			ID:        uuid.New().String(),
+			Type:      jobType,
+			Status:    StatusRunning,
+			Total:     total,
+			Results:   make([]interface{}, total),
+			CreatedAt: time.Now(),
+		},
+		subscribers: make(map[chan Event]struct{}),
+	}
+
+	storeMu.Lock()
+	prune()
+	store[job.ID] = job
+	storeMu.Unlock()
+	return job
+}
+
+func Get(id string) *Job {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return store[id]
+}
+
+// List returns snapshots of all retained jobs without their results.
+func List() []Info {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	list := make([]Info, 0, len(store))
+	for _, job := range store {
+		snap := job.Snapshot()
+		snap.Results = nil
+		list = append(list, snap)
+	}
+	return list
+}
+
+func prune() {
+	for id, job := range store {
+		job.mu.Lock()
+		expired := job.FinishedAt != nil && time.Since(*job.FinishedAt) > retention
+		job.mu.Unlock()
+		if expired {
+			delete(store, id)
+		}
+	}
+}
+
+func (j *Job) SetResult(idx int, result interface{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Results[idx] = result
+	j.Done++
+	j.broadcast(Event{Type: "result", Index: idx, Result: result, Done: j.Done, Total: j.Total})
+}
+
+func (j *Job) Finish() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.Status = StatusFinished
+	j.FinishedAt = &now
+	j.broadcast(Event{Type: "done", Index: -1, Done: j.Done, Total: j.Total})
+	for ch := range j.subscribers {
+		close(ch)
+	}
+	j.subscribers = nil
+}
+
+// Subscribe returns the results recorded so far and a channel for the rest.
+// The channel is closed once the job finishes; call cancel to stop early.
+func (j *Job) Subscribe() (Info, <-chan Event, func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ch := make(chan Event, j.Total+1)
+	snap := j.snapshot()
+	if j.Status == StatusFinished {
+		close(ch)
+		return snap, ch, func() {}
+	}
+
+	j.subscribers[ch] = struct{}{}
+	cancel := func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, ok := j.subscribers[ch]; ok {
+			delete(j.subscribers, ch)
+			close(ch)
+		}
+	}
+	return snap, ch, cancel
+}
+
+func (j *Job) Snapshot() Info {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.snapshot()
+}
+
+func (j *Job) snapshot() Info {
+	info := j.Info
+	info.Results = append([]interface{}(nil), j.Results...)
+	return info
+}
+
+// broadcast must be called with j.mu held. Subscriber channels are buffered
+// for the whole job, so sends never block.
+func (j *Job) broadcast(ev Event) {
+	for ch := range j.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
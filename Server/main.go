@@ -1,10 +1,17 @@
 package main
 
 import (
+	"cloudflare-tools/server/audit"
 	"cloudflare-tools/server/config"
 	"cloudflare-tools/server/handler"
+	"cloudflare-tools/server/inventory"
+	"cloudflare-tools/server/migrations"
 	"cloudflare-tools/server/models"
+	"cloudflare-tools/server/onboarding"
+	"cloudflare-tools/server/snapshots"
+	"cloudflare-tools/server/templates"
 	"embed"
+	"errors"
 	"io/fs"
 	"log"
 	"net/http"
@@ -19,10 +26,29 @@ func main() {
 	if err := config.LoadConfig(); err != nil {
 		log.Printf("Warning: Failed to load config.yaml: %v", err)
 	}
+	// the key is never generated or stored next to accounts.json, a backup
+	// of the data directory must not be enough to read the API keys
+	masterKey := config.MasterKey()
+	if masterKey == "" {
+		log.Fatal("No master key configured: set CF_TOOLS_MASTER_KEY (e.g. openssl rand -hex 32) or security.master_key, and keep it outside the data directory")
+	}
+	models.SetMasterKey(masterKey)
+	audit.SetPath(config.GlobalConfig.Audit.Path)
+	snapshots.SetDir(config.GlobalConfig.Snapshots.Dir)
+	onboarding.SetPath(config.GlobalConfig.Onboarding.Path)
+	templates.SetPath(config.GlobalConfig.Templates.Path)
+	migrations.SetPath(config.GlobalConfig.Migrations.Path)
+	inventory.SetPath(config.GlobalConfig.Inventory.Path)
 	if err := models.LoadAccounts(); err != nil {
+		if errors.Is(err, models.ErrMasterKey) {
+			log.Fatal(err)
+		}
 		log.Printf("Warning: Failed to load accounts.json: %v", err)
 	}
 
+	handler.StartOnboardingChecker()
+	handler.StartInventoryRefresher()
+
 	r := gin.Default()
 
 	r.POST("/api/login", handler.Login)
@@ -35,13 +61,44 @@ func main() {
 		api.GET("/accounts", handler.ListAccounts)
 		api.POST("/accounts", handler.AddAccount)
 		api.POST("/accounts/test", handler.TestAccount)
+		api.GET("/accounts/memberships", handler.ListAccountMemberships)
 		api.DELETE("/accounts/:id", handler.DeleteAccount)
+		api.POST("/domains/normalize", handler.NormalizeDomains)
 		api.POST("/zones/batch-add", handler.BatchAddZones)
 		api.POST("/zones/batch-delete", handler.BatchDeleteZones)
 		api.POST("/zones/export", handler.ExportZones)
+		api.POST("/zones/migrate", handler.MigrateZones)
+		api.GET("/zones/migrations", handler.ListMigrations)
+		api.GET("/zones/migrations/:id", handler.GetMigration)
+		api.POST("/zones/migrations/:id/complete", handler.CompleteMigration)
+		api.GET("/inventory", handler.SearchInventory)
+		api.POST("/inventory/refresh", handler.RefreshInventory)
+		api.GET("/onboarding", handler.ListOnboarding)
+		api.POST("/onboarding/track", handler.TrackOnboarding)
+		api.POST("/onboarding/check", handler.CheckOnboarding)
+		api.DELETE("/onboarding/:domain", handler.UntrackOnboarding)
 		api.POST("/dns/batch-parse", handler.BatchParseDNS)
 		api.POST("/dns/batch-delete", handler.BatchDeleteDNS)
 		api.POST("/dns/proxy-toggle", handler.BatchProxyToggle)
+		api.POST("/dns/verify", handler.VerifyDNS)
+		api.POST("/dns/takeover/scan", handler.ScanTakeover)
+		api.POST("/dns/records/list", handler.ListDNSRecords)
+		api.PATCH("/dns/records", handler.UpdateDNSRecords)
+		api.POST("/dns/zonefile/preview", handler.PreviewZoneFile)
+		api.POST("/dns/zonefile/import", handler.ImportZoneFile)
+		api.GET("/dns/zonefile/export", handler.ExportZoneFile)
+		api.POST("/dns/sync", handler.SyncDNS)
+		api.POST("/dns/copy", handler.BatchCopyDNS)
+		api.GET("/dns/sync/export", handler.ExportDNSState)
+		api.GET("/dns/templates", handler.ListTemplates)
+		api.POST("/dns/templates", handler.SaveTemplate)
+		api.GET("/dns/templates/:name", handler.GetTemplate)
+		api.DELETE("/dns/templates/:name", handler.DeleteTemplate)
+		api.POST("/dns/templates/preview", handler.PreviewTemplate)
+		api.POST("/dns/templates/apply", handler.ApplyTemplate)
+		api.GET("/dns/snapshots", handler.ListDNSSnapshots)
+		api.GET("/dns/snapshots/:id", handler.GetDNSSnapshot)
+		api.POST("/dns/rollback", handler.RollbackDNS)
 		api.POST("/ssl/batch-settings", handler.BatchSSLSettings)
 		api.POST("/certs/batch-apply", handler.BatchApplyCert)
 		api.GET("/certs/list", handler.ListCerts)
@@ -51,6 +108,12 @@ func main() {
 		api.POST("/optimization/batch-settings", handler.BatchOptimization)
 		api.POST("/bulk-settings/batch-apply", handler.BatchBulkSettings)
 		api.POST("/email/batch-routing", handler.BatchEmailRouting)
+		api.POST("/dnssec/batch", handler.BatchDNSSEC)
+		api.POST("/dnssec/status", handler.DNSSECStatus)
+		api.GET("/jobs", handler.ListJobs)
+		api.GET("/jobs/:id", handler.GetJob)
+		api.GET("/jobs/:id/events", handler.JobEvents)
+		api.GET("/audit", handler.ListAudit)
 	}
 
 	dist, err := fs.Sub(content, "dist")
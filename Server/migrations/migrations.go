@@ -0,0 +1,193 @@
+// Package migrations keeps the state of zones being moved between Cloudflare
+// accounts, including a copy of everything the source zone held, until the
+// operator confirms the move and the source zone is deleted.
+package migrations
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const DefaultPath = "state/migrations.json"
+
+const (
+	// StatusRestored means the target zone holds the copy and the source
+	// zone is still in place
+	StatusRestored = "restored"
+	// StatusFailed means the copy stopped part way; the source is untouched
+	StatusFailed = "failed"
+	// StatusCompleted means the source zone has been deleted
+	StatusCompleted = "completed"
+)
+
+var ErrNotFound = errors.New("Migration not found")
+
+// Setting is one zone setting as read from the source zone.
+type Setting struct {
+	ID    string      `json:"id"`
+	Value interface{} `json:"value"`
+}
+
+// Snapshot is what the source zone held when the migration started. Rules
+// are kept as returned by the API, keyed by rule type.
+type Snapshot struct {
+	Records  json.RawMessage                     `json:"records"`
+	Settings []Setting                           `json:"settings"`
+	Rules    map[string][]map[string]interface{} `json:"rules,omitempty"`
+}
+
+type Migration struct {
+	ID              string     `json:"id"`
+	Domain          string     `json:"domain"`
+	SourceAccountID string     `json:"sourceAccountId"`
+	SourceZoneID    string     `json:"sourceZoneId"`
+	TargetAccountID string     `json:"targetAccountId"`
+	TargetZoneID    string     `json:"targetZoneId,omitempty"`
+	NameServers     []string   `json:"nameServers,omitempty"`
+	Status          string     `json:"status"`
+	Steps           []string   `json:"steps,omitempty"`
+	Error           string     `json:"error,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	CompletedAt     *time.Time `json:"completedAt,omitempty"`
+	Snapshot        *Snapshot  `json:"snapshot,omitempty"`
+}
+
+var (
+	path       = DefaultPath
+	mu         sync.Mutex
+	migrations []Migration
+	// loaded is set once the file has been read
+	loaded bool
+)
+
+func SetPath(p string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if p == "" {
+		p = DefaultPath
+	}
+	path = p
+	loaded = false
+}
+
+// Save stores a new migration and returns it with its ID set.
+func Save(m Migration) (*Migration, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return nil, err
+	}
+
+	m.ID = uuid.New().String()
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	migrations = append(migrations, m)
+	return &m, save()
+}
+
+// List returns the migrations without their snapshots, newest first.
+func List() ([]Migration, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return nil, err
+	}
+
+	list := make([]Migration, len(migrations))
+	for i, m := range migrations {
+		m.Snapshot = nil
+		list[i] = m
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+func Get(id string) (*Migration, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return nil, err
+	}
+
+	i := index(id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	m := migrations[i]
+	return &m, nil
+}
+
+// Update applies fn to the migration and saves the result.
+func Update(id string, fn func(m *Migration)) (*Migration, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return nil, err
+	}
+
+	i := index(id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	fn(&migrations[i])
+	m := migrations[i]
+	return &m, save()
+}
+
+func index(id string) int {
+	for i, m := range migrations {
+		if m.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func load() error {
+	if loaded {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			migrations = []Migration{}
+			loaded = true
+			return nil
+		}
+		return err
+	}
+	var stored []Migration
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	migrations = stored
+	loaded = true
+	return nil
+}
+
+// save writes the migrations to a temporary file first so a crash can't
+// leave a truncated file behind.
+func save() error {
+	data, err := json.MarshalIndent(migrations, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -2,15 +2,35 @@ package models
 
 import (
 	"encoding/json"
+	"log"
 	"os"
 	"sync"
 )
 
+const (
+	AuthTypeGlobalKey = "global_key"
+	AuthTypeAPIToken  = "api_token"
+)
+
+// Account holds one set of Cloudflare credentials. Key is the Global API Key
+// for global_key accounts and the API Token for api_token accounts.
 type Account struct {
-	ID    string `json:"id"`
-	Email string `json:"email"`
-	Key   string `json:"key"`
-	Name  string `json:"name"`
+	ID          string `json:"id"`
+	Email       string `json:"email"`
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	AuthType    string `json:"authType,omitempty"`
+	CFAccountID string `json:"cfAccountId,omitempty"`
+}
+
+func (a *Account) UsesAPIToken() bool {
+	return a.AuthType == AuthTypeAPIToken
+}
+
+// Masked returns a copy of the account that is safe to send to the browser.
+func (a Account) Masked() Account {
+	a.Key = MaskKey(a.Key)
+	return a
 }
 
 var (
@@ -27,15 +47,57 @@ func LoadAccounts() error {
 		}
 		return err
 	}
-	return json.Unmarshal(data, &Accounts)
+
+	var stored []Account
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+
+	needsMigration := false
+	for i := range stored {
+		if !isSealed(stored[i].Key) {
+			if stored[i].Key != "" {
+				needsMigration = true
+			}
+			continue
+		}
+		key, err := openSecret(stored[i].Key)
+		if err != nil {
+			return err
+		}
+		stored[i].Key = key
+	}
+	Accounts = stored
+
+	if masterKey == nil {
+		log.Println("Warning: no master key configured, accounts can't be saved until one is set")
+	} else if needsMigration {
+		log.Println("Encrypting plaintext API keys in accounts.json")
+		return SaveAccounts()
+	}
+	return nil
 }
 
 func SaveAccounts() error {
 	mu.Lock()
 	defer mu.Unlock()
-	data, err := json.MarshalIndent(Accounts, "", "  ")
+
+	stored := make([]Account, len(Accounts))
+	for i, acc := range Accounts {
+		key, err := sealSecret(acc.Key)
+		if err != nil {
+			return err
+		}
+		acc.Key = key
+		stored[i] = acc
+	}
+
+	data, err := json.MarshalIndent(stored, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile("accounts.json", data, 0644)
+	if err := os.WriteFile("accounts.json", data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod("accounts.json", 0600)
 }
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+const sealedPrefix = "enc:v1:"
+
+var masterKey []byte
+
+// ErrMasterKey means accounts.json holds sealed keys that cannot be opened
+// with the configured master key.
+var ErrMasterKey = errors.New("cannot decrypt accounts.json: master key missing or wrong")
+
+// ErrNoMasterKey is returned when credentials would have to be saved in
+// clear text.
+var ErrNoMasterKey = errors.New("no master key configured, refusing to save API keys in clear text")
+
+// SetMasterKey configures the key used to seal credentials in accounts.json.
+// With an empty key credentials can't be saved.
+func SetMasterKey(key string) {
+	if key == "" {
+		masterKey = nil
+		return
+	}
+	sum := sha256.Sum256([]byte(key))
+	masterKey = sum[:]
+}
+
+// HasMasterKey reports whether accounts can be saved.
+func HasMasterKey() bool {
+	return masterKey != nil
+}
+
+func isSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+func sealSecret(plain string) (string, error) {
+	if plain == "" {
+		return plain, nil
+	}
+	if masterKey == nil {
+		return "", ErrNoMasterKey
+	}
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openSecret(value string) (string, error) {
+	if !isSealed(value) {
+		return value, nil
+	}
+	if masterKey == nil {
+		return "", ErrMasterKey
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("encrypted key is truncated")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrMasterKey
+	}
+	return string(plain), nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// MaskKey hides all but the last four characters of a credential.
+func MaskKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
@@ -0,0 +1,210 @@
+// Package onboarding keeps track of zones that were added to Cloudflare and
+// are waiting for their nameservers to be switched at the registrar.
+package onboarding
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultPath = "state/onboarding.json"
+
+const (
+	// StatusPending means the registrar still delegates to other nameservers
+	StatusPending = "pending"
+	// StatusDelegated means the delegation matches but Cloudflare hasn't
+	// activated the zone yet
+	StatusDelegated = "delegated"
+	StatusActive    = "active"
+)
+
+var ErrNotFound = errors.New("Zone is not tracked")
+
+// Zone is the onboarding state of one zone.
+type Zone struct {
+	Domain              string     `json:"domain"`
+	ZoneID              string     `json:"zoneId"`
+	AccountID           string     `json:"accountId"`
+	Status              string     `json:"status"`
+	CloudflareStatus    string     `json:"cloudflareStatus,omitempty"`
+	AssignedNameServers []string   `json:"assignedNameServers"`
+	CurrentNameServers  []string   `json:"currentNameServers,omitempty"`
+	AddedAt             time.Time  `json:"addedAt"`
+	CheckedAt           *time.Time `json:"checkedAt,omitempty"`
+	DelegatedAt         *time.Time `json:"delegatedAt,omitempty"`
+	ActivatedAt         *time.Time `json:"activatedAt,omitempty"`
+	ActivationCheckAt   *time.Time `json:"activationCheckAt,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+}
+
+// Waiting is how long the zone has been waiting for activation, or took to
+// get there once it is active.
+func (z *Zone) Waiting(now time.Time) time.Duration {
+	if z.ActivatedAt != nil {
+		return z.ActivatedAt.Sub(z.AddedAt)
+	}
+	return now.Sub(z.AddedAt)
+}
+
+var (
+	path  = DefaultPath
+	mu    sync.Mutex
+	zones []Zone
+	// loaded is set once the file has been read
+	loaded bool
+)
+
+func SetPath(p string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if p == "" {
+		p = DefaultPath
+	}
+	path = p
+	loaded = false
+}
+
+// Track starts tracking zone, or refreshes the zone ID and assigned
+// nameservers of a zone that is tracked already, keeping its history.
+func Track(zone Zone) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return err
+	}
+
+	zone.Domain = normalize(zone.Domain)
+	if i := index(zone.Domain, zone.AccountID); i >= 0 {
+		zones[i].ZoneID = zone.ZoneID
+		zones[i].AssignedNameServers = zone.AssignedNameServers
+		if zone.CloudflareStatus != "" {
+			zones[i].CloudflareStatus = zone.CloudflareStatus
+		}
+		return save()
+	}
+
+	if zone.AddedAt.IsZero() {
+		zone.AddedAt = time.Now()
+	}
+	if zone.Status == "" {
+		zone.Status = StatusPending
+	}
+	zones = append(zones, zone)
+	return save()
+}
+
+// List returns the tracked zones, longest waiting first.
+func List() ([]Zone, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return nil, err
+	}
+
+	list := make([]Zone, len(zones))
+	copy(list, zones)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].AddedAt.Before(list[j].AddedAt)
+	})
+	return list, nil
+}
+
+// Update applies fn to the tracked zone and saves the result.
+func Update(domain string, accountID string, fn func(z *Zone)) (*Zone, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return nil, err
+	}
+
+	i := index(normalize(domain), accountID)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	fn(&zones[i])
+	zone := zones[i]
+	return &zone, save()
+}
+
+// Remove stops tracking a zone; an empty accountID matches any account.
+func Remove(domain string, accountID string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return err
+	}
+
+	domain = normalize(domain)
+	kept := zones[:0]
+	removed := false
+	for _, z := range zones {
+		if z.Domain == domain && (accountID == "" || z.AccountID == accountID) {
+			removed = true
+			continue
+		}
+		kept = append(kept, z)
+	}
+	zones = kept
+	if !removed {
+		return ErrNotFound
+	}
+	return save()
+}
+
+func index(domain string, accountID string) int {
+	for i, z := range zones {
+		if z.Domain == domain && z.AccountID == accountID {
+			return i
+		}
+	}
+	return -1
+}
+
+func load() error {
+	if loaded {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			zones = []Zone{}
+			loaded = true
+			return nil
+		}
+		return err
+	}
+	var stored []Zone
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	zones = stored
+	loaded = true
+	return nil
+}
+
+// save writes the state to a temporary file first so a crash can't leave a
+// truncated file behind.
+func save() error {
+	data, err := json.MarshalIndent(zones, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func normalize(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+}
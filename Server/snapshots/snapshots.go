@@ -0,0 +1,196 @@
+package snapshots
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultDir = "snapshots"
+	// only the newest snapshots of each domain are kept
+	keepPerDomain = 50
+)
+
+var ErrNotFound = errors.New("Snapshot not found")
+
+// Snapshot holds the DNS records of one zone as they were right before an
+// operation changed them.
+type Snapshot struct {
+	ID        string          `json:"id"`
+	Domain    string          `json:"domain"`
+	ZoneID    string          `json:"zoneId"`
+	AccountID string          `json:"accountId"`
+	Operation string          `json:"operation"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Count     int             `json:"count"`
+	Records   json.RawMessage `json:"records,omitempty"`
+}
+
+var (
+	dir = DefaultDir
+	mu  sync.Mutex
+)
+
+func SetDir(d string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if d == "" {
+		d = DefaultDir
+	}
+	dir = d
+}
+
+// Save stores records (any JSON-encodable list) as a new snapshot of domain.
+func Save(domain, zoneID, accountID, operation string, records interface{}, count int) (*Snapshot, error) {
+	name := normalize(domain)
+	if name == "" {
+		return nil, errors.New("Invalid domain")
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{
+		ID:        uuid.New().String(),
+		Domain:    name,
+		ZoneID:    zoneID,
+		AccountID: accountID,
+		Operation: operation,
+		CreatedAt: time.Now(),
+		Count:     count,
+		Records:   data,
+	}
+
+	file, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	domainDir := filepath.Join(dir, snap.Domain)
+	if err := os.MkdirAll(domainDir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(domainDir, snap.ID+".json"), file, 0600); err != nil {
+		return nil, err
+	}
+	prune(snap.Domain)
+	return snap, nil
+}
+
+// List returns the snapshots of domain, or of every domain when it is empty,
+// newest first and without their records.
+func List(domain string) ([]Snapshot, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var domains []string
+	if domain != "" {
+		if name := normalize(domain); name != "" {
+			domains = []string{name}
+		}
+	} else {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				domains = append(domains, e.Name())
+			}
+		}
+	}
+
+	list := []Snapshot{}
+	for _, d := range domains {
+		snaps, err := load(d)
+		if err != nil {
+			return nil, err
+		}
+		for _, snap := range snaps {
+			snap.Records = nil
+			list = append(list, snap)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+func Get(id string) (*Snapshot, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	// IDs are UUIDs, anything else could escape the snapshot directory
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*", id+".json"))
+	if err != nil || len(matches) == 0 {
+		return nil, ErrNotFound
+	}
+	return read(matches[0])
+}
+
+// load must be called with mu held.
+func load(domain string) ([]Snapshot, error) {
+	files, err := filepath.Glob(filepath.Join(dir, domain, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var snaps []Snapshot
+	for _, f := range files {
+		snap, err := read(f)
+		if err != nil {
+			continue
+		}
+		snaps = append(snaps, *snap)
+	}
+	return snaps, nil
+}
+
+func read(file string) (*Snapshot, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// prune must be called with mu held.
+func prune(domain string) {
+	snaps, err := load(domain)
+	if err != nil || len(snaps) <= keepPerDomain {
+		return
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].CreatedAt.After(snaps[j].CreatedAt)
+	})
+	for _, snap := range snaps[keepPerDomain:] {
+		os.Remove(filepath.Join(dir, domain, snap.ID+".json"))
+	}
+}
+
+// normalize returns the directory name used for domain, or "" when the name
+// can't be used as one.
+func normalize(domain string) string {
+	d := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	if d == "" || strings.ContainsAny(d, `/\`) || strings.Contains(d, "..") {
+		return ""
+	}
+	return d
+}
@@ -0,0 +1,213 @@
+// Package templates stores named DNS record layouts that can be applied to
+// many domains. Record fields may contain {{variable}} placeholders.
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultPath = "state/templates.json"
+
+var ErrNotFound = errors.New("Template not found")
+
+// Record is one record of a template. Host and Value may use placeholders;
+// {{domain}} is always available.
+type Record struct {
+	Host     string `json:"host"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	Priority *int   `json:"priority,omitempty"`
+	TTL      int    `json:"ttl,omitempty"`
+	Proxied  *bool  `json:"proxied,omitempty"`
+}
+
+type Template struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Records     []Record `json:"records"`
+	// Defaults are used for variables a domain doesn't set
+	Defaults  map[string]string `json:"defaults,omitempty"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// Variables lists the placeholders used by the template, apart from domain.
+func (t *Template) Variables() []string {
+	seen := map[string]bool{"domain": true}
+	var names []string
+	for _, r := range t.Records {
+		for _, m := range placeholder.FindAllStringSubmatch(r.Host+" "+r.Value, -1) {
+			name := strings.ToLower(m[1])
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Expand replaces the placeholders in s with vars (keys are lower case). It
+// fails on the first variable that has no value.
+func Expand(s string, vars map[string]string) (string, error) {
+	var missing string
+	out := placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		name := strings.ToLower(placeholder.FindStringSubmatch(m)[1])
+		v, ok := vars[name]
+		if (!ok || v == "") && missing == "" {
+			missing = name
+		}
+		return v
+	})
+	if missing != "" {
+		return "", errors.New("Missing variable " + missing)
+	}
+	return out, nil
+}
+
+var (
+	path      = DefaultPath
+	mu        sync.Mutex
+	templates []Template
+	// loaded is set once the file has been read
+	loaded bool
+)
+
+func SetPath(p string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if p == "" {
+		p = DefaultPath
+	}
+	path = p
+	loaded = false
+}
+
+// List returns the templates sorted by name.
+func List() ([]Template, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return nil, err
+	}
+
+	list := make([]Template, len(templates))
+	copy(list, templates)
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func Get(name string) (*Template, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return nil, err
+	}
+
+	i := index(name)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	t := templates[i]
+	return &t, nil
+}
+
+// Save creates the template or replaces the one with the same name.
+func Save(t Template) (*Template, error) {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return nil, errors.New("Template name is required")
+	}
+	if len(t.Records) == 0 {
+		return nil, errors.New("Template has no records")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return nil, err
+	}
+
+	t.UpdatedAt = time.Now()
+	if i := index(t.Name); i >= 0 {
+		templates[i] = t
+	} else {
+		templates = append(templates, t)
+	}
+	return &t, save()
+}
+
+func Delete(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := load(); err != nil {
+		return err
+	}
+
+	i := index(name)
+	if i < 0 {
+		return ErrNotFound
+	}
+	templates = append(templates[:i], templates[i+1:]...)
+	return save()
+}
+
+// index finds a template by name, ignoring case.
+func index(name string) int {
+	name = strings.TrimSpace(name)
+	for i, t := range templates {
+		if strings.EqualFold(t.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func load() error {
+	if loaded {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			templates = []Template{}
+			loaded = true
+			return nil
+		}
+		return err
+	}
+	var stored []Template
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	templates = stored
+	loaded = true
+	return nil
+}
+
+// save writes the templates to a temporary file first so a crash can't leave
+// a truncated file behind.
+func save() error {
+	data, err := json.MarshalIndent(templates, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
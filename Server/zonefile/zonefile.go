@@ -0,0 +1,628 @@
+// Package zonefile reads and writes DNS records in BIND zone file format
+// (RFC 1035 master files).
+package zonefile
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultTTL is used when neither the record nor a $TTL directive sets one.
+const DefaultTTL = 3600
+
+// ErrUnsupportedType is returned for record types this package can't convert
+// to Cloudflare records, such as TLSA, DS or NAPTR.
+var ErrUnsupportedType = errors.New("unsupported record type")
+
+// Record is one resource record with its owner name fully qualified and
+// without the trailing dot. Record types with structured fields (SRV, CAA,
+// HTTPS, SVCB) carry them in Data; MX keeps its preference in Priority.
+type Record struct {
+	Line     int                    `json:"line,omitempty"`
+	Name     string                 `json:"name"`
+	TTL      int                    `json:"ttl"`
+	Type     string                 `json:"type"`
+	Content  string                 `json:"content,omitempty"`
+	Priority *int                   `json:"priority,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	Proxied  bool                   `json:"proxied,omitempty"`
+}
+
+type ParseError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// Skipped lists records that were understood but are not imported, such as
+// the SOA and the apex NS set that Cloudflare manages itself, or record types
+// that can't be imported.
+type Skipped struct {
+	Line   int    `json:"line"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+type Result struct {
+	Records []Record     `json:"records"`
+	Skipped []Skipped    `json:"skipped,omitempty"`
+	Errors  []ParseError `json:"errors,omitempty"`
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+type entry struct {
+	line    int
+	tokens  []token
+	blank   bool // owner omitted, the previous one applies
+	comment string
+}
+
+// Parse reads a zone file. origin is used until a $ORIGIN directive changes
+// it. Lines that fail to parse are reported in Errors and do not stop the
+// rest of the file.
+func Parse(text string, origin string) Result {
+	res := Result{Records: []Record{}}
+	origin = canonical(origin)
+	defaultTTL := 0
+	lastTTL := 0
+	lastOwner := ""
+
+	entries, errs := tokenize(text)
+	res.Errors = append(res.Errors, errs...)
+
+	for _, e := range entries {
+		fail := func(format string, args ...interface{}) {
+			res.Errors = append(res.Errors, ParseError{Line: e.line, Message: fmt.Sprintf(format, args...)})
+		}
+
+		toks := e.tokens
+		if !e.blank && strings.HasPrefix(toks[0].text, "$") && !toks[0].quoted {
+			switch strings.ToUpper(toks[0].text) {
+			case "$ORIGIN":
+				if len(toks) < 2 {
+					fail("$ORIGIN needs a name")
+					continue
+				}
+				origin = absolute(toks[1].text, origin)
+			case "$TTL":
+				if len(toks) < 2 {
+					fail("$TTL needs a value")
+					continue
+				}
+				ttl, err := parseTTL(toks[1].text)
+				if err != nil {
+					fail("invalid $TTL %q", toks[1].text)
+					continue
+				}
+				defaultTTL = ttl
+			default:
+				fail("unsupported directive %s", toks[0].text)
+			}
+			continue
+		}
+
+		owner := lastOwner
+		if !e.blank {
+			owner = absolute(toks[0].text, origin)
+			toks = toks[1:]
+		}
+		if owner == "" {
+			fail("record without owner name")
+			continue
+		}
+		lastOwner = owner
+
+		ttl := -1
+		for len(toks) > 0 && !toks[0].quoted {
+			if isClass(toks[0].text) {
+				toks = toks[1:]
+				continue
+			}
+			if v, err := parseTTL(toks[0].text); err == nil && ttl < 0 {
+				ttl = v
+				toks = toks[1:]
+				continue
+			}
+			break
+		}
+		if len(toks) == 0 {
+			fail("missing record type")
+			continue
+		}
+		switch {
+		case ttl >= 0:
+			lastTTL = ttl
+		case defaultTTL > 0:
+			ttl = defaultTTL
+		case lastTTL > 0:
+			ttl = lastTTL
+		default:
+			ttl = DefaultTTL
+		}
+
+		rtype := strings.ToUpper(toks[0].text)
+		rdata := toks[1:]
+		switch rtype {
+		case "SOA":
+			res.Skipped = append(res.Skipped, Skipped{Line: e.line, Type: rtype, Name: owner, Reason: "managed by Cloudflare"})
+			continue
+		case "NS":
+			if owner == origin {
+				res.Skipped = append(res.Skipped, Skipped{Line: e.line, Type: rtype, Name: owner, Reason: "apex NS records are managed by Cloudflare"})
+				continue
+			}
+		}
+
+		rec, err := buildRecord(rtype, rdata, origin)
+		if errors.Is(err, ErrUnsupportedType) {
+			res.Skipped = append(res.Skipped, Skipped{Line: e.line, Type: rtype, Name: owner, Reason: "record type " + rtype + " is not supported"})
+			continue
+		}
+		if err != nil {
+			fail("%s %s: %v", owner, rtype, err)
+			continue
+		}
+		rec.Line = e.line
+		rec.Name = owner
+		rec.TTL = ttl
+		rec.Proxied = strings.Contains(e.comment, "cf-proxied:true")
+		res.Records = append(res.Records, rec)
+	}
+	return res
+}
+
+// ParseRData parses the data part of a single record in presentation form,
+// e.g. "10 mail.example.com." for MX or `0 issue "letsencrypt.org"` for CAA.
+// Relative names are qualified against origin when it is set.
+func ParseRData(rtype string, rdata string, origin string) (Record, error) {
+	entries, errs := tokenize(rdata)
+	if len(errs) > 0 {
+		return Record{}, fmt.Errorf("%s", errs[0].Message)
+	}
+	var toks []token
+	for _, e := range entries {
+		toks = append(toks, e.tokens...)
+	}
+	return buildRecord(strings.ToUpper(rtype), toks, canonical(origin))
+}
+
+func buildRecord(rtype string, rdata []token, origin string) (Record, error) {
+	rec := Record{Type: rtype}
+	need := func(n int) error {
+		if len(rdata) != n {
+			return fmt.Errorf("expected %d fields, got %d", n, len(rdata))
+		}
+		return nil
+	}
+
+	switch rtype {
+	case "A", "AAAA":
+		if err := need(1); err != nil {
+			return rec, err
+		}
+		rec.Content = rdata[0].text
+	case "CNAME", "NS", "PTR":
+		if err := need(1); err != nil {
+			return rec, err
+		}
+		rec.Content = absolute(rdata[0].text, origin)
+	case "MX":
+		if err := need(2); err != nil {
+			return rec, err
+		}
+		pref, err := parseUint(rdata[0].text, 65535)
+		if err != nil {
+			return rec, fmt.Errorf("invalid preference %q", rdata[0].text)
+		}
+		rec.Priority = &pref
+		rec.Content = absolute(rdata[1].text, origin)
+	case "TXT", "SPF":
+		if len(rdata) == 0 {
+			return rec, fmt.Errorf("missing text")
+		}
+		// multi-string TXT data is one value split into <=255 byte chunks
+		var sb strings.Builder
+		for _, t := range rdata {
+			sb.WriteString(t.text)
+		}
+		rec.Type = "TXT"
+		rec.Content = sb.String()
+	case "SRV":
+		if err := need(4); err != nil {
+			return rec, err
+		}
+		var nums [3]int
+		for i := 0; i < 3; i++ {
+			n, err := parseUint(rdata[i].text, 65535)
+			if err != nil {
+				return rec, fmt.Errorf("invalid number %q", rdata[i].text)
+			}
+			nums[i] = n
+		}
+		rec.Data = map[string]interface{}{
+			"priority": nums[0],
+			"weight":   nums[1],
+			"port":     nums[2],
+			"target":   absolute(rdata[3].text, origin),
+		}
+	case "CAA":
+		if err := need(3); err != nil {
+			return rec, err
+		}
+		flags, err := parseUint(rdata[0].text, 255)
+		if err != nil {
+			return rec, fmt.Errorf("invalid flags %q", rdata[0].text)
+		}
+		rec.Data = map[string]interface{}{
+			"flags": flags,
+			"tag":   rdata[1].text,
+			"value": rdata[2].text,
+		}
+	case "HTTPS", "SVCB":
+		if len(rdata) < 2 {
+			return rec, fmt.Errorf("expected priority and target")
+		}
+		prio, err := parseUint(rdata[0].text, 65535)
+		if err != nil {
+			return rec, fmt.Errorf("invalid priority %q", rdata[0].text)
+		}
+		target := rdata[1].text
+		if target != "." {
+			target = absolute(target, origin)
+		}
+		var params []string
+		for _, t := range rdata[2:] {
+			params = append(params, t.text)
+		}
+		rec.Data = map[string]interface{}{
+			"priority": prio,
+			"target":   target,
+			"value":    strings.Join(params, " "),
+		}
+	default:
+		return rec, ErrUnsupportedType
+	}
+	return rec, nil
+}
+
+// tokenize splits the file into entries, joining parenthesised continuation
+// lines and stripping comments outside quoted strings.
+func tokenize(text string) ([]entry, []ParseError) {
+	var (
+		entries []entry
+		errs    []ParseError
+		cur     *entry
+		tok     strings.Builder
+		inTok   bool
+		quoted  bool
+		parens  int
+		line    = 1
+	)
+
+	flushTok := func() {
+		if inTok {
+			cur.tokens = append(cur.tokens, token{text: tok.String(), quoted: quoted})
+			tok.Reset()
+			inTok = false
+			quoted = false
+		}
+	}
+	startEntry := func(blank bool) {
+		cur = &entry{line: line, blank: blank}
+	}
+	endEntry := func() {
+		flushTok()
+		if cur != nil && len(cur.tokens) > 0 {
+			entries = append(entries, *cur)
+		}
+		cur = nil
+	}
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if cur == nil {
+			startEntry(r == ' ' || r == '\t')
+		}
+
+		if quoted {
+			switch r {
+			case '"':
+				// append directly so an empty string "" still yields a token
+				cur.tokens = append(cur.tokens, token{text: tok.String(), quoted: true})
+				tok.Reset()
+				inTok = false
+				quoted = false
+			case '\\':
+				if i+3 < len(runes) && isDigit(runes[i+1]) && isDigit(runes[i+2]) && isDigit(runes[i+3]) {
+					n, _ := strconv.Atoi(string(runes[i+1 : i+4]))
+					tok.WriteByte(byte(n))
+					i += 3
+				} else if i+1 < len(runes) {
+					i++
+					tok.WriteRune(runes[i])
+				}
+			case '\n':
+				line++
+				tok.WriteRune(r)
+			default:
+				tok.WriteRune(r)
+			}
+			continue
+		}
+
+		switch r {
+		case '"':
+			if inTok {
+				// a quote inside a token, as in SVCB params like
+				// alpn="h2,h3", stays part of that token verbatim
+				j := i + 1
+				for j < len(runes) && runes[j] != '"' && runes[j] != '\n' {
+					j++
+				}
+				if j < len(runes) && runes[j] == '"' {
+					tok.WriteString(string(runes[i : j+1]))
+					i = j
+					continue
+				}
+			}
+			flushTok()
+			inTok = true
+			quoted = true
+		case ';':
+			flushTok()
+			j := i
+			for j < len(runes) && runes[j] != '\n' {
+				j++
+			}
+			cur.comment += string(runes[i+1 : j])
+			i = j - 1
+		case '(':
+			flushTok()
+			parens++
+		case ')':
+			flushTok()
+			if parens == 0 {
+				errs = append(errs, ParseError{Line: line, Message: "unbalanced )"})
+			} else {
+				parens--
+			}
+		case '\n':
+			flushTok()
+			if parens == 0 {
+				endEntry()
+			}
+			line++
+		case ' ', '\t', '\r':
+			flushTok()
+		case '\\':
+			inTok = true
+			if i+1 < len(runes) {
+				i++
+				tok.WriteRune(runes[i])
+			}
+		default:
+			inTok = true
+			tok.WriteRune(r)
+		}
+	}
+	if quoted {
+		errs = append(errs, ParseError{Line: line, Message: "unterminated quoted string"})
+	}
+	if parens > 0 {
+		errs = append(errs, ParseError{Line: line, Message: "unbalanced ("})
+	}
+	if cur != nil {
+		endEntry()
+	}
+	return entries, errs
+}
+
+// Generate renders records as a zone file for origin. Names are written
+// fully qualified and proxied records are tagged the way Cloudflare's own
+// export does, so Parse reads the proxied flag back.
+func Generate(origin string, ttl int, records []Record) string {
+	origin = canonical(origin)
+	sorted := append([]Record(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].Type < sorted[j].Type
+	})
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "$ORIGIN %s.\n", origin)
+	if ttl > 0 {
+		fmt.Fprintf(&sb, "$TTL %d\n", ttl)
+	}
+	sb.WriteString("\n")
+	for _, r := range sorted {
+		rdata, err := formatRData(r)
+		if err != nil {
+			fmt.Fprintf(&sb, "; %s %s skipped: %v\n", r.Name, r.Type, err)
+			continue
+		}
+		fmt.Fprintf(&sb, "%s.\t%d\tIN\t%s\t%s", r.Name, r.TTL, r.Type, rdata)
+		if r.Proxied {
+			sb.WriteString(" ; cf_tags=cf-proxied:true")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// RData returns the record data in zone file presentation form.
+func (r Record) RData() (string, error) {
+	return formatRData(r)
+}
+
+func formatRData(r Record) (string, error) {
+	switch r.Type {
+	case "CNAME", "NS", "PTR":
+		return fqdn(r.Content), nil
+	case "MX":
+		pref := 0
+		if r.Priority != nil {
+			pref = *r.Priority
+		}
+		return fmt.Sprintf("%d %s", pref, fqdn(r.Content)), nil
+	case "TXT", "SPF":
+		return quoteTXT(r.Content), nil
+	case "SRV":
+		if r.Data == nil {
+			return "", fmt.Errorf("missing data")
+		}
+		return fmt.Sprintf("%v %v %v %s", number(r.Data["priority"]), number(r.Data["weight"]), number(r.Data["port"]), fqdn(fmt.Sprint(r.Data["target"]))), nil
+	case "CAA":
+		if r.Data == nil {
+			return "", fmt.Errorf("missing data")
+		}
+		return fmt.Sprintf("%v %v %s", number(r.Data["flags"]), r.Data["tag"], quote(fmt.Sprint(r.Data["value"]))), nil
+	case "HTTPS", "SVCB":
+		if r.Data == nil {
+			return "", fmt.Errorf("missing data")
+		}
+		target := fmt.Sprint(r.Data["target"])
+		if target != "." {
+			target = fqdn(target)
+		}
+		s := fmt.Sprintf("%v %s", number(r.Data["priority"]), target)
+		if v := fmt.Sprint(r.Data["value"]); r.Data["value"] != nil && v != "" {
+			s += " " + v
+		}
+		return s, nil
+	}
+	return r.Content, nil
+}
+
+// quoteTXT splits text into the 255 byte character-strings a TXT record is
+// made of.
+func quoteTXT(text string) string {
+	if text == "" {
+		return `""`
+	}
+	// Cloudflare may already hold the value in presentation form
+	if strings.HasPrefix(text, `"`) && strings.HasSuffix(text, `"`) && len(text) > 1 {
+		return text
+	}
+	var parts []string
+	for len(text) > 255 {
+		parts = append(parts, quote(text[:255]))
+		text = text[255:]
+	}
+	parts = append(parts, quote(text))
+	return strings.Join(parts, " ")
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// number prints JSON numbers (float64 after decoding) without a fraction.
+func number(v interface{}) interface{} {
+	if f, ok := v.(float64); ok && f == float64(int64(f)) {
+		return int64(f)
+	}
+	return v
+}
+
+func fqdn(name string) string {
+	if name == "" || strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func canonical(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
+
+// absolute qualifies name against origin: "@" is the origin itself, names
+// ending in a dot are already absolute, anything else is relative.
+func absolute(name string, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return canonical(name)
+	case origin == "":
+		return canonical(name)
+	}
+	return canonical(name + "." + origin)
+}
+
+func isClass(s string) bool {
+	switch strings.ToUpper(s) {
+	case "IN", "CH", "HS", "CS":
+		return true
+	}
+	return false
+}
+
+// parseTTL accepts plain seconds or BIND units such as 1h30m, 2d, 1w.
+func parseTTL(s string) (int, error) {
+	if s == "" || !isDigit(rune(s[0])) {
+		return 0, fmt.Errorf("invalid ttl")
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	}
+	total, num := 0, 0
+	seenDigit := false
+	for _, r := range strings.ToLower(s) {
+		if isDigit(r) {
+			num = num*10 + int(r-'0')
+			seenDigit = true
+			continue
+		}
+		if !seenDigit {
+			return 0, fmt.Errorf("invalid ttl")
+		}
+		switch r {
+		case 's':
+			total += num
+		case 'm':
+			total += num * 60
+		case 'h':
+			total += num * 3600
+		case 'd':
+			total += num * 86400
+		case 'w':
+			total += num * 604800
+		default:
+			return 0, fmt.Errorf("invalid ttl")
+		}
+		num = 0
+		seenDigit = false
+	}
+	if seenDigit {
+		return 0, fmt.Errorf("invalid ttl")
+	}
+	return total, nil
+}
+
+func parseUint(s string, max int) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > max {
+		return 0, fmt.Errorf("out of range")
+	}
+	return n, nil
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
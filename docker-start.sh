@@ -9,8 +9,15 @@ if [ ! -f "Server/config.yaml" ]; then
     exit 1
 fi
 
+if [ -z "$CF_TOOLS_MASTER_KEY" ] && ! grep -qs '^CF_TOOLS_MASTER_KEY=' .env; then
+    echo "未设置主密钥 CF_TOOLS_MASTER_KEY，用于加密 accounts.json 中的 API Key"
+    echo "请生成后保存在数据目录以外的地方，例如:"
+    echo "  export CF_TOOLS_MASTER_KEY=\$(openssl rand -hex 32)"
+    exit 1
+fi
+
 echo "==> 创建数据目录..."
-mkdir -p data/certs
+mkdir -p data/certs data/logs data/snapshots data/state
 
 echo "==> 使用传统 Docker 构建..."
 export DOCKER_BUILDKIT=0